@@ -8,6 +8,15 @@ import (
 // GobEncoding gob encode
 type GobEncoding struct{}
 
+func init() {
+	RegisterCodec(GobEncoding{})
+}
+
+// Name gob codec name
+func (g GobEncoding) Name() string {
+	return "gob"
+}
+
 // Marshal gob encode
 func (g GobEncoding) Marshal(v any) ([]byte, error) {
 	var (
@@ -5,6 +5,15 @@ import "github.com/vmihailenco/msgpack"
 // MsgPackEncoding msgpack 格式
 type MsgPackEncoding struct{}
 
+func init() {
+	RegisterCodec(MsgPackEncoding{})
+}
+
+// Name msgpack codec name
+func (mp MsgPackEncoding) Name() string {
+	return "msgpack"
+}
+
 // Marshal msgpack encode
 func (mp MsgPackEncoding) Marshal(v any) ([]byte, error) {
 	buf, err := msgpack.Marshal(v)
@@ -0,0 +1,105 @@
+package eventbus
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+)
+
+// ordered 是否需要按顺序键保证同键有序
+func (s *subscriber) ordered() bool {
+	return s.opt.OrderingKey != nil && !s.durable
+}
+
+// startAsync 启动异步订阅者的处理协程：
+//   - 并发为 1：单协程按到达顺序处理
+//   - 未设置 OrderingKey：多个协程共享同一个缓冲队列
+//   - 设置了 OrderingKey：路由协程按键哈希分区，每个分区一个协程，保证同键有序
+func (b *bus) startAsync(s *subscriber) {
+	n := s.opt.Concurrency
+	if n < 1 || s.opt.Once {
+		n = 1
+	}
+
+	if n == 1 || s.opt.OrderingKey == nil {
+		for i := 0; i < n; i++ {
+			b.wg.Add(1)
+			go b.asyncLoop(s, s.ch)
+		}
+		return
+	}
+
+	size := s.opt.Buffer / n
+	if size < 1 {
+		size = 1
+	}
+	s.parts = make([]chan job, n)
+	for i := range s.parts {
+		s.parts[i] = make(chan job, size)
+		b.wg.Add(1)
+		go b.asyncLoop(s, s.parts[i])
+	}
+	b.wg.Add(1)
+	go b.route(s, s.parts)
+}
+
+func (b *bus) asyncLoop(s *subscriber, ch <-chan job) {
+	defer b.wg.Done()
+	for {
+		// 暂停期间不取事件，事件留在缓冲中
+		if !s.waitResumed(b.ctx.Done()) {
+			return
+		}
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-s.closed:
+			return
+		case j := <-ch:
+			// 取到事件后才被暂停的，持有到恢复；关闭时交给 Drain 上报
+			if !s.waitResumed(b.ctx.Done()) {
+				s.hold(j)
+				return
+			}
+			err := b.deliver(b.deliveryContext(context.Background(), j.evt), s, j.evt)
+			if err != nil {
+				log.Printf("[eventbus] handler error sub=%s pattern=%s key=%s id=%s err=%v",
+					s.id, s.pattern, j.evt.Key(), j.evt.ID(), err)
+			}
+			s.pending.Add(-1)
+			if s.opt.Once {
+				b.Unsubscribe(s.id)
+				return
+			}
+		}
+	}
+}
+
+// route 把订阅者缓冲中的事件按顺序键分发到各分区；分区满时阻塞，回压传递到订阅者缓冲
+func (b *bus) route(s *subscriber, parts []chan job) {
+	defer b.wg.Done()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-s.closed:
+			return
+		case j := <-s.ch:
+			p := parts[partition(s.opt.OrderingKey(j.evt), len(parts))]
+			select {
+			case p <- j:
+			case <-b.ctx.Done():
+				s.hold(j)
+				return
+			case <-s.closed:
+				return
+			}
+		}
+	}
+}
+
+func partition(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
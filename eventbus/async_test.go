@@ -0,0 +1,111 @@
+package eventbus
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOrderedConcurrentDelivery(t *testing.T) {
+	b := New(WithAsyncWorkers(4))
+	defer b.Close(context.Background())
+
+	var (
+		mu       sync.Mutex
+		seen     = map[int][]int{} // OrderID -> UserID 序列
+		active   = map[int]bool{}
+		inflight int32
+		peak     int32
+		overlap  bool
+		total    int32
+	)
+	b.SubscribeFunc("stock.*", func(ctx context.Context, evt Event) error {
+		dto, _ := DecodeJSON[shippedDTO](evt)
+		mu.Lock()
+		if active[dto.OrderID] {
+			overlap = true
+		}
+		active[dto.OrderID] = true
+		mu.Unlock()
+
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+
+		mu.Lock()
+		active[dto.OrderID] = false
+		seen[dto.OrderID] = append(seen[dto.OrderID], dto.UserID)
+		mu.Unlock()
+		atomic.AddInt32(&total, 1)
+		return nil
+	}, EventOptions{
+		Async:       true,
+		Buffer:      64,
+		Concurrency: 4,
+		OrderingKey: func(evt Event) string {
+			dto, _ := DecodeJSON[shippedDTO](evt)
+			return strconv.Itoa(dto.OrderID)
+		},
+	})
+
+	// 8 个订单，每个订单 5 条事件，UserID 作为序号
+	for seq := 0; seq < 5; seq++ {
+		for order := 0; order < 8; order++ {
+			_ = b.Publish(context.Background(), mustNewEvt(t, "stock.changed", order, seq))
+		}
+	}
+	waitUntil(t, 2*time.Second, func() bool { return atomic.LoadInt32(&total) == 40 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if overlap {
+		t.Fatalf("events with same ordering key ran concurrently")
+	}
+	for order, seqs := range seen {
+		for i, v := range seqs {
+			if v != i {
+				t.Fatalf("order %d processed out of order: %v", order, seqs)
+			}
+		}
+	}
+	if atomic.LoadInt32(&peak) < 2 {
+		t.Fatalf("expected parallel processing across keys, peak=%d", peak)
+	}
+}
+
+func TestConcurrentWithoutOrderingKey(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+
+	var inflight, peak, total int32
+	b.SubscribeFunc("img.resize", func(ctx context.Context, evt Event) error {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+		atomic.AddInt32(&total, 1)
+		return nil
+	}, EventOptions{Async: true, Concurrency: 3})
+
+	for i := 0; i < 9; i++ {
+		_ = b.Publish(context.Background(), mustNewEvt(t, "img.resize", i, i))
+	}
+	waitUntil(t, time.Second, func() bool { return atomic.LoadInt32(&total) == 9 })
+	if atomic.LoadInt32(&peak) < 2 {
+		t.Fatalf("expected concurrent handlers, peak=%d", peak)
+	}
+}
@@ -1,6 +1,9 @@
 package eventbus
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // 函数型处理器
 type EventFunc func(ctx context.Context, evt Event) error
@@ -24,6 +27,16 @@ type EventOptions struct {
 	DropPolicy DropPolicy
 	Priority   int // 值越大优先处理（异步时生效）
 	Once       bool
+	Durable    string         // 持久订阅名（需配合 WithWAL），重启后按该名字续传未确认的事件，隐含 Async
+	Retry      RetryPolicy    // 处理失败时的重试策略
+	DeadLetter DeadLetterSink // 重试耗尽后的死信接收端，为空时使用 WithDeadLetter 的设置
+	Timeout    time.Duration  // 单次处理的超时时间，0 表示不限制
+
+	// 异步处理并发度，默认 1；Once 订阅始终为 1，持久订阅按日志顺序串行处理
+	Concurrency int
+	// 顺序键：顺序键相同的事件（如同一订单）按发布顺序串行处理，不同键可并行处理；
+	// 设置后事件在 Publish 时直接进入订阅者缓冲，不参与全局优先级排序
+	OrderingKey func(evt Event) string
 }
 
 type EventBus interface {
@@ -32,4 +45,5 @@ type EventBus interface {
 	Unsubscribe(subID string) bool
 	Publish(ctx context.Context, evt Event) error
 	Close(ctx context.Context) error
+	Scheduler
 }
@@ -0,0 +1,152 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/spcent/x/encoding"
+	// 注册 json 编解码器，未声明内容类型的事件按 json 处理
+	_ "github.com/spcent/x/encoding/json"
+)
+
+const (
+	HeaderContentType  = "content-type"
+	DefaultContentType = "json"
+)
+
+var ErrUnknownCodec = errors.New("eventbus: unknown codec")
+
+// ContentTypeOf 返回事件的内容类型（即 encoding.Codec 的名字），未声明时为 json
+func ContentTypeOf(evt Event) string {
+	if ct := HeadersOf(evt).Get(HeaderContentType); ct != "" {
+		return ct
+	}
+	return DefaultContentType
+}
+
+func lookupCodec(name string) (encoding.Codec, error) {
+	if name == "" {
+		name = DefaultContentType
+	}
+	c := encoding.GetCodec(strings.ToLower(name))
+	if c == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+	}
+	return c, nil
+}
+
+// NewCodecEvent 使用已注册的 encoding.Codec 编码 v，并在元数据中记录内容类型
+func NewCodecEvent(key string, v any, codec string) (Event, error) {
+	c, err := lookupCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &BaseEvent{
+		key:     key,
+		payload: b,
+		id:      uuid.NewString(),
+		at:      time.Now(),
+		headers: Headers{HeaderContentType: c.Name()},
+	}, nil
+}
+
+// Decode 按事件的内容类型把负载解为目标类型
+func Decode[T any](evt Event) (T, error) {
+	var zero T
+	c, err := lookupCodec(ContentTypeOf(evt))
+	if err != nil {
+		return zero, err
+	}
+
+	// T 为指针类型（如 *pb.Order）时需要先分配，proto 等编解码器要求传入消息指针
+	if rt := reflect.TypeFor[T](); rt.Kind() == reflect.Ptr {
+		v := reflect.New(rt.Elem()).Interface().(T)
+		if err := c.Unmarshal(evt.Payload(), v); err != nil {
+			return zero, err
+		}
+		return v, nil
+	}
+
+	var v T
+	if err := c.Unmarshal(evt.Payload(), &v); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// PublishTyped 用 codec 编码 v 后发布，codec 为空时使用 json
+func PublishTyped[T any](ctx context.Context, bus EventBus, key string, v T, codec string) error {
+	evt, err := NewCodecEvent(key, v, codec)
+	if err != nil {
+		return err
+	}
+	return bus.Publish(ctx, evt)
+}
+
+// TypedFunc 类型化的事件处理器
+type TypedFunc[T any] func(ctx context.Context, evt Event, v T) error
+
+// DecodeErrorHandler 处理类型化订阅的解码失败，返回的错误会作为处理器错误参与重试和死信
+type DecodeErrorHandler func(ctx context.Context, evt Event, err error) error
+
+// WithDecodeErrorHandler 设置类型化订阅解码失败时的回调，默认只记录日志并丢弃事件
+func WithDecodeErrorHandler(h DecodeErrorHandler) BusOption {
+	return func(b *bus) { b.decodeErrorHandler = h }
+}
+
+// decodeErrorHook 由内置的 EventBus 实现提供
+type decodeErrorHook interface {
+	onDecodeError() DecodeErrorHandler
+}
+
+// Wrapper 由包装其他 EventBus 的实现提供（例如 eventbustest.Bus），
+// SubscribeTyped 通过它找到被包装总线上设置的解码失败回调
+type Wrapper interface {
+	Unwrap() EventBus
+}
+
+// decodeErrorHandlerOf 沿包装链查找解码失败回调
+func decodeErrorHandlerOf(bus EventBus) DecodeErrorHandler {
+	for bus != nil {
+		if hook, ok := bus.(decodeErrorHook); ok {
+			return hook.onDecodeError()
+		}
+		w, ok := bus.(Wrapper)
+		if !ok {
+			return nil
+		}
+		bus = w.Unwrap()
+	}
+	return nil
+}
+
+func (b *bus) onDecodeError() DecodeErrorHandler { return b.decodeErrorHandler }
+
+// SubscribeTyped 订阅并自动按内容类型解码为 T，解码失败交给 WithDecodeErrorHandler 设置的回调
+func SubscribeTyped[T any](bus EventBus, pattern string, h TypedFunc[T], opt EventOptions) (subID string) {
+	onErr := decodeErrorHandlerOf(bus)
+
+	return bus.SubscribeFunc(pattern, func(ctx context.Context, evt Event) error {
+		v, err := Decode[T](evt)
+		if err != nil {
+			if onErr != nil {
+				return onErr(ctx, evt, err)
+			}
+			log.Printf("[eventbus] decode error pattern=%s key=%s id=%s content-type=%s err=%v",
+				pattern, evt.Key(), evt.ID(), ContentTypeOf(evt), err)
+			return nil
+		}
+		return h(ctx, evt, v)
+	}, opt)
+}
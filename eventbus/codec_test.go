@@ -0,0 +1,72 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range []string{"json", "gob", "msgpack"} {
+		t.Run(codec, func(t *testing.T) {
+			evt, err := NewCodecEvent("order.shipped", shippedDTO{OrderID: 5, UserID: 6}, codec)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if ContentTypeOf(evt) != codec {
+				t.Fatalf("content type want %s got %s", codec, ContentTypeOf(evt))
+			}
+			dto, err := Decode[shippedDTO](evt)
+			if err != nil || dto.OrderID != 5 || dto.UserID != 6 {
+				t.Fatalf("decode dto=%+v err=%v", dto, err)
+			}
+			ptr, err := Decode[*shippedDTO](evt)
+			if err != nil || ptr.OrderID != 5 {
+				t.Fatalf("decode pointer dto=%+v err=%v", ptr, err)
+			}
+		})
+	}
+
+	// 老的 NewJSONEvent 没有内容类型，按 json 解码
+	dto, err := Decode[shippedDTO](mustNewEvt(t, "a", 1, 2))
+	if err != nil || dto.UserID != 2 {
+		t.Fatalf("legacy json decode dto=%+v err=%v", dto, err)
+	}
+
+	if _, err := NewCodecEvent("a", 1, "xml"); !errors.Is(err, ErrUnknownCodec) {
+		t.Fatalf("expected ErrUnknownCodec, got %v", err)
+	}
+}
+
+func TestTypedSubscribe(t *testing.T) {
+	var decodeErrs int32
+	b := New(WithDecodeErrorHandler(func(ctx context.Context, evt Event, err error) error {
+		atomic.AddInt32(&decodeErrs, 1)
+		return nil
+	}))
+	defer b.Close(context.Background())
+
+	got := make(chan shippedDTO, 1)
+	SubscribeTyped(b, "order.*", func(ctx context.Context, evt Event, v shippedDTO) error {
+		got <- v
+		return nil
+	}, EventOptions{Async: true})
+
+	if err := PublishTyped(context.Background(), b, "order.shipped", shippedDTO{OrderID: 9}, "msgpack"); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case v := <-got:
+		if v.OrderID != 9 {
+			t.Fatalf("unexpected %+v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("typed handler not called")
+	}
+
+	bad := WithHeader(mustNewEvt(t, "order.bad", 1, 1), HeaderContentType, "gob")
+	_ = b.Publish(context.Background(), bad)
+	waitUntil(t, time.Second, func() bool { return atomic.LoadInt32(&decodeErrs) == 1 })
+}
@@ -0,0 +1,149 @@
+package eventbus
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Attempt 记录一次处理尝试
+type Attempt struct {
+	N        int // 第几次尝试，从 1 开始
+	At       time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// DeadLetter 重试耗尽后投递到死信的内容
+type DeadLetter struct {
+	Event    Event
+	SubID    string
+	Pattern  string
+	Attempts []Attempt
+	Err      error // 最后一次的错误
+	At       time.Time
+}
+
+// DeadLetterSink 接收处理失败的事件
+type DeadLetterSink interface {
+	Send(ctx context.Context, dl *DeadLetter) error
+}
+
+// WithDeadLetter 设置总线默认的死信接收端，EventOptions.DeadLetter 可按订阅覆盖
+func WithDeadLetter(sink DeadLetterSink) BusOption {
+	return func(b *bus) { b.deadLetterSink = sink }
+}
+
+func (b *bus) deadLetter(ctx context.Context, s *subscriber, evt Event, history []Attempt, lastErr error) error {
+	sink := s.opt.DeadLetter
+	if sink == nil {
+		sink = b.deadLetterSink
+	}
+	if sink == nil {
+		return lastErr
+	}
+
+	dl := &DeadLetter{
+		Event:    evt,
+		SubID:    s.id,
+		Pattern:  s.pattern,
+		Attempts: history,
+		Err:      lastErr,
+		At:       time.Now(),
+	}
+	if err := sink.Send(ctx, dl); err != nil {
+		log.Printf("[eventbus] dead letter send sub=%s pattern=%s key=%s id=%s err=%v",
+			s.id, s.pattern, evt.Key(), evt.ID(), err)
+		return lastErr
+	}
+	return nil
+}
+
+// MemoryDLQ 内存死信队列，超过容量时丢弃最旧的条目
+type MemoryDLQ struct {
+	mu       sync.Mutex
+	capacity int
+	items    []*DeadLetter
+	dropped  int
+}
+
+// NewMemoryDLQ 创建内存死信队列，capacity<=0 表示不限容量
+func NewMemoryDLQ(capacity int) *MemoryDLQ {
+	return &MemoryDLQ{capacity: capacity}
+}
+
+func (q *MemoryDLQ) Send(ctx context.Context, dl *DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.capacity > 0 && len(q.items) >= q.capacity {
+		q.items = q.items[1:]
+		q.dropped++
+	}
+	q.items = append(q.items, dl)
+	return nil
+}
+
+// List 返回当前所有死信的副本
+func (q *MemoryDLQ) List() []*DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	res := make([]*DeadLetter, len(q.items))
+	copy(res, q.items)
+	return res
+}
+
+// Len 返回当前死信数量
+func (q *MemoryDLQ) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Dropped 返回因容量限制被丢弃的死信数量
+func (q *MemoryDLQ) Dropped() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Redrive 依次把死信交给 fn 重新处理，成功的条目从队列移除；
+// 例如 q.Redrive(ctx, func(ctx context.Context, dl *DeadLetter) error { return bus.Publish(ctx, dl.Event) })
+// 返回成功重放的数量和第一个错误
+func (q *MemoryDLQ) Redrive(ctx context.Context, fn func(ctx context.Context, dl *DeadLetter) error) (int, error) {
+	items := q.List()
+
+	var n int
+	var firstErr error
+	done := make(map[*DeadLetter]bool)
+	for _, dl := range items {
+		if err := ctx.Err(); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			break
+		}
+		if err := fn(ctx, dl); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		done[dl] = true
+		n++
+	}
+
+	q.mu.Lock()
+	kept := q.items[:0]
+	for _, dl := range q.items {
+		if !done[dl] {
+			kept = append(kept, dl)
+		}
+	}
+	q.items = kept
+	q.mu.Unlock()
+
+	return n, firstErr
+}
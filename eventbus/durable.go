@@ -0,0 +1,130 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrDurableInUse 持久订阅仍在本实例运行，不能删除
+var ErrDurableInUse = errors.New("eventbus: durable subscription in use")
+
+// DurableAdmin 持久订阅的管理接口，内置的 EventBus 实现都支持
+type DurableAdmin interface {
+	// DeleteDurable 删除不再使用的持久订阅：WAL 删除它的 offset，不再为它保留日志，
+	// Redis 删除它的消费组。订阅仍在本实例运行时返回 ErrDurableInUse，未开启 WAL 时返回 ErrWALDisabled
+	DeleteDurable(name string) error
+}
+
+func (b *bus) DeleteDurable(name string) error {
+	if b.wal == nil {
+		if b.walErr != nil {
+			return b.walErr
+		}
+		return ErrWALDisabled
+	}
+	// 持有 mu，避免同名订阅在删除期间重新创建 offset
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if owner, ok := b.durables[name]; ok {
+		return fmt.Errorf("%w: %s by sub=%s", ErrDurableInUse, name, owner)
+	}
+	return b.wal.deleteCursor(name)
+}
+
+// runDurable 从 WAL 的 from 位置开始按顺序消费，处理完一条才提交一条，
+// 进程崩溃或 Close 后用同一个 Durable 名字重新订阅即可从未确认处继续。
+// 处理失败且没有进入死信时不提交，按订阅的重试退避稍后从该条重新投递。
+func (b *bus) runDurable(s *subscriber, from uint64) {
+	defer b.wg.Done()
+
+	r := b.wal.newReader(from)
+	defer r.close()
+
+	var pending uint64 // 已跳过但尚未提交的 offset（不匹配的事件不必每条都落盘）
+	var failures int   // 当前事件连续投递失败的次数
+	for {
+		changed := b.wal.changed()
+		for {
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-s.closed:
+				return
+			default:
+			}
+			// 暂停期间不读取，事件留在 WAL 中
+			if !s.waitResumed(b.ctx.Done()) {
+				return
+			}
+
+			rec, ok, err := r.read()
+			if err != nil {
+				log.Printf("[eventbus] wal read sub=%s durable=%s err=%v", s.id, s.opt.Durable, err)
+				r.close()
+				select {
+				case <-b.ctx.Done():
+					return
+				case <-s.closed:
+					return
+				case <-time.After(time.Second):
+				}
+				continue
+			}
+			if !ok {
+				break
+			}
+
+			if !MatchPattern(s.pattern, rec.Key) {
+				pending = rec.Offset
+				continue
+			}
+
+			evt := rec.event()
+			if err := b.deliver(b.deliveryContext(context.Background(), evt), s, evt); err != nil {
+				failures++
+				delay := s.opt.Retry.backoff(failures)
+				log.Printf("[eventbus] handler error sub=%s pattern=%s key=%s id=%s err=%v, redelivering in %s",
+					s.id, s.pattern, evt.Key(), evt.ID(), err, delay)
+				if pending > 0 {
+					b.commitDurable(s, pending)
+					pending = 0
+				}
+				r.rewind(rec.Offset)
+				if !b.sleep(context.Background(), s, delay) {
+					return
+				}
+				continue
+			}
+			failures = 0
+			b.commitDurable(s, rec.Offset)
+			pending = 0
+
+			if s.opt.Once {
+				b.Unsubscribe(s.id)
+				return
+			}
+		}
+
+		if pending > 0 {
+			b.commitDurable(s, pending)
+			pending = 0
+		}
+
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-s.closed:
+			return
+		case <-changed:
+		}
+	}
+}
+
+func (b *bus) commitDurable(s *subscriber, off uint64) {
+	if err := b.wal.commit(s.opt.Durable, off); err != nil {
+		log.Printf("[eventbus] wal commit sub=%s durable=%s offset=%d err=%v", s.id, s.opt.Durable, off, err)
+	}
+}
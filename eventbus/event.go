@@ -19,6 +19,7 @@ type BaseEvent struct {
 	payload []byte
 	id      string
 	at      time.Time
+	headers Headers
 }
 
 func (e *BaseEvent) Key() string     { return e.key }
@@ -26,6 +27,20 @@ func (e *BaseEvent) Payload() []byte { return e.payload }
 func (e *BaseEvent) ID() string      { return e.id }
 func (e *BaseEvent) At() time.Time   { return e.at }
 
+// Headers 返回事件元数据，未设置时为 nil
+func (e *BaseEvent) Headers() Headers { return e.headers }
+
+// Header 返回单个元数据的值
+func (e *BaseEvent) Header(key string) string { return e.headers.Get(key) }
+
+// SetHeader 设置元数据，应在发布前调用
+func (e *BaseEvent) SetHeader(key, value string) {
+	if e.headers == nil {
+		e.headers = Headers{}
+	}
+	e.headers[key] = value
+}
+
 // 这里只使用json格式进行序列化
 func NewJSONEvent(key string, data any) Event {
 	b, _ := json.Marshal(data)
@@ -37,6 +52,11 @@ func NewJSONEvent(key string, data any) Event {
 	}
 }
 
+// RestoreEvent 用已持久化的字段还原事件，供 WAL、事件存储等从磁盘读取时使用
+func RestoreEvent(key, id string, at time.Time, payload []byte, headers Headers) Event {
+	return &BaseEvent{key: key, payload: payload, id: id, at: at, headers: headers}
+}
+
 // DecodeJSON: 将事件负载解为目标类型
 func DecodeJSON[T any](evt Event) (T, error) {
 	var zero T
@@ -0,0 +1,257 @@
+// Package eventbustest 提供测试 eventbus 使用方的工具：记录所有发布的事件并提供断言，
+// 确定性模式下 Publish 返回前异步订阅已全部处理完，不需要再用 sleep 轮询。
+package eventbustest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spcent/x/eventbus"
+)
+
+const defaultFlushTimeout = 5 * time.Second
+
+type Option func(*config)
+
+type config struct {
+	deterministic bool
+	flushTimeout  time.Duration
+	busOpts       []eventbus.BusOption
+}
+
+// Deterministic 开启确定性模式：异步订阅改为在发布方的协程中同步执行，Publish 返回时处理器已全部执行完，
+// 处理器的错误也像同步订阅一样返回给 Publish。持久订阅不受影响
+func Deterministic() Option {
+	return func(c *config) { c.deterministic = true }
+}
+
+// WithFlushTimeout 设置 Flush 的最长等待时间，默认 5s
+func WithFlushTimeout(d time.Duration) Option {
+	return func(c *config) { c.flushTimeout = d }
+}
+
+// WithBusOptions 透传给 eventbus.New 的选项
+func WithBusOptions(opts ...eventbus.BusOption) Option {
+	return func(c *config) { c.busOpts = append(c.busOpts, opts...) }
+}
+
+// Bus 记录发布事件的 EventBus，底层是进程内的 eventbus.New；
+// 同时实现 Lifecycle、Inspector 和 DurableAdmin，并通过 Unwrap 暴露底层总线
+type Bus struct {
+	eventbus.EventBus
+
+	cfg   config
+	lc    eventbus.Lifecycle
+	in    eventbus.Inspector
+	admin eventbus.DurableAdmin
+
+	mu     sync.Mutex
+	events []eventbus.Event
+}
+
+func New(opts ...Option) *Bus {
+	cfg := config{flushTimeout: defaultFlushTimeout}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	b := &Bus{cfg: cfg}
+	busOpts := append([]eventbus.BusOption{}, cfg.busOpts...)
+	// 放在最内层，记录经过其他拦截器处理后实际发布的事件
+	busOpts = append(busOpts, eventbus.WithPublishInterceptor(b.record))
+
+	b.EventBus = eventbus.New(busOpts...)
+	b.lc = b.EventBus.(eventbus.Lifecycle)
+	b.in = b.EventBus.(eventbus.Inspector)
+	b.admin = b.EventBus.(eventbus.DurableAdmin)
+	return b
+}
+
+// Unwrap 返回底层的 EventBus
+func (b *Bus) Unwrap() eventbus.EventBus {
+	return b.EventBus
+}
+
+func (b *Bus) record(next eventbus.PublishFunc) eventbus.PublishFunc {
+	return func(ctx context.Context, evt eventbus.Event) error {
+		b.mu.Lock()
+		b.events = append(b.events, evt)
+		b.mu.Unlock()
+		return next(ctx, evt)
+	}
+}
+
+func (b *Bus) SubscribeFunc(pattern string, h eventbus.EventFunc, opt eventbus.EventOptions) (subID string) {
+	if b.cfg.deterministic && opt.Durable == "" {
+		opt.Async = false
+	}
+	return b.EventBus.SubscribeFunc(pattern, h, opt)
+}
+
+func (b *Bus) Subscribe(pattern string, h eventbus.EventHandle, opt eventbus.EventOptions) (subID string) {
+	return b.SubscribeFunc(pattern, h.Handle, opt)
+}
+
+// Flush 等待全局队列和所有异步订阅的缓冲处理完，最长等待 WithFlushTimeout 设置的时间
+func (b *Bus) Flush(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, b.cfg.flushTimeout)
+	defer cancel()
+	if err := b.lc.Flush(ctx); err != nil {
+		return fmt.Errorf("eventbustest: flush: %w", err)
+	}
+	return nil
+}
+
+// Drain 排空并关闭底层总线
+func (b *Bus) Drain(ctx context.Context) (eventbus.DrainReport, error) {
+	return b.lc.Drain(ctx)
+}
+
+// Pause 暂停订阅
+func (b *Bus) Pause(subID string) bool {
+	return b.lc.Pause(subID)
+}
+
+// Resume 恢复被暂停的订阅
+func (b *Bus) Resume(subID string) bool {
+	return b.lc.Resume(subID)
+}
+
+// Subscriptions 返回底层总线的所有订阅
+func (b *Bus) Subscriptions() []eventbus.SubscriptionInfo {
+	return b.in.Subscriptions()
+}
+
+// Stats 返回底层总线的计数
+func (b *Bus) Stats() eventbus.BusStats {
+	return b.in.Stats()
+}
+
+// DeleteDurable 删除底层总线的持久订阅
+func (b *Bus) DeleteDurable(name string) error {
+	return b.admin.DeleteDurable(name)
+}
+
+// Events 按发布顺序返回所有记录的事件
+func (b *Bus) Events() []eventbus.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]eventbus.Event(nil), b.events...)
+}
+
+// Published 返回键匹配 pattern 的事件，pattern 语法与订阅相同
+func (b *Bus) Published(pattern string) []eventbus.Event {
+	var res []eventbus.Event
+	for _, evt := range b.Events() {
+		if eventbus.MatchPattern(pattern, evt.Key()) {
+			res = append(res, evt)
+		}
+	}
+	return res
+}
+
+// Reset 清空记录
+func (b *Bus) Reset() {
+	b.mu.Lock()
+	b.events = nil
+	b.mu.Unlock()
+}
+
+// settle 断言前等待异步处理完成，使处理器中发布的事件也被记录
+func (b *Bus) settle(t testing.TB) {
+	t.Helper()
+	if err := b.Flush(context.Background()); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+// AssertPublished 断言至少发布过一次匹配 pattern 的事件
+func (b *Bus) AssertPublished(t testing.TB, pattern string) bool {
+	t.Helper()
+	b.settle(t)
+	if len(b.Published(pattern)) == 0 {
+		t.Errorf("eventbustest: no event matching %q published, got keys %v", pattern, b.keys())
+		return false
+	}
+	return true
+}
+
+// AssertPublishedTimes 断言匹配 pattern 的事件恰好发布了 n 次
+func (b *Bus) AssertPublishedTimes(t testing.TB, pattern string, n int) bool {
+	t.Helper()
+	b.settle(t)
+	if got := len(b.Published(pattern)); got != n {
+		t.Errorf("eventbustest: want %d events matching %q, got %d (keys %v)", n, pattern, got, b.keys())
+		return false
+	}
+	return true
+}
+
+// AssertNotPublished 断言没有发布匹配 pattern 的事件
+func (b *Bus) AssertNotPublished(t testing.TB, pattern string) bool {
+	t.Helper()
+	return b.AssertPublishedTimes(t, pattern, 0)
+}
+
+// AssertPublishedWith 断言存在匹配 pattern 且满足 match 的事件
+func (b *Bus) AssertPublishedWith(t testing.TB, pattern string, match func(evt eventbus.Event) bool) bool {
+	t.Helper()
+	b.settle(t)
+	for _, evt := range b.Published(pattern) {
+		if match(evt) {
+			return true
+		}
+	}
+	t.Errorf("eventbustest: no event matching %q satisfied the predicate", pattern)
+	return false
+}
+
+// AssertOrder 断言依次出现过分别匹配各 pattern 的事件（中间可以夹杂其他事件）
+func (b *Bus) AssertOrder(t testing.TB, patterns ...string) bool {
+	t.Helper()
+	b.settle(t)
+	i := 0
+	for _, evt := range b.Events() {
+		if i < len(patterns) && eventbus.MatchPattern(patterns[i], evt.Key()) {
+			i++
+		}
+	}
+	if i < len(patterns) {
+		t.Errorf("eventbustest: events not published in order %v, got keys %v (missing from %q)",
+			patterns, b.keys(), patterns[i])
+		return false
+	}
+	return true
+}
+
+// AssertPayload 断言存在匹配 pattern 且负载按内容类型解码后等于 want 的事件
+func AssertPayload[T any](t testing.TB, b *Bus, pattern string, want T) bool {
+	t.Helper()
+	b.settle(t)
+	var got []T
+	for _, evt := range b.Published(pattern) {
+		v, err := eventbus.Decode[T](evt)
+		if err != nil {
+			continue
+		}
+		if reflect.DeepEqual(v, want) {
+			return true
+		}
+		got = append(got, v)
+	}
+	t.Errorf("eventbustest: no event matching %q with payload %+v, got %+v", pattern, want, got)
+	return false
+}
+
+func (b *Bus) keys() []string {
+	events := b.Events()
+	keys := make([]string, len(events))
+	for i, evt := range events {
+		keys[i] = evt.Key()
+	}
+	return keys
+}
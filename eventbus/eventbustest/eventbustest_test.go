@@ -0,0 +1,160 @@
+package eventbustest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spcent/x/eventbus"
+)
+
+type orderDTO struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+// fakeT 记录断言失败而不让外层测试失败
+type fakeT struct {
+	testing.TB
+	failed []string
+}
+
+func (f *fakeT) Helper() {}
+func (f *fakeT) Errorf(format string, args ...any) {
+	f.failed = append(f.failed, fmt.Sprintf(format, args...))
+}
+
+func TestDeterministic(t *testing.T) {
+	b := New(Deterministic())
+	defer b.Close(context.Background())
+
+	handled := 0
+	b.SubscribeFunc("order.created", func(ctx context.Context, evt eventbus.Event) error {
+		dto, _ := eventbus.Decode[orderDTO](evt)
+		handled++
+		return b.Publish(ctx, eventbus.NewJSONEvent("order.confirmed", orderDTO{ID: dto.ID, Status: "confirmed"}))
+	}, eventbus.EventOptions{Async: true, Concurrency: 4})
+
+	for i := 1; i <= 3; i++ {
+		if err := b.Publish(context.Background(), eventbus.NewJSONEvent("order.created", orderDTO{ID: i})); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		// 不需要等待：Publish 返回时异步处理器已经执行完
+		if handled != i {
+			t.Fatalf("handler not run synchronously, handled=%d want %d", handled, i)
+		}
+	}
+
+	b.AssertPublishedTimes(t, "order.*", 6)
+	b.AssertPublishedTimes(t, "order.confirmed", 3)
+	b.AssertOrder(t, "order.created", "order.confirmed", "order.created", "order.confirmed")
+	AssertPayload(t, b, "order.confirmed", orderDTO{ID: 2, Status: "confirmed"})
+	b.AssertPublishedWith(t, "order.#", func(evt eventbus.Event) bool {
+		dto, _ := eventbus.Decode[orderDTO](evt)
+		return dto.ID == 3
+	})
+	b.AssertNotPublished(t, "payment.*")
+
+	b.Reset()
+	if len(b.Events()) != 0 {
+		t.Fatalf("reset did not clear events")
+	}
+}
+
+func TestDeterministicNestedPublish(t *testing.T) {
+	b := New(Deterministic(), WithFlushTimeout(100*time.Millisecond))
+	defer b.Close(context.Background())
+
+	b.SubscribeFunc("order.created", func(ctx context.Context, evt eventbus.Event) error {
+		// 不传入处理器收到的 ctx 也不会等待自己
+		return b.Publish(context.Background(), eventbus.NewJSONEvent("order.confirmed", orderDTO{}))
+	}, eventbus.EventOptions{Async: true})
+	confirmed := 0
+	b.SubscribeFunc("order.confirmed", func(ctx context.Context, evt eventbus.Event) error {
+		confirmed++
+		return nil
+	}, eventbus.EventOptions{Async: true})
+
+	if err := b.Publish(context.Background(), eventbus.NewJSONEvent("order.created", orderDTO{})); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if confirmed != 1 {
+		t.Fatalf("nested event not handled before publish returned, confirmed=%d", confirmed)
+	}
+}
+
+func TestAssertionsFail(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+
+	_ = b.Publish(context.Background(), eventbus.NewJSONEvent("user.signup", orderDTO{ID: 1}))
+
+	ft := &fakeT{TB: t}
+	checks := []bool{
+		b.AssertPublished(ft, "user.deleted"),
+		b.AssertPublishedTimes(ft, "user.*", 2),
+		b.AssertNotPublished(ft, "user.signup"),
+		b.AssertOrder(ft, "user.deleted", "user.signup"),
+		AssertPayload(ft, b, "user.signup", orderDTO{ID: 2}),
+	}
+	for i, ok := range checks {
+		if ok {
+			t.Fatalf("assertion %d should have failed", i)
+		}
+	}
+	if len(ft.failed) != len(checks) {
+		t.Fatalf("expected %d failures, got %v", len(checks), ft.failed)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+
+	n := 0
+	b.SubscribeFunc("tick", func(ctx context.Context, evt eventbus.Event) error {
+		n++
+		return nil
+	}, eventbus.EventOptions{Async: true})
+	for i := 0; i < 50; i++ {
+		_ = b.Publish(context.Background(), eventbus.NewJSONEvent("tick", i))
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if n != 50 {
+		t.Fatalf("flush returned before handlers finished, n=%d", n)
+	}
+}
+
+func TestForwardsCapabilities(t *testing.T) {
+	decodeErrs := 0
+	b := New(WithBusOptions(eventbus.WithDecodeErrorHandler(func(ctx context.Context, evt eventbus.Event, err error) error {
+		decodeErrs++
+		return nil
+	})))
+	var bus eventbus.EventBus = b
+
+	eventbus.SubscribeTyped(bus, "order.*", func(ctx context.Context, evt eventbus.Event, dto orderDTO) error {
+		return nil
+	}, eventbus.EventOptions{})
+	_ = b.Publish(context.Background(), eventbus.NewJSONEvent("order.created", "not an order"))
+	if decodeErrs != 1 {
+		t.Fatalf("decode error handler of the wrapped bus not used, calls=%d", decodeErrs)
+	}
+
+	if subs := bus.(eventbus.Inspector).Subscriptions(); len(subs) != 1 {
+		t.Fatalf("expected 1 subscription, got %+v", subs)
+	}
+	if err := bus.(eventbus.DurableAdmin).DeleteDurable("audit"); !errors.Is(err, eventbus.ErrWALDisabled) {
+		t.Fatalf("expected ErrWALDisabled, got %v", err)
+	}
+	if _, err := bus.(eventbus.Lifecycle).Drain(context.Background()); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if err := b.Publish(context.Background(), eventbus.NewJSONEvent("order.created", orderDTO{})); !errors.Is(err, eventbus.ErrBusClosed) {
+		t.Fatalf("expected ErrBusClosed after drain, got %v", err)
+	}
+}
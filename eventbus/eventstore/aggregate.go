@@ -0,0 +1,84 @@
+package eventstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/spcent/x/eventbus"
+)
+
+// Aggregate 可以由事件还原状态的聚合
+type Aggregate interface {
+	Apply(evt eventbus.Event) error
+}
+
+// Snapshotter 支持快照的聚合
+type Snapshotter interface {
+	Aggregate
+	Snapshot() ([]byte, error)
+	Restore(state []byte) error
+}
+
+// Repository 负责聚合的读取与保存
+type Repository struct {
+	Store Store
+	// SnapshotEvery 每追加多少个版本保存一次快照，<=0 不保存；聚合需实现 Snapshotter
+	SnapshotEvery int64
+}
+
+// Load 从最新快照（如有）开始重放事件还原聚合，返回聚合的当前版本
+func (r *Repository) Load(ctx context.Context, streamID string, agg Aggregate) (int64, error) {
+	var version int64
+	if sn, ok := agg.(Snapshotter); ok {
+		snap, found, err := r.Store.LoadSnapshot(ctx, streamID)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			if err := sn.Restore(snap.State); err != nil {
+				return 0, err
+			}
+			version = snap.Version
+		}
+	}
+
+	recs, err := r.Store.Load(ctx, streamID, version+1)
+	if err != nil {
+		return 0, err
+	}
+	for _, rec := range recs {
+		if err := agg.Apply(rec.Event); err != nil {
+			return 0, err
+		}
+		version = rec.Version
+	}
+	return version, nil
+}
+
+// Save 以 expected 为期望版本追加事件并应用到聚合，跨过快照间隔时保存快照；返回新版本
+func (r *Repository) Save(ctx context.Context, streamID string, agg Aggregate, expected int64, events ...eventbus.Event) (int64, error) {
+	version, err := r.Store.Append(ctx, streamID, expected, events...)
+	if err != nil {
+		return 0, err
+	}
+	for _, evt := range events {
+		if err := agg.Apply(evt); err != nil {
+			return version, err
+		}
+	}
+
+	sn, ok := agg.(Snapshotter)
+	if !ok || r.SnapshotEvery <= 0 || len(events) == 0 {
+		return version, nil
+	}
+	before := version - int64(len(events))
+	if version/r.SnapshotEvery == before/r.SnapshotEvery {
+		return version, nil
+	}
+	state, err := sn.Snapshot()
+	if err != nil {
+		return version, err
+	}
+	err = r.Store.SaveSnapshot(ctx, Snapshot{StreamID: streamID, Version: version, State: state, At: time.Now()})
+	return version, err
+}
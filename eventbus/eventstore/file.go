@@ -0,0 +1,391 @@
+package eventstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spcent/x/eventbus"
+)
+
+const (
+	eventsFile    = "events.log"
+	snapshotDir   = "snapshots"
+	checkpointDir = "checkpoints"
+	snapshotExt   = ".json"
+	checkpointExt = ".pos"
+)
+
+var ErrCorrupt = errors.New("eventstore: corrupt event log")
+
+// fileRecord 事件日志中的一行
+type fileRecord struct {
+	StreamID string           `json:"s"`
+	Version  int64            `json:"v"`
+	Position int64            `json:"p"`
+	Key      string           `json:"k"`
+	ID       string           `json:"i"`
+	At       time.Time        `json:"t"`
+	Payload  []byte           `json:"d,omitempty"`
+	Headers  eventbus.Headers `json:"h,omitempty"`
+}
+
+func (r *fileRecord) record() Record {
+	return Record{
+		StreamID: r.StreamID,
+		Version:  r.Version,
+		Position: r.Position,
+		Event:    eventbus.RestoreEvent(r.Key, r.ID, r.At, r.Payload, r.Headers),
+	}
+}
+
+type fileEntry struct {
+	off int64
+	n   int
+}
+
+// fileStore 基于追加写文件的实现：所有事件按全局位置逐行写入 events.log（JSON），
+// 内存中只保存每条事件的偏移量；快照与检查点各自一个文件，通过临时文件 + rename 原子替换
+type fileStore struct {
+	mu      sync.RWMutex
+	dir     string
+	f       *os.File
+	size    int64
+	fsync   bool
+	entries []fileEntry        // 下标为 Position-1
+	streams map[string][]int64 // 流 -> 各版本的全局位置
+	changed chan struct{}
+	closed  bool
+}
+
+type FileOption func(*fileStore)
+
+// WithFsync 每次追加后 fsync，默认只写入页缓存
+func WithFsync() FileOption {
+	return func(s *fileStore) { s.fsync = true }
+}
+
+// NewFileStore 打开（或创建）dir 下的事件存储；日志末尾写了一半的记录会被截掉
+func NewFileStore(dir string, opts ...FileOption) (Store, error) {
+	for _, d := range []string{dir, filepath.Join(dir, snapshotDir), filepath.Join(dir, checkpointDir)} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(filepath.Join(dir, eventsFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fileStore{
+		dir:     dir,
+		f:       f,
+		streams: make(map[string][]int64),
+		changed: make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileStore) load() error {
+	r := bufio.NewReader(s.f)
+	var off int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// 没有换行结尾的是写了一半的记录
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec fileRecord
+		if jerr := json.Unmarshal(line, &rec); jerr != nil {
+			if _, perr := r.Peek(1); errors.Is(perr, io.EOF) {
+				break
+			}
+			return fmt.Errorf("%w: offset %d: %v", ErrCorrupt, off, jerr)
+		}
+		if rec.Position != int64(len(s.entries))+1 || rec.Version != int64(len(s.streams[rec.StreamID]))+1 {
+			return fmt.Errorf("%w: offset %d: unexpected position %d version %d", ErrCorrupt, off, rec.Position, rec.Version)
+		}
+		s.entries = append(s.entries, fileEntry{off: off, n: len(line)})
+		s.streams[rec.StreamID] = append(s.streams[rec.StreamID], rec.Position)
+		off += int64(len(line))
+	}
+
+	if err := s.f.Truncate(off); err != nil {
+		return err
+	}
+	s.size = off
+	return nil
+}
+
+func (s *fileStore) Append(ctx context.Context, streamID string, expected int64, events ...eventbus.Event) (int64, error) {
+	if streamID == "" {
+		return 0, ErrInvalidID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, ErrClosed
+	}
+	version := int64(len(s.streams[streamID]))
+	if err := checkVersion(streamID, expected, version); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return version, nil
+	}
+
+	var buf bytes.Buffer
+	entries := make([]fileEntry, 0, len(events))
+	pos := int64(len(s.entries))
+	off := s.size
+	for i, evt := range events {
+		line, err := json.Marshal(&fileRecord{
+			StreamID: streamID,
+			Version:  version + int64(i) + 1,
+			Position: pos + int64(i) + 1,
+			Key:      evt.Key(),
+			ID:       evt.ID(),
+			At:       evt.At(),
+			Payload:  evt.Payload(),
+			Headers:  eventbus.HeadersOf(evt),
+		})
+		if err != nil {
+			return 0, err
+		}
+		line = append(line, '\n')
+		buf.Write(line)
+		entries = append(entries, fileEntry{off: off, n: len(line)})
+		off += int64(len(line))
+	}
+
+	// 一批事件一次写入，失败时截回原长度，保证批次的原子性
+	if _, err := s.f.WriteAt(buf.Bytes(), s.size); err != nil {
+		s.f.Truncate(s.size)
+		return 0, err
+	}
+	if s.fsync {
+		if err := s.f.Sync(); err != nil {
+			s.f.Truncate(s.size)
+			return 0, err
+		}
+	}
+
+	s.size = off
+	for i := range entries {
+		s.entries = append(s.entries, entries[i])
+		s.streams[streamID] = append(s.streams[streamID], pos+int64(i)+1)
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return version + int64(len(events)), nil
+}
+
+// read 读取全局位置 pos 的事件，调用方需持有读锁
+func (s *fileStore) read(pos int64) (Record, error) {
+	e := s.entries[pos-1]
+	b := make([]byte, e.n)
+	if _, err := s.f.ReadAt(b, e.off); err != nil {
+		return Record{}, err
+	}
+	var rec fileRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return Record{}, fmt.Errorf("%w: position %d: %v", ErrCorrupt, pos, err)
+	}
+	return rec.record(), nil
+}
+
+func (s *fileStore) Load(ctx context.Context, streamID string, from int64) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+	if from < 1 {
+		from = 1
+	}
+	positions := s.streams[streamID]
+	if from > int64(len(positions)) {
+		return nil, nil
+	}
+	res := make([]Record, 0, int64(len(positions))-from+1)
+	for _, p := range positions[from-1:] {
+		rec, err := s.read(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rec)
+	}
+	return res, nil
+}
+
+func (s *fileStore) Version(ctx context.Context, streamID string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	return int64(len(s.streams[streamID])), nil
+}
+
+func (s *fileStore) ReadAll(ctx context.Context, after int64, limit int) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+	if after < 0 {
+		after = 0
+	}
+	head := int64(len(s.entries))
+	if limit > 0 && after+int64(limit) < head {
+		head = after + int64(limit)
+	}
+	var res []Record
+	for p := after + 1; p <= head; p++ {
+		rec, err := s.read(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rec)
+	}
+	return res, nil
+}
+
+func (s *fileStore) Head(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	return int64(len(s.entries)), nil
+}
+
+func (s *fileStore) Changed() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changed
+}
+
+func (s *fileStore) snapshotPath(streamID string) string {
+	return filepath.Join(s.dir, snapshotDir, url.PathEscape(streamID)+snapshotExt)
+}
+
+func (s *fileStore) checkpointPath(name string) string {
+	return filepath.Join(s.dir, checkpointDir, url.PathEscape(name)+checkpointExt)
+}
+
+func (s *fileStore) SaveSnapshot(ctx context.Context, snap Snapshot) error {
+	if snap.StreamID == "" {
+		return ErrInvalidID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	cur, ok, err := s.loadSnapshot(snap.StreamID)
+	if err != nil {
+		return err
+	}
+	if ok && cur.Version > snap.Version {
+		return nil
+	}
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.snapshotPath(snap.StreamID), b)
+}
+
+func (s *fileStore) LoadSnapshot(ctx context.Context, streamID string) (Snapshot, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return Snapshot{}, false, ErrClosed
+	}
+	return s.loadSnapshot(streamID)
+}
+
+func (s *fileStore) loadSnapshot(streamID string) (Snapshot, bool, error) {
+	b, err := os.ReadFile(s.snapshotPath(streamID))
+	if errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, false, nil
+	}
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return Snapshot{}, false, err
+	}
+	return snap, true, nil
+}
+
+func (s *fileStore) Checkpoint(ctx context.Context, name string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	b, err := os.ReadFile(s.checkpointPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(bytes.TrimSpace(b)), 10, 64)
+}
+
+func (s *fileStore) SaveCheckpoint(ctx context.Context, name string, position int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return writeFileAtomic(s.checkpointPath(name), []byte(strconv.FormatInt(position, 10)))
+}
+
+func (s *fileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.changed)
+	return s.f.Close()
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
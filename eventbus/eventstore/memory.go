@@ -0,0 +1,183 @@
+package eventstore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/spcent/x/eventbus"
+)
+
+// memoryStore 内存实现，适合测试和不需要持久化的场景
+type memoryStore struct {
+	mu          sync.RWMutex
+	records     []Record         // 按全局位置排列，records[i].Position == i+1
+	streams     map[string][]int // 流 -> records 下标
+	snapshots   map[string]Snapshot
+	checkpoints map[string]int64
+	changed     chan struct{}
+	closed      bool
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		streams:     make(map[string][]int),
+		snapshots:   make(map[string]Snapshot),
+		checkpoints: make(map[string]int64),
+		changed:     make(chan struct{}),
+	}
+}
+
+func (m *memoryStore) Append(ctx context.Context, streamID string, expected int64, events ...eventbus.Event) (int64, error) {
+	if streamID == "" {
+		return 0, ErrInvalidID
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return 0, ErrClosed
+	}
+	version := int64(len(m.streams[streamID]))
+	if err := checkVersion(streamID, expected, version); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return version, nil
+	}
+
+	for _, evt := range events {
+		version++
+		m.records = append(m.records, Record{
+			StreamID: streamID,
+			Version:  version,
+			Position: int64(len(m.records)) + 1,
+			Event:    evt,
+		})
+		m.streams[streamID] = append(m.streams[streamID], len(m.records)-1)
+	}
+	close(m.changed)
+	m.changed = make(chan struct{})
+	return version, nil
+}
+
+func (m *memoryStore) Load(ctx context.Context, streamID string, from int64) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+	if from < 1 {
+		from = 1
+	}
+	idx := m.streams[streamID]
+	if from > int64(len(idx)) {
+		return nil, nil
+	}
+	res := make([]Record, 0, int64(len(idx))-from+1)
+	for _, i := range idx[from-1:] {
+		res = append(res, m.records[i])
+	}
+	return res, nil
+}
+
+func (m *memoryStore) Version(ctx context.Context, streamID string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return 0, ErrClosed
+	}
+	return int64(len(m.streams[streamID])), nil
+}
+
+func (m *memoryStore) ReadAll(ctx context.Context, after int64, limit int) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+	if after < 0 {
+		after = 0
+	}
+	if after >= int64(len(m.records)) {
+		return nil, nil
+	}
+	rest := m.records[after:]
+	if limit > 0 && len(rest) > limit {
+		rest = rest[:limit]
+	}
+	return append([]Record(nil), rest...), nil
+}
+
+func (m *memoryStore) Head(ctx context.Context) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return 0, ErrClosed
+	}
+	return int64(len(m.records)), nil
+}
+
+func (m *memoryStore) Changed() <-chan struct{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.changed
+}
+
+func (m *memoryStore) SaveSnapshot(ctx context.Context, snap Snapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if snap.StreamID == "" {
+		return ErrInvalidID
+	}
+	if cur, ok := m.snapshots[snap.StreamID]; ok && cur.Version > snap.Version {
+		return nil
+	}
+	snap.State = append([]byte(nil), snap.State...)
+	m.snapshots[snap.StreamID] = snap
+	return nil
+}
+
+func (m *memoryStore) LoadSnapshot(ctx context.Context, streamID string) (Snapshot, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return Snapshot{}, false, ErrClosed
+	}
+	snap, ok := m.snapshots[streamID]
+	return snap, ok, nil
+}
+
+func (m *memoryStore) Checkpoint(ctx context.Context, name string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return 0, ErrClosed
+	}
+	return m.checkpoints[name], nil
+}
+
+func (m *memoryStore) SaveCheckpoint(ctx context.Context, name string, position int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.checkpoints[name] = position
+	return nil
+}
+
+func (m *memoryStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	close(m.changed)
+	return nil
+}
@@ -0,0 +1,144 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/spcent/x/eventbus"
+)
+
+const defaultBatchSize = 256
+
+// Projection 把事件投影到读模型
+type Projection struct {
+	Name string // 检查点名，同名的投影共享处理进度
+	// Pattern 只处理键匹配的事件（语法同 eventbus 订阅），为空处理全部；不匹配的事件同样推进检查点
+	Pattern string
+	Handle  func(ctx context.Context, rec Record) error
+	// Reset 重建前清空读模型，可以为空
+	Reset     func(ctx context.Context) error
+	BatchSize int // 每批读取的事件数，默认 256，每批处理完提交一次检查点
+}
+
+// Runner 按全局位置顺序执行投影并记录检查点，重启后从检查点继续
+type Runner struct {
+	store Store
+	p     Projection
+
+	mu  sync.Mutex // 串行化批处理与重建
+	pos int64
+}
+
+func NewRunner(store Store, p Projection) (*Runner, error) {
+	if p.Name == "" || p.Handle == nil {
+		return nil, errors.New("eventstore: projection needs a name and a handler")
+	}
+	if p.Pattern != "" {
+		if err := eventbus.ValidatePattern(p.Pattern); err != nil {
+			return nil, err
+		}
+	}
+	if p.BatchSize <= 0 {
+		p.BatchSize = defaultBatchSize
+	}
+	pos, err := store.Checkpoint(context.Background(), p.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{store: store, p: p, pos: pos}, nil
+}
+
+// Position 已处理到的全局位置
+func (r *Runner) Position() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pos
+}
+
+// Run 持续处理新事件直到 ctx 结束或存储关闭（返回 ErrClosed）；处理器返回错误时停止并返回该错误，检查点停在出错事件之前
+func (r *Runner) Run(ctx context.Context) error {
+	for {
+		// 先取通知通道再读取，避免错过两者之间的追加
+		changed := r.store.Changed()
+		if err := r.CatchUp(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// CatchUp 处理到当前最新位置后返回
+func (r *Runner) CatchUp(ctx context.Context) error {
+	for {
+		n, err := r.step(ctx)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// step 处理一批事件，返回读到的条数
+func (r *Runner) step(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	recs, err := r.store.ReadAll(ctx, r.pos, r.p.BatchSize)
+	if err != nil || len(recs) == 0 {
+		return 0, err
+	}
+
+	done := r.pos
+	var herr error
+	for _, rec := range recs {
+		if r.p.Pattern == "" || eventbus.MatchPattern(r.p.Pattern, rec.Event.Key()) {
+			if herr = r.p.Handle(ctx, rec); herr != nil {
+				break
+			}
+		}
+		done = rec.Position
+	}
+	if done > r.pos {
+		if err := r.store.SaveCheckpoint(ctx, r.p.Name, done); err != nil {
+			return 0, err
+		}
+		r.pos = done
+	}
+	return len(recs), herr
+}
+
+// Rebuild 清空读模型并从头重放到最新位置；运行中的 Run 会在当前批次结束后从新位置继续
+func (r *Runner) Rebuild(ctx context.Context) error {
+	r.mu.Lock()
+	if r.p.Reset != nil {
+		if err := r.p.Reset(ctx); err != nil {
+			r.mu.Unlock()
+			return err
+		}
+	}
+	if err := r.store.SaveCheckpoint(ctx, r.p.Name, 0); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	r.pos = 0
+	r.mu.Unlock()
+
+	return r.CatchUp(ctx)
+}
+
+// Publisher 把存储中的事件转发到 EventBus 的投影处理器，用于让进程内订阅者响应已提交的事件
+func Publisher(bus eventbus.EventBus) func(ctx context.Context, rec Record) error {
+	return func(ctx context.Context, rec Record) error {
+		return bus.Publish(ctx, rec.Event)
+	}
+}
@@ -0,0 +1,224 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spcent/x/eventbus"
+)
+
+type account struct {
+	Balance int
+	applied int
+}
+
+func (a *account) Apply(evt eventbus.Event) error {
+	dto, err := eventbus.DecodeJSON[depositDTO](evt)
+	if err != nil {
+		return err
+	}
+	a.Balance += dto.Amount
+	a.applied++
+	return nil
+}
+
+func (a *account) Snapshot() ([]byte, error) { return json.Marshal(a.Balance) }
+func (a *account) Restore(b []byte) error    { return json.Unmarshal(b, &a.Balance) }
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	repo := &Repository{Store: store, SnapshotEvery: 3}
+
+	acc := &account{}
+	v, err := repo.Save(ctx, "acc-1", acc, NoStream, deposit(10), deposit(20))
+	if err != nil || v != 2 {
+		t.Fatalf("save v=%d err=%v", v, err)
+	}
+	if _, ok, _ := store.LoadSnapshot(ctx, "acc-1"); ok {
+		t.Fatalf("snapshot saved too early")
+	}
+	if _, err := repo.Save(ctx, "acc-1", acc, v, deposit(30), deposit(40)); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	snap, ok, _ := store.LoadSnapshot(ctx, "acc-1")
+	if !ok || snap.Version != 4 {
+		t.Fatalf("expected snapshot at version 4, got %+v", snap)
+	}
+	_, _ = store.Append(ctx, "acc-1", 4, deposit(5))
+
+	loaded := &account{}
+	v, err = repo.Load(ctx, "acc-1", loaded)
+	if err != nil || v != 5 || loaded.Balance != 105 {
+		t.Fatalf("load v=%d balance=%d err=%v", v, loaded.Balance, err)
+	}
+	if loaded.applied != 1 {
+		t.Fatalf("expected only events after snapshot to be replayed, applied=%d", loaded.applied)
+	}
+
+	if _, err := repo.Save(ctx, "acc-1", loaded, 4, deposit(1)); !errors.Is(err, ErrWrongVersion) {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+}
+
+func TestProjectionRunner(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+
+	var mu sync.Mutex
+	balances := map[string]int{}
+	p := Projection{
+		Name:    "balances",
+		Pattern: "account.*",
+		Handle: func(ctx context.Context, rec Record) error {
+			dto, _ := eventbus.DecodeJSON[depositDTO](rec.Event)
+			mu.Lock()
+			balances[rec.StreamID] += dto.Amount
+			mu.Unlock()
+			return nil
+		},
+		Reset: func(ctx context.Context) error {
+			mu.Lock()
+			balances = map[string]int{}
+			mu.Unlock()
+			return nil
+		},
+		BatchSize: 2,
+	}
+	get := func(id string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return balances[id]
+	}
+
+	for i := 1; i <= 3; i++ {
+		_, _ = store.Append(ctx, "acc-"+strconv.Itoa(i), NoStream, deposit(i*10))
+	}
+	_, _ = store.Append(ctx, "audit", NoStream, eventbus.NewJSONEvent("audit.login", nil))
+
+	r, err := NewRunner(store, p)
+	if err != nil {
+		t.Fatalf("runner: %v", err)
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- r.Run(runCtx) }()
+
+	waitFor(t, func() bool { return r.Position() == 4 })
+	_, _ = store.Append(ctx, "acc-1", 1, deposit(5))
+	waitFor(t, func() bool { return get("acc-1") == 15 })
+	cancel()
+	<-done
+
+	// 新的 Runner 从检查点继续，不重复处理
+	r2, _ := NewRunner(store, p)
+	if r2.Position() != 5 {
+		t.Fatalf("checkpoint want 5 got %d", r2.Position())
+	}
+	if err := r2.CatchUp(ctx); err != nil || get("acc-2") != 20 {
+		t.Fatalf("catch up balance=%d err=%v", get("acc-2"), err)
+	}
+
+	if err := r2.Rebuild(ctx); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if get("acc-1") != 15 || get("acc-3") != 30 || r2.Position() != 5 {
+		t.Fatalf("unexpected state after rebuild %v pos=%d", balances, r2.Position())
+	}
+}
+
+func TestProjectionHandlerError(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for i := 1; i <= 3; i++ {
+		_, _ = store.Append(ctx, "acc", AnyVersion, deposit(i))
+	}
+
+	boom := errors.New("boom")
+	r, _ := NewRunner(store, Projection{
+		Name: "fragile",
+		Handle: func(ctx context.Context, rec Record) error {
+			if rec.Position == 3 {
+				return boom
+			}
+			return nil
+		},
+	})
+	if err := r.CatchUp(ctx); !errors.Is(err, boom) {
+		t.Fatalf("expected handler error, got %v", err)
+	}
+	if pos, _ := store.Checkpoint(ctx, "fragile"); pos != 2 {
+		t.Fatalf("checkpoint should stop before failed event, got %d", pos)
+	}
+}
+
+func TestProjectionRunnerStopsOnClose(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		r, _ := NewRunner(store, Projection{
+			Name:   "idle",
+			Handle: func(ctx context.Context, rec Record) error { return nil },
+		})
+		done := make(chan error, 1)
+		go func() { done <- r.Run(context.Background()) }()
+
+		time.Sleep(20 * time.Millisecond)
+		_ = store.Close()
+		select {
+		case err := <-done:
+			if !errors.Is(err, ErrClosed) {
+				t.Fatalf("expected ErrClosed, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("runner still waiting after close")
+		}
+	})
+}
+
+func TestPublisher(t *testing.T) {
+	ctx := context.Background()
+	bus := eventbus.New()
+	defer bus.Close(ctx)
+
+	got := make(chan eventbus.Event, 1)
+	bus.SubscribeFunc("account.*", func(ctx context.Context, evt eventbus.Event) error {
+		got <- evt
+		return nil
+	}, eventbus.EventOptions{})
+
+	store := NewMemoryStore()
+	evt := deposit(7)
+	_, _ = store.Append(ctx, "acc", NoStream, evt)
+	r, _ := NewRunner(store, Projection{Name: "bus", Handle: Publisher(bus)})
+	if err := r.CatchUp(ctx); err != nil {
+		t.Fatalf("catch up: %v", err)
+	}
+	select {
+	case e := <-got:
+		if e.ID() != evt.ID() {
+			t.Fatalf("unexpected event %s", e.ID())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("event not forwarded")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for condition")
+}
@@ -0,0 +1,91 @@
+// Package eventstore 基于 eventbus.Event 的事件溯源存储：
+//   - 事件按聚合划分为流，追加时用期望版本做乐观并发控制
+//   - 读取流还原聚合，支持快照
+//   - 所有流的事件同时有一个全局位置，投影按全局位置消费并记录检查点，可以从头重建
+//
+// 提供内存实现 NewMemoryStore 与文件实现 NewFileStore。
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spcent/x/eventbus"
+)
+
+// 期望版本的特殊取值
+const (
+	AnyVersion int64 = -1 // 不检查版本
+	NoStream   int64 = 0  // 要求流不存在
+)
+
+var (
+	ErrWrongVersion = errors.New("eventstore: wrong expected version")
+	ErrClosed       = errors.New("eventstore: store closed")
+	ErrInvalidID    = errors.New("eventstore: invalid stream id")
+)
+
+// VersionError 期望版本与实际版本不一致
+type VersionError struct {
+	StreamID string
+	Expected int64
+	Actual   int64
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("eventstore: stream %q expected version %d, actual %d", e.StreamID, e.Expected, e.Actual)
+}
+
+func (e *VersionError) Unwrap() error { return ErrWrongVersion }
+
+// Record 已存储的事件
+type Record struct {
+	StreamID string
+	Version  int64 // 流内版本，从 1 开始
+	Position int64 // 全局位置，从 1 开始
+	Event    eventbus.Event
+}
+
+// Snapshot 聚合在某个版本的状态
+type Snapshot struct {
+	StreamID string
+	Version  int64
+	State    []byte
+	At       time.Time
+}
+
+// Store 事件存储
+type Store interface {
+	// Append 向流追加事件，expected 为期望的当前版本（AnyVersion 不检查，NoStream 要求流不存在），
+	// 版本不一致时返回 *VersionError；返回追加后的版本
+	Append(ctx context.Context, streamID string, expected int64, events ...eventbus.Event) (int64, error)
+	// Load 按版本顺序读取流中 version >= from 的事件，流不存在时返回空
+	Load(ctx context.Context, streamID string, from int64) ([]Record, error)
+	// Version 返回流的当前版本，流不存在时为 0
+	Version(ctx context.Context, streamID string) (int64, error)
+	// ReadAll 按全局位置读取 position > after 的事件，最多 limit 条（<=0 不限制）
+	ReadAll(ctx context.Context, after int64, limit int) ([]Record, error)
+	// Head 返回最新的全局位置
+	Head(ctx context.Context) (int64, error)
+	// Changed 返回的通道在下一次追加或存储关闭后关闭
+	Changed() <-chan struct{}
+
+	SaveSnapshot(ctx context.Context, snap Snapshot) error
+	// LoadSnapshot 返回流最新的快照，没有时 ok 为 false
+	LoadSnapshot(ctx context.Context, streamID string) (snap Snapshot, ok bool, err error)
+
+	// Checkpoint 返回投影已处理到的全局位置，没有记录时为 0
+	Checkpoint(ctx context.Context, name string) (int64, error)
+	SaveCheckpoint(ctx context.Context, name string, position int64) error
+
+	Close() error
+}
+
+func checkVersion(streamID string, expected, actual int64) error {
+	if expected == AnyVersion || expected == actual {
+		return nil
+	}
+	return &VersionError{StreamID: streamID, Expected: expected, Actual: actual}
+}
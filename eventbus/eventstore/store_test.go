@@ -0,0 +1,137 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spcent/x/eventbus"
+)
+
+type depositDTO struct {
+	Amount int `json:"amount"`
+}
+
+func deposit(n int) eventbus.Event {
+	return eventbus.NewJSONEvent("account.deposited", depositDTO{Amount: n})
+}
+
+func testStores(t *testing.T, fn func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) {
+		s := NewMemoryStore()
+		defer s.Close()
+		fn(t, s)
+	})
+	t.Run("file", func(t *testing.T) {
+		s, err := NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer s.Close()
+		fn(t, s)
+	})
+}
+
+func TestAppendLoad(t *testing.T) {
+	testStores(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		v, err := s.Append(ctx, "acc-1", NoStream, deposit(10), deposit(20))
+		if err != nil || v != 2 {
+			t.Fatalf("append v=%d err=%v", v, err)
+		}
+		if _, err := s.Append(ctx, "acc-2", NoStream, deposit(5)); err != nil {
+			t.Fatalf("append acc-2: %v", err)
+		}
+
+		// 期望版本不一致
+		_, err = s.Append(ctx, "acc-1", 1, deposit(1))
+		var ve *VersionError
+		if !errors.Is(err, ErrWrongVersion) || !errors.As(err, &ve) || ve.Actual != 2 {
+			t.Fatalf("expected version conflict, got %v", err)
+		}
+		if v, err := s.Append(ctx, "acc-1", AnyVersion, deposit(30)); err != nil || v != 3 {
+			t.Fatalf("append any v=%d err=%v", v, err)
+		}
+
+		recs, err := s.Load(ctx, "acc-1", 2)
+		if err != nil || len(recs) != 2 {
+			t.Fatalf("load %d records err=%v", len(recs), err)
+		}
+		if recs[0].Version != 2 || recs[1].Position != 4 {
+			t.Fatalf("unexpected records %+v", recs)
+		}
+		if dto, _ := eventbus.DecodeJSON[depositDTO](recs[1].Event); dto.Amount != 30 {
+			t.Fatalf("unexpected payload %+v", dto)
+		}
+
+		all, _ := s.ReadAll(ctx, 1, 2)
+		if len(all) != 2 || all[0].StreamID != "acc-1" || all[1].StreamID != "acc-2" {
+			t.Fatalf("unexpected read all %+v", all)
+		}
+		if head, _ := s.Head(ctx); head != 4 {
+			t.Fatalf("head want 4 got %d", head)
+		}
+		if recs, _ := s.Load(ctx, "missing", 1); len(recs) != 0 {
+			t.Fatalf("missing stream should be empty")
+		}
+	})
+}
+
+func TestSnapshotCheckpoint(t *testing.T) {
+	testStores(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		if _, ok, _ := s.LoadSnapshot(ctx, "acc-1"); ok {
+			t.Fatalf("unexpected snapshot")
+		}
+		_ = s.SaveSnapshot(ctx, Snapshot{StreamID: "acc-1", Version: 5, State: []byte("5")})
+		_ = s.SaveSnapshot(ctx, Snapshot{StreamID: "acc-1", Version: 3, State: []byte("3")}) // 旧快照被忽略
+		snap, ok, err := s.LoadSnapshot(ctx, "acc-1")
+		if err != nil || !ok || snap.Version != 5 || string(snap.State) != "5" {
+			t.Fatalf("unexpected snapshot %+v ok=%v err=%v", snap, ok, err)
+		}
+
+		if err := s.SaveCheckpoint(ctx, "balances/v1", 42); err != nil {
+			t.Fatalf("save checkpoint: %v", err)
+		}
+		if pos, _ := s.Checkpoint(ctx, "balances/v1"); pos != 42 {
+			t.Fatalf("checkpoint want 42 got %d", pos)
+		}
+	})
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	s, err := NewFileStore(dir, WithFsync())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, _ = s.Append(ctx, "acc-1", NoStream, deposit(1), deposit(2))
+	_, _ = s.Append(ctx, "acc-2", NoStream, deposit(3))
+	s.Close()
+
+	// 模拟写到一半崩溃
+	f, _ := os.OpenFile(filepath.Join(dir, eventsFile), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"s":"acc-1","v":3,"p":4,"k":"account.dep`)
+	f.Close()
+
+	s, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	if v, _ := s.Version(ctx, "acc-1"); v != 2 {
+		t.Fatalf("version want 2 got %d", v)
+	}
+	if v, err := s.Append(ctx, "acc-1", 2, deposit(4)); err != nil || v != 3 {
+		t.Fatalf("append after reopen v=%d err=%v", v, err)
+	}
+	recs, _ := s.Load(ctx, "acc-1", 1)
+	if len(recs) != 3 || recs[2].Position != 4 {
+		t.Fatalf("unexpected records after reopen %+v", recs)
+	}
+}
@@ -0,0 +1,139 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+)
+
+// Headers 事件元数据，如请求 ID、租户 ID、traceparent 等
+type Headers map[string]string
+
+// Get 返回 key 对应的值，h 为 nil 时返回空串
+func (h Headers) Get(key string) string {
+	return h[key]
+}
+
+// Clone 返回一份副本
+func (h Headers) Clone() Headers {
+	if h == nil {
+		return nil
+	}
+	c := make(Headers, len(h))
+	for k, v := range h {
+		c[k] = v
+	}
+	return c
+}
+
+// HeaderEvent 携带元数据的事件，BaseEvent 实现了该接口
+type HeaderEvent interface {
+	Event
+	Headers() Headers
+}
+
+// HeadersOf 返回事件的元数据，事件不携带元数据时返回 nil
+func HeadersOf(evt Event) Headers {
+	if he, ok := evt.(HeaderEvent); ok {
+		return he.Headers()
+	}
+	return nil
+}
+
+// WithHeader 返回设置了 key=value 的事件，元数据是副本，原事件不被修改
+func WithHeader(evt Event, key, value string) Event {
+	evt, h := ensureHeaders(evt)
+	h[key] = value
+	return evt
+}
+
+// headerEvent 为不支持元数据的 Event 实现附加元数据
+type headerEvent struct {
+	Event
+	headers Headers
+}
+
+func (e *headerEvent) Headers() Headers { return e.headers }
+
+// ensureHeaders 包装事件并返回其元数据的副本，调用方持有的事件（可能已被发布或复用）不受影响
+func ensureHeaders(evt Event) (Event, Headers) {
+	h := HeadersOf(evt).Clone()
+	if h == nil {
+		h = Headers{}
+	}
+	if e, ok := evt.(*headerEvent); ok {
+		evt = e.Event
+	}
+	return &headerEvent{Event: evt, headers: h}, h
+}
+
+// ContextPropagator 在发布时把 ctx 中的值写入元数据，在异步投递时再从元数据恢复到处理器的 ctx
+type ContextPropagator interface {
+	Inject(ctx context.Context, h Headers)
+	Extract(ctx context.Context, h Headers) context.Context
+}
+
+// WithPropagator 追加上下文传播器
+func WithPropagator(ps ...ContextPropagator) BusOption {
+	return func(b *bus) { b.propagators = append(b.propagators, ps...) }
+}
+
+// ContextValue 传播 ctx 中以 key 存放的字符串值，例如请求 ID、租户 ID
+func ContextValue(header string, key any) ContextPropagator {
+	return ctxValuePropagator{header: header, key: key}
+}
+
+type ctxValuePropagator struct {
+	header string
+	key    any
+}
+
+func (p ctxValuePropagator) Inject(ctx context.Context, h Headers) {
+	if v := ctx.Value(p.key); v != nil {
+		h[p.header] = fmt.Sprint(v)
+	}
+}
+
+func (p ctxValuePropagator) Extract(ctx context.Context, h Headers) context.Context {
+	if v, ok := h[p.header]; ok {
+		return context.WithValue(ctx, p.key, v)
+	}
+	return ctx
+}
+
+// inject 在发布时采集上下文，显式设置的元数据优先
+func (b *bus) inject(ctx context.Context, evt Event) Event {
+	if len(b.propagators) == 0 {
+		return evt
+	}
+
+	captured := Headers{}
+	for _, p := range b.propagators {
+		p.Inject(ctx, captured)
+	}
+	if len(captured) == 0 {
+		return evt
+	}
+
+	evt, h := ensureHeaders(evt)
+	for k, v := range captured {
+		if _, ok := h[k]; !ok {
+			h[k] = v
+		}
+	}
+	return evt
+}
+
+// deliveryContext 为异步投递构建处理器的 ctx
+func (b *bus) deliveryContext(ctx context.Context, evt Event) context.Context {
+	if len(b.propagators) == 0 {
+		return ctx
+	}
+	h := HeadersOf(evt)
+	if h == nil {
+		return ctx
+	}
+	for _, p := range b.propagators {
+		ctx = p.Extract(ctx, h)
+	}
+	return ctx
+}
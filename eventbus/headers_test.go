@@ -0,0 +1,140 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type requestIDKey struct{}
+
+func TestHeadersPropagateToAsyncHandler(t *testing.T) {
+	b := New(WithPropagator(ContextValue("x-request-id", requestIDKey{}), TracePropagator()))
+	defer b.Close(context.Background())
+
+	type seen struct {
+		reqID  any
+		tc     TraceContext
+		tenant string
+	}
+	ch := make(chan seen, 1)
+	b.SubscribeFunc("order.created", func(ctx context.Context, evt Event) error {
+		tc, _ := TraceFromContext(ctx)
+		ch <- seen{reqID: ctx.Value(requestIDKey{}), tc: tc, tenant: HeadersOf(evt).Get("x-tenant")}
+		return nil
+	}, EventOptions{Async: true})
+
+	root := NewTraceContext(true)
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-1")
+	ctx = ContextWithTrace(ctx, root)
+
+	evt := NewJSONEvent("order.created", shippedDTO{OrderID: 1}).(*BaseEvent)
+	evt.SetHeader("x-tenant", "acme")
+	if err := b.Publish(ctx, evt); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	select {
+	case s := <-ch:
+		if s.reqID != "req-1" {
+			t.Fatalf("request id not restored: %v", s.reqID)
+		}
+		if s.tc.TraceID != root.TraceID || s.tc.SpanID != root.SpanID || !s.tc.Sampled() {
+			t.Fatalf("trace not restored: %+v want %+v", s.tc, root)
+		}
+		if s.tenant != "acme" {
+			t.Fatalf("explicit header lost: %q", s.tenant)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("handler not called")
+	}
+	if evt.Header(HeaderTraceParent) != "" || len(evt.Headers()) != 1 {
+		t.Fatalf("published event was modified: %v", evt.Headers())
+	}
+}
+
+func TestWithHeaderWrapsForeignEvent(t *testing.T) {
+	evt := WithHeader(&renamedEvent{Event: mustNewEvt(t, "a", 1, 1), key: "b"}, "k", "v")
+	if evt.Key() != "b" || HeadersOf(evt).Get("k") != "v" {
+		t.Fatalf("wrapped event lost data: key=%s headers=%v", evt.Key(), HeadersOf(evt))
+	}
+}
+
+func TestWithHeaderCopies(t *testing.T) {
+	evt := mustNewEvt(t, "a", 1, 1).(*BaseEvent)
+	evt.SetHeader("k", "v")
+	next := WithHeader(evt, "k", "w")
+	if evt.Header("k") != "v" || HeadersOf(next).Get("k") != "w" {
+		t.Fatalf("expected a copy, got %v and %v", evt.Headers(), HeadersOf(next))
+	}
+	again := WithHeader(next, "x", "y")
+	if _, nested := again.(*headerEvent).Event.(*headerEvent); nested || HeadersOf(next).Get("x") != "" {
+		t.Fatalf("expected a flat copy, got %#v", again)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		in    string
+		valid bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"garbage", false},
+	}
+	for _, tt := range tests {
+		tc, err := ParseTraceParent(tt.in)
+		if (err == nil) != tt.valid {
+			t.Fatalf("ParseTraceParent(%q) err=%v want valid=%v", tt.in, err, tt.valid)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidTraceParent) {
+			t.Fatalf("unexpected error type %v", err)
+		}
+		if tt.valid && tt.in[:2] == "00" && tc.TraceParent() != tt.in {
+			t.Fatalf("round trip %q != %q", tc.TraceParent(), tt.in)
+		}
+	}
+}
+
+func TestHandlerDeadlineFromOptions(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+
+	b.SubscribeFunc("slow", func(ctx context.Context, evt Event) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, EventOptions{Timeout: 20 * time.Millisecond})
+
+	err := b.Publish(context.Background(), mustNewEvt(t, "slow", 0, 0))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestDurableKeepsHeaders(t *testing.T) {
+	b := New(WithWAL(t.TempDir()), WithPropagator(ContextValue("x-request-id", requestIDKey{})))
+	defer b.Close(context.Background())
+
+	ch := make(chan any, 1)
+	b.SubscribeFunc("pay.done", func(ctx context.Context, evt Event) error {
+		ch <- ctx.Value(requestIDKey{})
+		return nil
+	}, EventOptions{Durable: "ledger"})
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-9")
+	_ = b.Publish(ctx, mustNewEvt(t, "pay.done", 1, 1))
+	select {
+	case v := <-ch:
+		if v != "req-9" {
+			t.Fatalf("request id not restored from wal: %v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("durable handler not called")
+	}
+}
@@ -0,0 +1,284 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrBusClosed 总线已关闭或正在排空，不再接受发布
+	ErrBusClosed = errors.New("eventbus: bus closed")
+
+	errCloseTimeout = errors.New("event bus close timeout")
+)
+
+const maxIdlePoll = 5 * time.Millisecond
+
+// Lifecycle 排空关闭与订阅暂停，内置的 EventBus 实现都支持
+type Lifecycle interface {
+	// Drain 停止接受发布（返回 ErrBusClosed），在 ctx 截止前处理完全局队列和所有订阅缓冲后关闭总线；
+	// 超时时仍未处理的事件在报告中返回。已暂停订阅的缓冲不会等待，直接计入报告
+	Drain(ctx context.Context) (DrainReport, error)
+	// Flush 等待全局队列和所有未暂停订阅的缓冲处理完，不影响发布；持久订阅只等待执行中的处理器
+	Flush(ctx context.Context) error
+	// Pause 暂停异步或持久订阅，期间事件留在缓冲（持久订阅留在 WAL，Redis 留在流中）；
+	// 缓冲满后按 DropPolicy 处理。同步订阅无法暂停，返回 false
+	Pause(subID string) bool
+	// Resume 恢复被暂停的订阅
+	Resume(subID string) bool
+}
+
+// DrainReport 排空关闭的结果
+type DrainReport struct {
+	Abandoned []AbandonedEvent // 未能处理的事件
+	Scheduled []ScheduledEvent // 被丢弃的定时事件，取决于 ScheduleClosePolicy
+	InFlight  int              // 截止时仍在执行的处理器数
+}
+
+// AbandonedEvent 关闭时仍在队列或缓冲中的事件
+type AbandonedEvent struct {
+	SubID   string
+	Pattern string
+	Event   Event
+}
+
+func (b *bus) beginPublish() error {
+	b.gate.Lock()
+	defer b.gate.Unlock()
+	if b.closing {
+		return ErrBusClosed
+	}
+	b.publishing++
+	return nil
+}
+
+func (b *bus) endPublish() {
+	b.gate.Lock()
+	defer b.gate.Unlock()
+	b.publishing--
+	if b.closing && b.publishing == 0 {
+		close(b.idle)
+	}
+}
+
+// stopAccepting 拒绝后续发布，返回的通道在进行中的 Publish 全部返回后关闭
+func (b *bus) stopAccepting() <-chan struct{} {
+	b.gate.Lock()
+	defer b.gate.Unlock()
+	if !b.closing {
+		b.closing = true
+		b.idle = make(chan struct{})
+		if b.publishing == 0 {
+			close(b.idle)
+		}
+	}
+	return b.idle
+}
+
+// dropped 订阅缓冲丢弃了一条事件
+func (b *bus) dropped(s *subscriber) {
+	s.pending.Add(-1)
+	b.recordDropped(s)
+}
+
+func (s *subscriber) pause() {
+	s.pmu.Lock()
+	defer s.pmu.Unlock()
+	if s.resume == nil {
+		s.resume = make(chan struct{})
+	}
+}
+
+func (s *subscriber) unpause() {
+	s.pmu.Lock()
+	defer s.pmu.Unlock()
+	if s.resume != nil {
+		close(s.resume)
+		s.resume = nil
+	}
+}
+
+func (s *subscriber) paused() bool {
+	s.pmu.Lock()
+	defer s.pmu.Unlock()
+	return s.resume != nil
+}
+
+// waitResumed 暂停时阻塞到恢复；订阅取消或 done 关闭时返回 false
+func (s *subscriber) waitResumed(done <-chan struct{}) bool {
+	for {
+		s.pmu.Lock()
+		ch := s.resume
+		s.pmu.Unlock()
+		if ch == nil {
+			return true
+		}
+		select {
+		case <-ch:
+		case <-s.closed:
+			return false
+		case <-done:
+			return false
+		}
+	}
+}
+
+// hold 记录处理协程退出时手中未处理的事件
+func (s *subscriber) hold(j job) {
+	s.pmu.Lock()
+	s.held = append(s.held, j)
+	s.pmu.Unlock()
+}
+
+func (b *bus) Pause(subID string) bool {
+	b.mu.RLock()
+	s, ok := b.subs[subID]
+	b.mu.RUnlock()
+	if !ok || !s.opt.Async {
+		return false
+	}
+	s.pause()
+	return true
+}
+
+func (b *bus) Resume(subID string) bool {
+	b.mu.RLock()
+	s, ok := b.subs[subID]
+	b.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	s.unpause()
+	return true
+}
+
+func (b *bus) Drain(ctx context.Context) (DrainReport, error) {
+	rep := DrainReport{Scheduled: b.sched.stop(b.schedulePolicy)}
+	err := b.waitDrained(ctx, b.stopAccepting())
+
+	b.cancel()
+	b.aw.close()
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		if b.wal != nil {
+			b.wal.close()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = errCloseTimeout
+	}
+
+	rep.Abandoned, rep.InFlight = b.abandoned()
+	return rep, err
+}
+
+func (b *bus) Flush(ctx context.Context) error {
+	d := 50 * time.Microsecond
+	for !b.drained() {
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+		if d *= 2; d > maxIdlePoll {
+			d = maxIdlePoll
+		}
+	}
+	return nil
+}
+
+// waitDrained 等待进行中的发布返回、全局队列清空、未暂停订阅的缓冲处理完
+func (b *bus) waitDrained(ctx context.Context, idle <-chan struct{}) error {
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		return errCloseTimeout
+	}
+	if b.Flush(ctx) != nil {
+		return errCloseTimeout
+	}
+	return nil
+}
+
+func (b *bus) drained() bool {
+	if !b.aw.idle() {
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, s := range b.subs {
+		if s.paused() {
+			continue
+		}
+		if s.pending.Load() > 0 || s.stats.inFlight.Load() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// abandoned 收集全局队列、订阅缓冲和处理协程手中剩余的事件
+func (b *bus) abandoned() ([]AbandonedEvent, int) {
+	var res []AbandonedEvent
+	add := func(s *subscriber, j job) {
+		res = append(res, AbandonedEvent{SubID: s.id, Pattern: s.pattern, Event: j.evt})
+	}
+	collect := func(s *subscriber, ch chan job) {
+		for {
+			select {
+			case j := <-ch:
+				add(s, j)
+			default:
+				return
+			}
+		}
+	}
+
+	for _, j := range b.aw.drain() {
+		for _, s := range b.snapshot(j.evt.Key()) {
+			if s.opt.Async && !s.durable && !s.ordered() {
+				add(s, j)
+			}
+		}
+	}
+
+	b.mu.RLock()
+	subs := make([]*subscriber, 0, len(b.subs))
+	for _, s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.RUnlock()
+
+	for _, s := range subs {
+		s.pmu.Lock()
+		held := s.held
+		s.held = nil
+		s.pmu.Unlock()
+		for _, j := range held {
+			add(s, j)
+		}
+		collect(s, s.ch)
+		for _, p := range s.parts {
+			collect(s, p)
+		}
+	}
+	return res, b.inFlight()
+}
+
+// inFlight 所有订阅正在执行的处理器数
+func (b *bus) inFlight() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	n := 0
+	for _, s := range b.subs {
+		n += int(s.stats.inFlight.Load())
+	}
+	return n
+}
@@ -0,0 +1,126 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrainFlushesBuffers(t *testing.T) {
+	b := New()
+
+	var handled int32
+	b.SubscribeFunc("job.*", func(ctx context.Context, evt Event) error {
+		time.Sleep(2 * time.Millisecond)
+		atomic.AddInt32(&handled, 1)
+		return nil
+	}, EventOptions{Async: true, Buffer: 64})
+
+	for i := 0; i < 20; i++ {
+		if err := b.Publish(context.Background(), mustNewEvt(t, "job.run", i, i)); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	rep, err := b.(Lifecycle).Drain(ctx)
+	if err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if n := atomic.LoadInt32(&handled); n != 20 || len(rep.Abandoned) != 0 || rep.InFlight != 0 {
+		t.Fatalf("handled=%d report=%+v", n, rep)
+	}
+	if err := b.Publish(context.Background(), mustNewEvt(t, "job.run", 0, 0)); !errors.Is(err, ErrBusClosed) {
+		t.Fatalf("expected ErrBusClosed after drain, got %v", err)
+	}
+}
+
+func TestDrainReportsAbandoned(t *testing.T) {
+	b := New()
+
+	release := make(chan struct{})
+	defer close(release)
+	subID := b.SubscribeFunc("job.*", func(ctx context.Context, evt Event) error {
+		<-release
+		return nil
+	}, EventOptions{Async: true, Buffer: 8})
+
+	for i := 0; i < 4; i++ {
+		_ = b.Publish(context.Background(), mustNewEvt(t, "job.run", i, i))
+	}
+	waitUntil(t, time.Second, func() bool {
+		st := b.(Inspector).Stats()
+		return len(st.Subscriptions) == 1 && st.Subscriptions[0].InFlight == 1 && st.Subscriptions[0].Buffered == 3
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rep, err := b.(Lifecycle).Drain(ctx)
+	if err == nil {
+		t.Fatalf("expected drain timeout")
+	}
+	if len(rep.Abandoned) != 3 || rep.InFlight != 1 {
+		t.Fatalf("unexpected report abandoned=%d inflight=%d", len(rep.Abandoned), rep.InFlight)
+	}
+	for _, a := range rep.Abandoned {
+		if a.SubID != subID || a.Pattern != "job.*" {
+			t.Fatalf("unexpected abandoned entry %+v", a)
+		}
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	b := New()
+	lc := b.(Lifecycle)
+
+	var handled int32
+	subID := b.SubscribeFunc("mail.*", func(ctx context.Context, evt Event) error {
+		atomic.AddInt32(&handled, 1)
+		return nil
+	}, EventOptions{Async: true})
+	syncID := b.SubscribeFunc("mail.*", func(ctx context.Context, evt Event) error { return nil }, EventOptions{})
+
+	if lc.Pause(syncID) {
+		t.Fatalf("sync subscriptions cannot be paused")
+	}
+	if !lc.Pause(subID) {
+		t.Fatalf("pause failed")
+	}
+	for i := 0; i < 3; i++ {
+		_ = b.Publish(context.Background(), mustNewEvt(t, "mail.send", i, i))
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := atomic.LoadInt32(&handled); n != 0 {
+		t.Fatalf("paused subscription handled %d events", n)
+	}
+	for _, s := range b.(Inspector).Stats().Subscriptions {
+		if s.ID == subID && (!s.Paused || s.Buffered != 3) {
+			t.Fatalf("unexpected paused stats %+v", s)
+		}
+	}
+
+	lc.Resume(subID)
+	waitUntil(t, time.Second, func() bool { return atomic.LoadInt32(&handled) == 3 })
+
+	// 暂停的订阅在排空时不等待，缓冲直接上报
+	lc.Pause(subID)
+	_ = b.Publish(context.Background(), mustNewEvt(t, "mail.send", 9, 9))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	rep, err := lc.Drain(ctx)
+	if err != nil || len(rep.Abandoned) != 1 || rep.Abandoned[0].SubID != subID {
+		t.Fatalf("unexpected drain report %+v err=%v", rep, err)
+	}
+}
+
+func TestPublishAfterClose(t *testing.T) {
+	b := New()
+	_ = b.Close(context.Background())
+	if err := b.Publish(context.Background(), mustNewEvt(t, "a", 1, 1)); !errors.Is(err, ErrBusClosed) {
+		t.Fatalf("expected ErrBusClosed, got %v", err)
+	}
+}
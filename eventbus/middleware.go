@@ -0,0 +1,64 @@
+package eventbus
+
+import (
+	"context"
+	"time"
+)
+
+// PublishFunc 发布函数，Publish 经过拦截器链后最终调用它完成分发
+type PublishFunc func(ctx context.Context, evt Event) error
+
+// PublishInterceptor 发布拦截器，在分发前执行；可以替换事件（补充信息）或返回错误拒绝发布
+type PublishInterceptor func(next PublishFunc) PublishFunc
+
+// SubscriptionInfo 订阅的描述信息
+type SubscriptionInfo struct {
+	ID      string
+	Pattern string
+	Options EventOptions
+}
+
+// HandlerInterceptor 处理器拦截器，包裹每一次处理器调用（同步、异步、持久、重试均经过）
+type HandlerInterceptor func(info SubscriptionInfo, next EventFunc) EventFunc
+
+// WithPublishInterceptor 追加发布拦截器，先注册的在最外层
+func WithPublishInterceptor(ics ...PublishInterceptor) BusOption {
+	return func(b *bus) { b.publishInterceptors = append(b.publishInterceptors, ics...) }
+}
+
+// WithHandlerInterceptor 追加处理器拦截器，先注册的在最外层
+func WithHandlerInterceptor(ics ...HandlerInterceptor) BusOption {
+	return func(b *bus) { b.handlerInterceptors = append(b.handlerInterceptors, ics...) }
+}
+
+// HandlerTimeout 为每次处理器调用设置超时
+func HandlerTimeout(d time.Duration) HandlerInterceptor {
+	return func(info SubscriptionInfo, next EventFunc) EventFunc {
+		return func(ctx context.Context, evt Event) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next(ctx, evt)
+		}
+	}
+}
+
+func (s *subscriber) info() SubscriptionInfo {
+	return SubscriptionInfo{ID: s.id, Pattern: s.pattern, Options: s.opt}
+}
+
+func (b *bus) chainHandler(s *subscriber) EventFunc {
+	fn := s.fn
+	info := s.info()
+	for i := len(b.handlerInterceptors) - 1; i >= 0; i-- {
+		fn = b.handlerInterceptors[i](info, fn)
+	}
+	return fn
+}
+
+func (b *bus) chainPublish(final PublishFunc) PublishFunc {
+	fn := final
+	for i := len(b.publishInterceptors) - 1; i >= 0; i-- {
+		fn = b.publishInterceptors[i](fn)
+	}
+	return fn
+}
@@ -0,0 +1,100 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// renamedEvent 用于在发布拦截器中改写事件
+type renamedEvent struct {
+	Event
+	key string
+}
+
+func (e *renamedEvent) Key() string { return e.key }
+
+func TestPublishInterceptor(t *testing.T) {
+	errForbidden := errors.New("forbidden")
+	var order []string
+	var mu sync.Mutex
+	trace := func(name string) PublishInterceptor {
+		return func(next PublishFunc) PublishFunc {
+			return func(ctx context.Context, evt Event) error {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+				return next(ctx, evt)
+			}
+		}
+	}
+	reject := func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, evt Event) error {
+			if strings.HasPrefix(evt.Key(), "admin.") {
+				return errForbidden
+			}
+			// 统一加上租户前缀
+			return next(ctx, &renamedEvent{Event: evt, key: "tenant1." + evt.Key()})
+		}
+	}
+
+	b := New(WithPublishInterceptor(trace("outer"), trace("inner"), reject))
+	defer b.Close(context.Background())
+
+	var got string
+	b.SubscribeFunc("tenant1.#", func(ctx context.Context, evt Event) error {
+		got = evt.Key()
+		return nil
+	}, EventOptions{})
+
+	if err := b.Publish(context.Background(), mustNewEvt(t, "admin.reset", 0, 0)); !errors.Is(err, errForbidden) {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+	if err := b.Publish(context.Background(), mustNewEvt(t, "order.created", 1, 1)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if got != "tenant1.order.created" {
+		t.Fatalf("event not enriched, got key %q", got)
+	}
+	if len(order) != 4 || order[0] != "outer" || order[1] != "inner" {
+		t.Fatalf("interceptor order wrong: %v", order)
+	}
+}
+
+func TestHandlerInterceptor(t *testing.T) {
+	var calls int32
+	var patterns sync.Map
+	count := func(info SubscriptionInfo, next EventFunc) EventFunc {
+		return func(ctx context.Context, evt Event) error {
+			atomic.AddInt32(&calls, 1)
+			patterns.Store(info.Pattern, info.Options.Async)
+			return next(ctx, evt)
+		}
+	}
+
+	b := New(WithHandlerInterceptor(count, HandlerTimeout(time.Second)))
+	defer b.Close(context.Background())
+
+	var deadline int32
+	h := func(ctx context.Context, evt Event) error {
+		if _, ok := ctx.Deadline(); ok {
+			atomic.AddInt32(&deadline, 1)
+		}
+		return nil
+	}
+	b.SubscribeFunc("order.created", h, EventOptions{})
+	b.SubscribeFunc("order.*", h, EventOptions{Async: true})
+
+	_ = b.Publish(context.Background(), mustNewEvt(t, "order.created", 1, 1))
+	waitUntil(t, time.Second, func() bool {
+		return atomic.LoadInt32(&calls) == 2 && atomic.LoadInt32(&deadline) == 2
+	})
+
+	if v, ok := patterns.Load("order.*"); !ok || v != true {
+		t.Fatalf("async subscription info not passed")
+	}
+}
@@ -0,0 +1,585 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisFieldKey     = "key"
+	redisFieldID      = "id"
+	redisFieldAt      = "at"
+	redisFieldPayload = "payload"
+	redisHeaderPrefix = "h:"
+	redisGroupPrefix  = "eventbus:"
+	// 临时订阅的消费组名 eventbus:ephemeral:<subID>，Durable 名字不能以 ephemeral: 开头
+	redisEphemeral        = "ephemeral:"
+	defaultRedisMaxLen    = 100000
+	defaultRedisGroupIdle = time.Hour
+)
+
+// RedisConfig Redis Streams 传输的配置
+type RedisConfig struct {
+	Stream        string        // 事件流名，默认 "eventbus"
+	Consumer      string        // 本实例在消费组中的名字，默认 hostname-uuid；固定名字可在重启后先处理自己未确认的消息
+	MaxLen        int64         // 流的近似最大长度（XADD MAXLEN ~），默认 100000，负数表示不裁剪
+	Count         int64         // 每次 XREADGROUP 读取的条数，默认 16
+	Block         time.Duration // XREADGROUP 阻塞时长，默认 1s
+	ClaimIdle     time.Duration // 未确认消息空闲多久后被其他消费者认领（XAUTOCLAIM），默认 30s
+	ClaimInterval time.Duration // 认领检查间隔，默认 ClaimIdle/2
+	// GroupIdle 每个实例每 GroupIdle/2 为自己的临时消费组在 <Stream>:heartbeats 哈希中写入心跳，
+	// 心跳超过 GroupIdle 的临时组视为进程崩溃后遗留的组并删除，默认 1h，负数表示不清理
+	GroupIdle time.Duration
+}
+
+func (c *RedisConfig) setDefaults() {
+	if c.Stream == "" {
+		c.Stream = "eventbus"
+	}
+	if c.Consumer == "" {
+		host, _ := os.Hostname()
+		c.Consumer = host + "-" + uuid.NewString()
+	}
+	if c.MaxLen == 0 {
+		c.MaxLen = defaultRedisMaxLen
+	}
+	if c.GroupIdle == 0 {
+		c.GroupIdle = defaultRedisGroupIdle
+	}
+	if c.Count <= 0 {
+		c.Count = 16
+	}
+	if c.Block <= 0 {
+		c.Block = time.Second
+	}
+	if c.ClaimIdle <= 0 {
+		c.ClaimIdle = 30 * time.Second
+	}
+	if c.ClaimInterval <= 0 {
+		c.ClaimInterval = c.ClaimIdle / 2
+	}
+}
+
+// redisBus 基于 Redis Streams 的跨进程 EventBus：
+//   - 所有事件 XADD 到同一个流，订阅按模式在客户端过滤
+//   - 每个订阅对应一个消费组：设置了 EventOptions.Durable 时以该名字为组名，多个副本竞争消费；
+//     否则为每个订阅建立临时组（广播语义），取消订阅或关闭时删除；崩溃遗留的临时组按 GroupIdle 清理
+//   - 处理完成后 XACK；崩溃的消费者留下的未确认消息由 XAUTOCLAIM 认领后重新投递
+//
+// 跨进程时所有处理器都是异步调用的；Retry、DeadLetter、Once 与进程内语义一致，
+// Buffer、DropPolicy、Priority 由 Redis 负责缓冲，不再生效。
+type redisBus struct {
+	*bus
+	client redis.UniversalClient
+	cfg    RedisConfig
+
+	rmu     sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// NewRedisBus 创建基于 Redis Streams 的 EventBus，opts 中与 WAL、worker 相关的选项会被忽略
+func NewRedisBus(client redis.UniversalClient, cfg RedisConfig, opts ...BusOption) EventBus {
+	cfg.setDefaults()
+	rb := &redisBus{
+		bus:     newBus(opts...),
+		client:  client,
+		cfg:     cfg,
+		cancels: make(map[string]context.CancelFunc),
+	}
+	rb.publishFn = rb.chainPublish(rb.publish)
+	// 定时事件只保存在本进程内存中，到期后再写入流
+	rb.sched = newScheduler(rb.publishScheduled, "")
+	if cfg.GroupIdle > 0 {
+		rb.wg.Add(1)
+		go rb.sweepGroups()
+	}
+	return rb
+}
+
+func (rb *redisBus) SubscribeFunc(pattern string, h EventFunc, opt EventOptions) (subID string) {
+	return rb.subscribe(pattern, h, opt)
+}
+
+func (rb *redisBus) Subscribe(pattern string, h EventHandle, opt EventOptions) (subID string) {
+	fn := func(ctx context.Context, evt Event) error {
+		return h.Handle(ctx, evt)
+	}
+	return rb.subscribe(pattern, fn, opt)
+}
+
+func (rb *redisBus) subscribe(pattern string, fn EventFunc, opt EventOptions) (subID string) {
+	if err := ValidatePattern(pattern); err != nil {
+		log.Printf("[eventbus] subscribe rejected: %v", err)
+		return ""
+	}
+	if strings.HasPrefix(opt.Durable, redisEphemeral) {
+		log.Printf("[eventbus] subscribe rejected: durable name %q is reserved", opt.Durable)
+		return ""
+	}
+
+	opt.Async = true
+	sub := &subscriber{
+		id:      uuid.NewString(),
+		pattern: pattern,
+		fn:      fn,
+		opt:     opt,
+		closed:  make(chan struct{}),
+		stats:   newStats(),
+	}
+	sub.fn = rb.chainHandler(sub)
+
+	group := rb.group(sub)
+	err := rb.client.XGroupCreateMkStream(rb.ctx, rb.cfg.Stream, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.Printf("[eventbus] redis create group stream=%s group=%s err=%v", rb.cfg.Stream, group, err)
+		return ""
+	}
+
+	ctx, cancel := context.WithCancel(rb.ctx)
+	rb.rmu.Lock()
+	rb.cancels[sub.id] = cancel
+	rb.rmu.Unlock()
+
+	rb.mu.Lock()
+	rb.subs[sub.id] = sub
+	rb.mu.Unlock()
+	if opt.Durable == "" {
+		rb.heartbeat(group)
+	}
+
+	rb.wg.Add(1)
+	go rb.consume(ctx, sub, group)
+	return sub.id
+}
+
+func (rb *redisBus) group(s *subscriber) string {
+	if s.opt.Durable != "" {
+		return redisGroupPrefix + s.opt.Durable
+	}
+	return redisGroupPrefix + redisEphemeral + s.id
+}
+
+// ephemeralGroup 判断消费组是否属于临时订阅
+func ephemeralGroup(group string) bool {
+	return strings.HasPrefix(group, redisGroupPrefix+redisEphemeral)
+}
+
+// sweepGroups 定期为本实例的临时组写入心跳，并删除心跳超过 GroupIdle 的临时组（进程崩溃后遗留）
+func (rb *redisBus) sweepGroups() {
+	defer rb.wg.Done()
+
+	missing := map[string]bool{}
+	t := time.NewTicker(rb.cfg.GroupIdle / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-rb.ctx.Done():
+			return
+		case <-t.C:
+		}
+		rb.heartbeat(rb.localGroups()...)
+		missing = rb.sweep(missing)
+	}
+}
+
+// heartbeatKey 记录临时组最近一次心跳（Unix 毫秒）的哈希
+func (rb *redisBus) heartbeatKey() string {
+	return rb.cfg.Stream + ":heartbeats"
+}
+
+func (rb *redisBus) heartbeat(groups ...string) {
+	if len(groups) == 0 || rb.cfg.GroupIdle <= 0 {
+		return
+	}
+	now := time.Now().UnixMilli()
+	values := make([]any, 0, 2*len(groups))
+	for _, g := range groups {
+		values = append(values, g, now)
+	}
+	if err := rb.client.HSet(rb.ctx, rb.heartbeatKey(), values...).Err(); err != nil && rb.ctx.Err() == nil {
+		log.Printf("[eventbus] redis heartbeat stream=%s err=%v", rb.cfg.Stream, err)
+	}
+}
+
+// localGroups 返回本实例临时订阅的消费组
+func (rb *redisBus) localGroups() []string {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	groups := make([]string, 0, len(rb.subs))
+	for _, s := range rb.subs {
+		if s.opt.Durable == "" {
+			groups = append(groups, rb.group(s))
+		}
+	}
+	return groups
+}
+
+// sweep 检查一次所有临时组，返回本次没有心跳的组；没有心跳的组（旧版本创建的，或刚创建还没写入心跳的）
+// 连续两次检查都没有心跳才删除
+func (rb *redisBus) sweep(wasMissing map[string]bool) map[string]bool {
+	groups, err := rb.client.XInfoGroups(rb.ctx, rb.cfg.Stream).Result()
+	if err != nil {
+		if rb.ctx.Err() == nil && !strings.Contains(err.Error(), "no such key") {
+			log.Printf("[eventbus] redis list groups stream=%s err=%v", rb.cfg.Stream, err)
+		}
+		return wasMissing
+	}
+	beats, err := rb.client.HGetAll(rb.ctx, rb.heartbeatKey()).Result()
+	if err != nil {
+		if rb.ctx.Err() == nil {
+			log.Printf("[eventbus] redis read heartbeats stream=%s err=%v", rb.cfg.Stream, err)
+		}
+		return wasMissing
+	}
+
+	local := map[string]bool{}
+	for _, g := range rb.localGroups() {
+		local[g] = true
+	}
+	missing := map[string]bool{}
+	exists := map[string]bool{}
+	for _, g := range groups {
+		exists[g.Name] = true
+		if !ephemeralGroup(g.Name) || local[g.Name] {
+			continue
+		}
+		beat, ok := beats[g.Name]
+		if !ok && !wasMissing[g.Name] {
+			missing[g.Name] = true
+			continue
+		}
+		if ms, err := strconv.ParseInt(beat, 10, 64); ok && err == nil && time.Since(time.UnixMilli(ms)) < rb.cfg.GroupIdle {
+			continue
+		}
+		if err := rb.client.XGroupDestroy(rb.ctx, rb.cfg.Stream, g.Name).Err(); err != nil {
+			log.Printf("[eventbus] redis destroy idle group stream=%s group=%s err=%v", rb.cfg.Stream, g.Name, err)
+			continue
+		}
+		delete(exists, g.Name)
+		log.Printf("[eventbus] redis destroyed idle group stream=%s group=%s", rb.cfg.Stream, g.Name)
+	}
+
+	// 清理已不存在的组的心跳
+	var stale []string
+	for g := range beats {
+		if !exists[g] && !local[g] {
+			stale = append(stale, g)
+		}
+	}
+	if len(stale) > 0 {
+		rb.client.HDel(rb.ctx, rb.heartbeatKey(), stale...)
+	}
+	return missing
+}
+
+func (rb *redisBus) Unsubscribe(subID string) bool {
+	rb.mu.Lock()
+	sub, ok := rb.subs[subID]
+	if ok {
+		delete(rb.subs, subID)
+	}
+	rb.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	close(sub.closed)
+	rb.rmu.Lock()
+	if cancel, ok := rb.cancels[subID]; ok {
+		cancel()
+		delete(rb.cancels, subID)
+	}
+	rb.rmu.Unlock()
+
+	if sub.opt.Durable == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), rb.cfg.Block)
+		defer cancel()
+		if err := rb.client.XGroupDestroy(ctx, rb.cfg.Stream, rb.group(sub)).Err(); err != nil {
+			log.Printf("[eventbus] redis destroy group stream=%s group=%s err=%v", rb.cfg.Stream, rb.group(sub), err)
+		}
+		if rb.cfg.GroupIdle > 0 {
+			rb.client.HDel(ctx, rb.heartbeatKey(), rb.group(sub))
+		}
+	}
+	return true
+}
+
+// DeleteDurable 删除持久订阅 name 的消费组，未确认的消息一并丢弃
+func (rb *redisBus) DeleteDurable(name string) error {
+	rb.mu.RLock()
+	for _, s := range rb.subs {
+		if s.opt.Durable == name {
+			rb.mu.RUnlock()
+			return fmt.Errorf("%w: %s by sub=%s", ErrDurableInUse, name, s.id)
+		}
+	}
+	rb.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), rb.cfg.Block)
+	defer cancel()
+	return rb.client.XGroupDestroy(ctx, rb.cfg.Stream, redisGroupPrefix+name).Err()
+}
+
+func (rb *redisBus) Publish(ctx context.Context, evt Event) error {
+	if evt == nil {
+		return nil
+	}
+	if err := rb.beginPublish(); err != nil {
+		return err
+	}
+	defer rb.endPublish()
+
+	if err := rb.publishFn(ctx, evt); err != nil {
+		return err
+	}
+	rb.published.Add(1)
+	return nil
+}
+
+func (rb *redisBus) publish(ctx context.Context, evt Event) error {
+	if evt == nil {
+		return nil
+	}
+	evt = rb.inject(ctx, evt)
+
+	args := &redis.XAddArgs{
+		Stream: rb.cfg.Stream,
+		Values: encodeRedisEvent(evt),
+	}
+	if rb.cfg.MaxLen > 0 {
+		args.MaxLen = rb.cfg.MaxLen
+		args.Approx = true
+	}
+	return rb.client.XAdd(ctx, args).Err()
+}
+
+func (rb *redisBus) Close(ctx context.Context) error {
+	rb.stopScheduler()
+	rb.stopAccepting()
+	rb.mu.RLock()
+	ids := make([]string, 0, len(rb.subs))
+	for id := range rb.subs {
+		ids = append(ids, id)
+	}
+	rb.mu.RUnlock()
+	for _, id := range ids {
+		rb.Unsubscribe(id)
+	}
+	rb.cancel()
+
+	done := make(chan struct{})
+	go func() { rb.wg.Wait(); close(done) }()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errCloseTimeout
+	}
+}
+
+// Drain 停止接受发布并等待进行中的处理完成后关闭；未读取的消息留在流中，不计入报告
+func (rb *redisBus) Drain(ctx context.Context) (DrainReport, error) {
+	rep := DrainReport{Scheduled: rb.sched.stop(rb.schedulePolicy)}
+	err := rb.waitDrained(ctx, rb.stopAccepting())
+	rep.InFlight = rb.inFlight()
+	if cerr := rb.Close(ctx); err == nil {
+		err = cerr
+	}
+	return rep, err
+}
+
+func (rb *redisBus) consume(ctx context.Context, s *subscriber, group string) {
+	defer rb.wg.Done()
+
+	// 先处理本消费者名下遗留的未确认消息（固定 Consumer 名重启时有效）
+	if !rb.read(ctx, s, group, "0") {
+		return
+	}
+
+	lastClaim := time.Now()
+	for ctx.Err() == nil {
+		// 暂停期间不读取，消息留在流中
+		if !s.waitResumed(ctx.Done()) {
+			return
+		}
+		if time.Since(lastClaim) >= rb.cfg.ClaimInterval {
+			if !rb.claim(ctx, s, group) {
+				return
+			}
+			lastClaim = time.Now()
+		}
+		if !rb.read(ctx, s, group, ">") {
+			return
+		}
+	}
+}
+
+// read 读取一批消息并处理；id 为 "0" 时读取本消费者的待确认列表直到取空
+func (rb *redisBus) read(ctx context.Context, s *subscriber, group, id string) bool {
+	for {
+		args := &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: rb.cfg.Consumer,
+			Streams:  []string{rb.cfg.Stream, id},
+			Count:    rb.cfg.Count,
+		}
+		if id == ">" {
+			args.Block = rb.cfg.Block
+		}
+		streams, err := rb.client.XReadGroup(ctx, args).Result()
+		if errors.Is(err, redis.Nil) {
+			return true
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			log.Printf("[eventbus] redis read stream=%s group=%s err=%v", rb.cfg.Stream, group, err)
+			return rb.backoff(ctx)
+		}
+
+		var n int
+		for _, st := range streams {
+			n += len(st.Messages)
+			for _, msg := range st.Messages {
+				if !rb.handle(ctx, s, group, msg) {
+					return false
+				}
+			}
+		}
+		if id == ">" || n == 0 {
+			return true
+		}
+	}
+}
+
+// claim 认领空闲超过 ClaimIdle 的未确认消息（通常来自崩溃的消费者）
+func (rb *redisBus) claim(ctx context.Context, s *subscriber, group string) bool {
+	start := "0-0"
+	for {
+		msgs, next, err := rb.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   rb.cfg.Stream,
+			Group:    group,
+			Consumer: rb.cfg.Consumer,
+			MinIdle:  rb.cfg.ClaimIdle,
+			Start:    start,
+			Count:    rb.cfg.Count,
+		}).Result()
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			log.Printf("[eventbus] redis autoclaim stream=%s group=%s err=%v", rb.cfg.Stream, group, err)
+			return true
+		}
+		for _, msg := range msgs {
+			if !rb.handle(ctx, s, group, msg) {
+				return false
+			}
+		}
+		if next == "0-0" || len(msgs) == 0 {
+			return true
+		}
+		start = next
+	}
+}
+
+// handle 处理单条消息并确认，返回 false 表示订阅已结束
+func (rb *redisBus) handle(ctx context.Context, s *subscriber, group string, msg redis.XMessage) bool {
+	evt, err := decodeRedisEvent(msg)
+	if err != nil {
+		log.Printf("[eventbus] redis decode stream=%s id=%s err=%v", rb.cfg.Stream, msg.ID, err)
+		rb.ack(group, msg.ID)
+		return true
+	}
+
+	matched := MatchPattern(s.pattern, evt.Key())
+	if matched {
+		if err := rb.deliver(rb.deliveryContext(ctx, evt), s, evt); err != nil {
+			log.Printf("[eventbus] handler error sub=%s pattern=%s key=%s id=%s err=%v",
+				s.id, s.pattern, evt.Key(), evt.ID(), err)
+		}
+	}
+	rb.ack(group, msg.ID)
+
+	if matched && s.opt.Once {
+		rb.Unsubscribe(s.id)
+		return false
+	}
+	return ctx.Err() == nil
+}
+
+func (rb *redisBus) ack(group, id string) {
+	// 处理器可能因为 ctx 取消而返回，确认仍需完成
+	ctx, cancel := context.WithTimeout(context.Background(), rb.cfg.Block)
+	defer cancel()
+	if err := rb.client.XAck(ctx, rb.cfg.Stream, group, id).Err(); err != nil {
+		log.Printf("[eventbus] redis ack stream=%s group=%s id=%s err=%v", rb.cfg.Stream, group, id, err)
+	}
+}
+
+func (rb *redisBus) backoff(ctx context.Context) bool {
+	t := time.NewTimer(rb.cfg.Block)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func encodeRedisEvent(evt Event) map[string]any {
+	values := map[string]any{
+		redisFieldKey:     evt.Key(),
+		redisFieldID:      evt.ID(),
+		redisFieldAt:      evt.At().Format(time.RFC3339Nano),
+		redisFieldPayload: evt.Payload(),
+	}
+	for k, v := range HeadersOf(evt) {
+		values[redisHeaderPrefix+k] = v
+	}
+	return values
+}
+
+func decodeRedisEvent(msg redis.XMessage) (Event, error) {
+	str := func(name string) string {
+		v, _ := msg.Values[name].(string)
+		return v
+	}
+
+	key := str(redisFieldKey)
+	if key == "" {
+		return nil, fmt.Errorf("missing %q field", redisFieldKey)
+	}
+	at, err := time.Parse(time.RFC3339Nano, str(redisFieldAt))
+	if err != nil {
+		return nil, fmt.Errorf("bad %q field: %w", redisFieldAt, err)
+	}
+	var headers Headers
+	for name, v := range msg.Values {
+		if k, ok := strings.CutPrefix(name, redisHeaderPrefix); ok {
+			if headers == nil {
+				headers = Headers{}
+			}
+			headers[k], _ = v.(string)
+		}
+	}
+	return &BaseEvent{
+		key:     key,
+		payload: []byte(str(redisFieldPayload)),
+		id:      str(redisFieldID),
+		at:      at,
+		headers: headers,
+	}, nil
+}
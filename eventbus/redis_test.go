@@ -0,0 +1,232 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	return redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+func TestRedisBusFanoutAcrossInstances(t *testing.T) {
+	client := newTestRedis(t)
+	cfg := RedisConfig{Stream: "events", Block: 50 * time.Millisecond}
+	b1 := NewRedisBus(client, cfg)
+	b2 := NewRedisBus(client, cfg)
+	defer b1.Close(context.Background())
+	defer b2.Close(context.Background())
+
+	var c1, c2, other int32
+	b1.SubscribeFunc("order.*", func(ctx context.Context, evt Event) error {
+		dto, err := DecodeJSON[shippedDTO](evt)
+		if err != nil || dto.OrderID != 42 {
+			t.Errorf("decode dto=%+v err=%v", dto, err)
+		}
+		atomic.AddInt32(&c1, 1)
+		return nil
+	}, EventOptions{})
+	b2.SubscribeFunc("order.shipped", func(ctx context.Context, evt Event) error {
+		atomic.AddInt32(&c2, 1)
+		return nil
+	}, EventOptions{})
+	b2.SubscribeFunc("user.*", func(ctx context.Context, evt Event) error {
+		atomic.AddInt32(&other, 1)
+		return nil
+	}, EventOptions{})
+
+	if err := b1.Publish(context.Background(), mustNewEvt(t, "order.shipped", 42, 1)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitUntil(t, 2*time.Second, func() bool {
+		return atomic.LoadInt32(&c1) == 1 && atomic.LoadInt32(&c2) == 1
+	})
+	if atomic.LoadInt32(&other) != 0 {
+		t.Fatalf("pattern filter failed")
+	}
+}
+
+func TestRedisBusDurableGroupSharesWork(t *testing.T) {
+	client := newTestRedis(t)
+	cfg := RedisConfig{Stream: "jobs", Block: 20 * time.Millisecond}
+	b1 := NewRedisBus(client, cfg)
+	b2 := NewRedisBus(client, cfg)
+	defer b1.Close(context.Background())
+	defer b2.Close(context.Background())
+
+	var total int32
+	h := func(ctx context.Context, evt Event) error {
+		atomic.AddInt32(&total, 1)
+		return nil
+	}
+	b1.SubscribeFunc("job.*", h, EventOptions{Durable: "worker"})
+	b2.SubscribeFunc("job.*", h, EventOptions{Durable: "worker"})
+
+	for i := 0; i < 10; i++ {
+		_ = b1.Publish(context.Background(), mustNewEvt(t, "job.run", i, i))
+	}
+	waitUntil(t, 2*time.Second, func() bool { return atomic.LoadInt32(&total) == 10 })
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&total); n != 10 {
+		t.Fatalf("durable group should deliver each event once, got %d", n)
+	}
+}
+
+func TestRedisBusReclaimsPending(t *testing.T) {
+	client := newTestRedis(t)
+	ctx := context.Background()
+
+	// 一个“崩溃”的消费者读到消息但从未确认
+	group := redisGroupPrefix + "billing"
+	if err := client.XGroupCreateMkStream(ctx, "bill", group, "$").Err(); err != nil {
+		t.Fatal(err)
+	}
+	pub := NewRedisBus(client, RedisConfig{Stream: "bill"})
+	defer pub.Close(ctx)
+	_ = pub.Publish(ctx, mustNewEvt(t, "invoice.created", 9, 9))
+	if err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group: group, Consumer: "dead", Streams: []string{"bill", ">"}, Count: 10,
+	}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewRedisBus(client, RedisConfig{
+		Stream:        "bill",
+		Block:         20 * time.Millisecond,
+		ClaimIdle:     30 * time.Millisecond,
+		ClaimInterval: 10 * time.Millisecond,
+	})
+	defer b.Close(ctx)
+
+	var got int32
+	b.SubscribeFunc("invoice.*", func(ctx context.Context, evt Event) error {
+		atomic.AddInt32(&got, 1)
+		return nil
+	}, EventOptions{Durable: "billing"})
+
+	waitUntil(t, 2*time.Second, func() bool { return atomic.LoadInt32(&got) == 1 })
+	waitUntil(t, time.Second, func() bool {
+		p, err := client.XPending(ctx, "bill", group).Result()
+		return err == nil && p.Count == 0
+	})
+}
+
+func TestRedisBusPublishAfterClose(t *testing.T) {
+	client := newTestRedis(t)
+	b := NewRedisBus(client, RedisConfig{Stream: "events", Block: 20 * time.Millisecond})
+	_ = b.Close(context.Background())
+	if err := b.Publish(context.Background(), mustNewEvt(t, "a", 1, 1)); !errors.Is(err, ErrBusClosed) {
+		t.Fatalf("expected ErrBusClosed, got %v", err)
+	}
+}
+
+func TestRedisBusDrainWaitsForPublish(t *testing.T) {
+	client := newTestRedis(t)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	b := NewRedisBus(client, RedisConfig{Stream: "events", Block: 20 * time.Millisecond},
+		WithPublishInterceptor(func(next PublishFunc) PublishFunc {
+			return func(ctx context.Context, evt Event) error {
+				close(entered)
+				<-release
+				return next(ctx, evt)
+			}
+		}))
+
+	published := make(chan error, 1)
+	go func() { published <- b.Publish(context.Background(), mustNewEvt(t, "a", 1, 1)) }()
+	<-entered
+
+	drained := make(chan error, 1)
+	go func() {
+		_, err := b.(Lifecycle).Drain(context.Background())
+		drained <- err
+	}()
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned before the publish did: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := b.Publish(context.Background(), mustNewEvt(t, "b", 2, 2)); !errors.Is(err, ErrBusClosed) {
+		t.Fatalf("expected ErrBusClosed while draining, got %v", err)
+	}
+
+	close(release)
+	if err := <-published; err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if n, _ := client.XLen(context.Background(), "events").Result(); n != 1 {
+		t.Fatalf("expected the in-flight event in the stream, got %d", n)
+	}
+}
+
+func TestRedisBusSweepsIdleEphemeralGroups(t *testing.T) {
+	client := newTestRedis(t)
+	ctx := context.Background()
+	groups := func() map[string]bool {
+		res := map[string]bool{}
+		infos, _ := client.XInfoGroups(ctx, "events").Result()
+		for _, g := range infos {
+			res[g.Name] = true
+		}
+		return res
+	}
+
+	// 崩溃的实例留下的临时组：心跳已过期或没来得及写入；以 UUID 命名的持久组不是临时组
+	dead := redisGroupPrefix + redisEphemeral + "dead"
+	orphan := redisGroupPrefix + redisEphemeral + "orphan"
+	durableName := uuid.NewString()
+	durable := redisGroupPrefix + durableName
+	for _, g := range []string{dead, orphan, durable} {
+		if err := client.XGroupCreateMkStream(ctx, "events", g, "$").Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.HSet(ctx, "events:heartbeats", dead, time.Now().Add(-time.Hour).UnixMilli())
+
+	cfg := RedisConfig{Stream: "events", Block: 10 * time.Millisecond, GroupIdle: 200 * time.Millisecond}
+	b1 := NewRedisBus(client, cfg)
+	b2 := NewRedisBus(client, cfg)
+	defer b1.Close(ctx)
+	defer b2.Close(ctx)
+	live := b2.SubscribeFunc("a.*", func(ctx context.Context, evt Event) error { return nil }, EventOptions{})
+
+	waitUntil(t, 2*time.Second, func() bool {
+		g := groups()
+		return !g[dead] && !g[orphan]
+	})
+	g := groups()
+	if !g[durable] || !g[redisGroupPrefix+redisEphemeral+live] {
+		t.Fatalf("expected durable and live groups to be kept, got %v", g)
+	}
+	if beats, _ := client.HKeys(ctx, "events:heartbeats").Result(); len(beats) != 1 {
+		t.Fatalf("expected only the live group heartbeat, got %v", beats)
+	}
+
+	if err := b1.(DurableAdmin).DeleteDurable(durableName); err != nil || groups()[durable] {
+		t.Fatalf("expected the durable group to be deleted, got %v", err)
+	}
+}
+
+func TestRedisConfigDefaults(t *testing.T) {
+	var cfg RedisConfig
+	cfg.setDefaults()
+	if cfg.MaxLen != defaultRedisMaxLen || cfg.GroupIdle != defaultRedisGroupIdle {
+		t.Fatalf("unexpected defaults %+v", cfg)
+	}
+	if b := NewRedisBus(newTestRedis(t), RedisConfig{}); b.(*redisBus).cfg.MaxLen <= 0 {
+		t.Fatal("expected the stream to be trimmed by default")
+	}
+}
@@ -0,0 +1,191 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	HeaderCorrelationID = "correlation-id"
+	HeaderReplyTo       = "reply-to"
+	HeaderReplyError    = "reply-error"
+
+	inboxPrefix = "_inbox."
+)
+
+var ErrRequesterClosed = errors.New("eventbus: requester closed")
+
+// ReplyError 响应方处理失败时返回给请求方的错误
+type ReplyError struct {
+	Message string
+}
+
+func (e *ReplyError) Error() string { return "eventbus: reply error: " + e.Message }
+
+// ResponderFunc 处理请求并返回响应事件，响应的 Key 会被替换为请求的 reply-to
+type ResponderFunc func(ctx context.Context, req Event) (Event, error)
+
+// Respond 注册响应方：收到带 reply-to 的请求后调用 fn，并把结果（或错误）发布回请求方的收件箱。
+// 错误发布给请求方后即视为处理完成，不再触发重试或死信；不带 reply-to 的事件仍会交给 fn 处理，
+// 只是不发送响应，错误照常返回
+func Respond(bus EventBus, pattern string, fn ResponderFunc, opt EventOptions) (subID string) {
+	return bus.SubscribeFunc(pattern, func(ctx context.Context, req Event) error {
+		resp, err := fn(ctx, req)
+		replyTo := HeadersOf(req).Get(HeaderReplyTo)
+		if replyTo == "" {
+			return err
+		}
+
+		reply := &BaseEvent{key: replyTo, id: uuid.NewString(), at: time.Now()}
+		if resp != nil {
+			reply.payload = resp.Payload()
+			reply.headers = HeadersOf(resp).Clone()
+		}
+		reply.SetHeader(HeaderCorrelationID, HeadersOf(req).Get(HeaderCorrelationID))
+		if err != nil {
+			reply.SetHeader(HeaderReplyError, err.Error())
+		}
+		return bus.Publish(ctx, reply)
+	}, opt)
+}
+
+// Requester 请求/响应客户端：持有一个私有收件箱主题，按 correlation-id 把响应分派给等待者
+type Requester struct {
+	bus   EventBus
+	inbox string
+	subID string
+
+	mu      sync.Mutex
+	pending map[string]chan Event
+	closed  bool
+}
+
+// NewRequester 在 bus 上创建请求客户端，用完需调用 Close 取消收件箱订阅
+func NewRequester(bus EventBus) *Requester {
+	r := &Requester{
+		bus:     bus,
+		inbox:   inboxPrefix + uuid.NewString(),
+		pending: make(map[string]chan Event),
+	}
+	r.subID = bus.SubscribeFunc(r.inbox, r.onReply, EventOptions{})
+	return r
+}
+
+func (r *Requester) onReply(ctx context.Context, evt Event) error {
+	id := HeadersOf(evt).Get(HeaderCorrelationID)
+
+	r.mu.Lock()
+	ch, ok := r.pending[id]
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	select {
+	case ch <- evt:
+	default:
+		log.Printf("[eventbus] reply dropped correlation=%s: receiver full", id)
+	}
+	return nil
+}
+
+// Request 发布请求并等待第一条响应，超时由 ctx 控制；响应方出错时返回 *ReplyError
+func (r *Requester) Request(ctx context.Context, evt Event) (Event, error) {
+	id, ch, err := r.send(ctx, evt, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer r.forget(id)
+
+	select {
+	case reply := <-ch:
+		if msg := HeadersOf(reply).Get(HeaderReplyError); msg != "" {
+			return reply, &ReplyError{Message: msg}
+		}
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Gather 发布请求并收集响应（scatter-gather），收满 n 条或 ctx 结束时返回；
+// n<=0 表示一直收集到 ctx 结束。出错的响应不计入结果。到期时已有响应则不返回错误
+func (r *Requester) Gather(ctx context.Context, evt Event, n int) ([]Event, error) {
+	size := n
+	if size <= 0 {
+		size = 64
+	}
+	id, ch, err := r.send(ctx, evt, size)
+	if err != nil {
+		return nil, err
+	}
+	defer r.forget(id)
+
+	var replies []Event
+	for n <= 0 || len(replies) < n {
+		select {
+		case reply := <-ch:
+			if HeadersOf(reply).Get(HeaderReplyError) != "" {
+				continue
+			}
+			replies = append(replies, reply)
+		case <-ctx.Done():
+			if len(replies) > 0 {
+				return replies, nil
+			}
+			return nil, ctx.Err()
+		}
+	}
+	return replies, nil
+}
+
+func (r *Requester) send(ctx context.Context, evt Event, buffer int) (string, chan Event, error) {
+	id := uuid.NewString()
+	ch := make(chan Event, buffer)
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return "", nil, ErrRequesterClosed
+	}
+	r.pending[id] = ch
+	r.mu.Unlock()
+
+	evt = WithHeader(evt, HeaderCorrelationID, id)
+	evt = WithHeader(evt, HeaderReplyTo, r.inbox)
+	if err := r.bus.Publish(ctx, evt); err != nil {
+		r.forget(id)
+		return "", nil, err
+	}
+	return id, ch, nil
+}
+
+func (r *Requester) forget(id string) {
+	r.mu.Lock()
+	delete(r.pending, id)
+	r.mu.Unlock()
+}
+
+// Close 取消收件箱订阅，之后的请求返回 ErrRequesterClosed
+func (r *Requester) Close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	r.mu.Unlock()
+	r.bus.Unsubscribe(r.subID)
+}
+
+// Request 使用临时收件箱发送一次请求，频繁调用时应复用 Requester
+func Request(ctx context.Context, bus EventBus, evt Event) (Event, error) {
+	r := NewRequester(bus)
+	defer r.Close()
+	return r.Request(ctx, evt)
+}
@@ -0,0 +1,141 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type quoteDTO struct {
+	Vendor string `json:"vendor"`
+	Price  int    `json:"price"`
+}
+
+func TestRequestReply(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+
+	Respond(b, "price.get", func(ctx context.Context, req Event) (Event, error) {
+		dto, err := DecodeJSON[shippedDTO](req)
+		if err != nil {
+			return nil, err
+		}
+		if dto.OrderID < 0 {
+			return nil, errors.New("bad order")
+		}
+		return NewJSONEvent("ignored", quoteDTO{Vendor: "a", Price: dto.OrderID * 10}), nil
+	}, EventOptions{Async: true})
+
+	r := NewRequester(b)
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, err := r.Request(ctx, mustNewEvt(t, "price.get", 3, 0))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	q, _ := DecodeJSON[quoteDTO](reply)
+	if q.Price != 30 {
+		t.Fatalf("unexpected reply %+v", q)
+	}
+
+	_, err = r.Request(ctx, mustNewEvt(t, "price.get", -1, 0))
+	var re *ReplyError
+	if !errors.As(err, &re) || re.Message != "bad order" {
+		t.Fatalf("expected ReplyError, got %v", err)
+	}
+
+	// 没有响应方时按 ctx 超时
+	short, cancel2 := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel2()
+	if _, err := Request(short, b, mustNewEvt(t, "nobody.home", 0, 0)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestRespondErrorNotRetried(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+
+	var calls int32
+	Respond(b, "price.get", func(ctx context.Context, req Event) (Event, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errors.New("bad order")
+	}, EventOptions{Async: true, Retry: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := Request(ctx, b, mustNewEvt(t, "price.get", 1, 0))
+	var re *ReplyError
+	if !errors.As(err, &re) {
+		t.Fatalf("expected ReplyError, got %v", err)
+	}
+	if err := b.(Lifecycle).Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expected the request to be handled once, got %d", n)
+	}
+}
+
+func TestScatterGather(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+
+	for i, vendor := range []string{"a", "b", "c"} {
+		price := (i + 1) * 100
+		Respond(b, "quote.*", func(ctx context.Context, req Event) (Event, error) {
+			return NewJSONEvent("", quoteDTO{Vendor: vendor, Price: price}), nil
+		}, EventOptions{Async: true})
+	}
+	Respond(b, "quote.*", func(ctx context.Context, req Event) (Event, error) {
+		return nil, fmt.Errorf("vendor down")
+	}, EventOptions{Async: true})
+
+	r := NewRequester(b)
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	replies, err := r.Gather(ctx, mustNewEvt(t, "quote.request", 1, 1), 0)
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	if len(replies) != 3 {
+		t.Fatalf("expected 3 replies, got %d", len(replies))
+	}
+
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	replies, err = r.Gather(ctx2, mustNewEvt(t, "quote.request", 1, 1), 2)
+	if err != nil || len(replies) != 2 {
+		t.Fatalf("gather n=2: %d replies err=%v", len(replies), err)
+	}
+}
+
+func TestRequestOverRedis(t *testing.T) {
+	client := newTestRedis(t)
+	cfg := RedisConfig{Stream: "rpc", Block: 20 * time.Millisecond}
+	server := NewRedisBus(client, cfg)
+	caller := NewRedisBus(client, cfg)
+	defer server.Close(context.Background())
+	defer caller.Close(context.Background())
+
+	Respond(server, "stock.check", func(ctx context.Context, req Event) (Event, error) {
+		return NewJSONEvent("", quoteDTO{Vendor: "wh", Price: 5}), nil
+	}, EventOptions{Durable: "stock"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	reply, err := Request(ctx, caller, mustNewEvt(t, "stock.check", 1, 1))
+	if err != nil {
+		t.Fatalf("request over redis: %v", err)
+	}
+	if q, _ := DecodeJSON[quoteDTO](reply); q.Vendor != "wh" {
+		t.Fatalf("unexpected reply %+v", q)
+	}
+}
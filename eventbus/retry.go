@@ -0,0 +1,123 @@
+package eventbus
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+	defaultMultiplier     = 2
+)
+
+// RetryPolicy 订阅级别的重试配置，零值表示不重试
+type RetryPolicy struct {
+	MaxAttempts    int                  // 总尝试次数（含首次），<=1 表示不重试
+	InitialBackoff time.Duration        // 首次重试前的等待，默认 100ms
+	MaxBackoff     time.Duration        // 等待上限，默认 10s
+	Multiplier     float64              // 指数退避倍数，默认 2
+	Jitter         float64              // 抖动比例 [0,1]，实际等待在 d*(1±Jitter) 之间
+	Retryable      func(err error) bool // 判断错误是否可重试，nil 表示所有错误都重试
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable == nil {
+		return true
+	}
+	return p.Retryable(err)
+}
+
+// backoff 返回第 n 次失败后的等待时间（n 从 1 开始）
+func (p RetryPolicy) backoff(n int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	maxd := p.MaxBackoff
+	if maxd <= 0 {
+		maxd = defaultMaxBackoff
+	}
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = defaultMultiplier
+	}
+
+	d := float64(initial) * math.Pow(mult, float64(n-1))
+	if d > float64(maxd) {
+		d = float64(maxd)
+	}
+	if p.Jitter > 0 {
+		j := math.Min(p.Jitter, 1)
+		d = d * (1 - j + 2*j*rand.Float64())
+	}
+	return time.Duration(d)
+}
+
+// deliver 按订阅的重试策略调用处理器，重试耗尽后投递到死信；
+// 成功进入死信时返回 nil，否则返回最后一次的错误
+func (b *bus) deliver(ctx context.Context, s *subscriber, evt Event) error {
+	s.stats.inFlight.Add(1)
+	defer s.stats.inFlight.Add(-1)
+
+	policy := s.opt.Retry
+	var history []Attempt
+	var lastErr error
+	for n := 1; ; n++ {
+		start := time.Now()
+		lastErr = b.invokeOnce(ctx, s, evt)
+		if lastErr == nil {
+			b.recordDelivered(s)
+			return nil
+		}
+		history = append(history, Attempt{N: n, At: start, Duration: time.Since(start), Err: lastErr})
+
+		if n >= policy.attempts() || !policy.retryable(lastErr) {
+			break
+		}
+		if !b.sleep(ctx, s, policy.backoff(n)) {
+			break
+		}
+		b.recordRetried(s)
+	}
+
+	b.recordFailed(s)
+	return b.deadLetter(ctx, s, evt, history, lastErr)
+}
+
+// invokeOnce 执行一次处理，按 EventOptions.Timeout 设置截止时间
+func (b *bus) invokeOnce(ctx context.Context, s *subscriber, evt Event) error {
+	start := time.Now()
+	defer func() { b.recordLatency(s, time.Since(start)) }()
+
+	if s.opt.Timeout <= 0 {
+		return b.safeInvoke(s, ctx, evt)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.opt.Timeout)
+	defer cancel()
+	return b.safeInvoke(s, ctx, evt)
+}
+
+// sleep 在重试间隔中等待，总线关闭、订阅取消或 ctx 结束时返回 false
+func (b *bus) sleep(ctx context.Context, s *subscriber, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+	case <-b.ctx.Done():
+	case <-s.closed:
+	}
+	return false
+}
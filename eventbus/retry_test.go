@@ -0,0 +1,111 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errTemporary = errors.New("temporary")
+
+func TestRetryThenSucceed(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+
+	var calls int32
+	b.SubscribeFunc("pay.done", func(ctx context.Context, evt Event) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errTemporary
+		}
+		return nil
+	}, EventOptions{Retry: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}})
+
+	if err := b.Publish(context.Background(), mustNewEvt(t, "pay.done", 1, 1)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestRetryExhaustedGoesToDeadLetter(t *testing.T) {
+	dlq := NewMemoryDLQ(0)
+	b := New(WithDeadLetter(dlq))
+	defer b.Close(context.Background())
+
+	var calls int32
+	id := b.SubscribeFunc("pay.*", func(ctx context.Context, evt Event) error {
+		atomic.AddInt32(&calls, 1)
+		return errTemporary
+	}, EventOptions{Async: true, Retry: RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, Jitter: 0.5}})
+
+	_ = b.Publish(context.Background(), mustNewEvt(t, "pay.failed", 7, 7))
+	waitUntil(t, time.Second, func() bool { return dlq.Len() == 1 })
+
+	dl := dlq.List()[0]
+	if dl.SubID != id || dl.Pattern != "pay.*" || len(dl.Attempts) != 4 || !errors.Is(dl.Err, errTemporary) {
+		t.Fatalf("unexpected dead letter %+v", dl)
+	}
+
+	// 重放后从队列移除
+	var redriven Event
+	n, err := dlq.Redrive(context.Background(), func(ctx context.Context, dl *DeadLetter) error {
+		redriven = dl.Event
+		return nil
+	})
+	if err != nil || n != 1 || dlq.Len() != 0 || redriven.Key() != "pay.failed" {
+		t.Fatalf("redrive n=%d err=%v len=%d", n, err, dlq.Len())
+	}
+}
+
+func TestNonRetryableAndSyncDeadLetter(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+
+	var calls int32
+	dlq := NewMemoryDLQ(1)
+	permanent := errors.New("permanent")
+	b.SubscribeFunc("user.*", func(ctx context.Context, evt Event) error {
+		atomic.AddInt32(&calls, 1)
+		return permanent
+	}, EventOptions{
+		DeadLetter: dlq,
+		Retry: RetryPolicy{
+			MaxAttempts: 5,
+			Retryable:   func(err error) bool { return !errors.Is(err, permanent) },
+		},
+	})
+
+	// 同步处理器失败后进入死信，不再中止 Publish
+	for i := 0; i < 2; i++ {
+		if err := b.Publish(context.Background(), mustNewEvt(t, "user.bad", i, i)); err != nil {
+			t.Fatalf("publish should succeed with dead letter sink: %v", err)
+		}
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("non-retryable error should not retry, calls=%d", calls)
+	}
+	if dlq.Len() != 1 || dlq.Dropped() != 1 {
+		t.Fatalf("capacity not honoured len=%d dropped=%d", dlq.Len(), dlq.Dropped())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 40 * time.Millisecond},
+		{4, 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := p.backoff(tt.n); got != tt.want {
+			t.Fatalf("backoff(%d) want %s got %s", tt.n, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,480 @@
+package eventbus
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	scheduleFile       = "scheduled.log"
+	scheduleCompactMin = 64 // 日志记录数超过存活事件数的两倍再加上该值时重写
+	scheduleOpAdd      = "add"
+	scheduleOpDel      = "del"
+)
+
+var ErrDuplicateSchedule = errors.New("eventbus: event already scheduled")
+
+// Scheduler 延迟/定时发布
+type Scheduler interface {
+	// PublishAt 在 at 时刻发布事件，返回的调度 ID 即事件 ID；发布时 ctx 中的可传播值会写入元数据
+	PublishAt(ctx context.Context, evt Event, at time.Time) (schedID string, err error)
+	// PublishAfter 在 d 之后发布事件
+	PublishAfter(ctx context.Context, evt Event, d time.Duration) (schedID string, err error)
+	// CancelScheduled 取消尚未发布的事件
+	CancelScheduled(schedID string) bool
+	// Scheduled 按到期时间返回所有待发布的事件
+	Scheduled() []ScheduledEvent
+}
+
+// 到期事件发布失败（例如同步处理器出错、Redis 不可用）时按默认重试退避重新排队，
+// 直到发布成功或被取消；开启 WAL 时只有发布成功后才从磁盘删除。
+
+// ScheduledEvent 待发布事件的快照
+type ScheduledEvent struct {
+	ID    string
+	Key   string
+	Due   time.Time
+	Event Event
+}
+
+// ScheduleClosePolicy 总线关闭时对未到期事件的处理方式
+type ScheduleClosePolicy int
+
+const (
+	SchedulePersist ScheduleClosePolicy = iota // 开启 WAL 时保留到磁盘，重启后继续；否则丢弃并记录日志
+	ScheduleFlush                              // 关闭前立即发布所有未到期事件
+	ScheduleDiscard                            // 直接丢弃
+)
+
+// WithScheduleClosePolicy 设置关闭时未到期事件的处理方式，默认 SchedulePersist
+func WithScheduleClosePolicy(p ScheduleClosePolicy) BusOption {
+	return func(b *bus) { b.schedulePolicy = p }
+}
+
+func (b *bus) PublishAt(ctx context.Context, evt Event, at time.Time) (string, error) {
+	if evt == nil {
+		return "", nil
+	}
+	return b.sched.add(b.inject(ctx, evt), at)
+}
+
+func (b *bus) PublishAfter(ctx context.Context, evt Event, d time.Duration) (string, error) {
+	return b.PublishAt(ctx, evt, time.Now().Add(d))
+}
+
+func (b *bus) CancelScheduled(schedID string) bool {
+	return b.sched.cancel(schedID)
+}
+
+func (b *bus) Scheduled() []ScheduledEvent {
+	return b.sched.list()
+}
+
+// publishScheduled 到期后发布，ctx 由事件元数据还原
+func (b *bus) publishScheduled(evt Event) error {
+	return b.publishFn(b.deliveryContext(context.Background(), evt), evt)
+}
+
+func (b *bus) stopScheduler() {
+	for _, p := range b.sched.stop(b.schedulePolicy) {
+		log.Printf("[eventbus] scheduled event dropped on close key=%s id=%s due=%s",
+			p.Key, p.ID, p.Due.Format(time.RFC3339))
+	}
+}
+
+type scheduledItem struct {
+	evt      Event
+	due      time.Time
+	index    int // 在堆中的位置，发布中为 -1
+	attempts int // 连续发布失败的次数
+}
+
+type scheduleHeap []*scheduledItem
+
+func (h scheduleHeap) Len() int           { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+func (h scheduleHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i]; h[i].index = i; h[j].index = j }
+func (h *scheduleHeap) Push(x any) {
+	it := x.(*scheduledItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+func (h *scheduleHeap) Pop() any {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	*h = old[:n-1]
+	it.index = -1
+	return it
+}
+
+// scheduledRecord 持久化格式
+type scheduledRecord struct {
+	walRecord
+	Due time.Time `json:"due"`
+}
+
+// scheduleEntry 追加日志中的一行：add 记录新的待发布事件，del 记录事件已发布或被取消
+type scheduleEntry struct {
+	Op string `json:"op"`
+	scheduledRecord
+}
+
+func addEntry(it *scheduledItem) scheduleEntry {
+	e := it.evt
+	return scheduleEntry{Op: scheduleOpAdd, scheduledRecord: scheduledRecord{
+		walRecord: walRecord{Key: e.Key(), ID: e.ID(), At: e.At(), Payload: e.Payload(), Headers: HeadersOf(e)},
+		Due:       it.due,
+	}}
+}
+
+func delEntry(id string) scheduleEntry {
+	return scheduleEntry{Op: scheduleOpDel, scheduledRecord: scheduledRecord{walRecord: walRecord{ID: id}}}
+}
+
+// scheduler 基于最小堆的定时器，到期后调用 publish
+type scheduler struct {
+	mu      sync.Mutex
+	items   map[string]*scheduledItem
+	queue   scheduleHeap
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	closed  bool
+	store   string   // 持久化的追加日志，为空表示不持久化
+	file    *os.File // 以追加方式打开的 store
+	entries int      // store 中的记录数
+	publish func(evt Event) error
+}
+
+func newScheduler(publish func(evt Event) error, store string) *scheduler {
+	s := &scheduler{
+		items:   make(map[string]*scheduledItem),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		store:   store,
+		publish: publish,
+	}
+	if store != "" {
+		if err := s.load(); err != nil {
+			log.Printf("[eventbus] load scheduled events file=%s err=%v", store, err)
+		}
+	}
+	go s.run()
+	return s
+}
+
+func (s *scheduler) add(evt Event, due time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return "", ErrBusClosed
+	}
+	if _, ok := s.items[evt.ID()]; ok {
+		return "", ErrDuplicateSchedule
+	}
+	it := &scheduledItem{evt: evt, due: due}
+	if err := s.persist(addEntry(it)); err != nil {
+		return "", err
+	}
+	s.items[evt.ID()] = it
+	heap.Push(&s.queue, it)
+	s.notify()
+	return evt.ID(), nil
+}
+
+func (s *scheduler) cancel(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[id]
+	if !ok || s.closed || it.index < 0 {
+		return false
+	}
+	heap.Remove(&s.queue, it.index)
+	s.remove(id)
+	s.notify()
+	return true
+}
+
+// remove 删除已发布或被取消的事件，调用方需持有锁
+func (s *scheduler) remove(id string) {
+	delete(s.items, id)
+	if err := s.persist(delEntry(id)); err != nil {
+		log.Printf("[eventbus] save scheduled events file=%s err=%v", s.store, err)
+	}
+}
+
+func (s *scheduler) list() []ScheduledEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+func (s *scheduler) snapshot() []ScheduledEvent {
+	res := make([]ScheduledEvent, 0, len(s.queue))
+	for _, it := range s.queue {
+		res = append(res, ScheduledEvent{ID: it.evt.ID(), Key: it.evt.Key(), Due: it.due, Event: it.evt})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Due.Before(res[j].Due) })
+	return res
+}
+
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) run() {
+	defer close(s.stopped)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		var due []*scheduledItem
+		for s.queue.Len() > 0 && !s.queue[0].due.After(now) {
+			// 离开堆但留在 items 中，发布成功后才删除
+			due = append(due, heap.Pop(&s.queue).(*scheduledItem))
+		}
+		wait := time.Hour
+		if s.queue.Len() > 0 {
+			wait = s.queue[0].due.Sub(now)
+		}
+		s.mu.Unlock()
+
+		for _, it := range due {
+			s.fire(it)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// fire 发布到期事件，成功后删除，失败时按退避重新排队
+func (s *scheduler) fire(it *scheduledItem) {
+	err := s.publish(it.evt)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.remove(it.evt.ID())
+		return
+	}
+	it.attempts++
+	delay := RetryPolicy{}.backoff(it.attempts)
+	log.Printf("[eventbus] scheduled publish key=%s id=%s err=%v, retrying in %s", it.evt.Key(), it.evt.ID(), err, delay)
+	it.due = time.Now().Add(delay)
+	heap.Push(&s.queue, it)
+	s.notify()
+}
+
+// stop 停止调度并按 policy 处理未到期事件，返回被丢弃的事件
+func (s *scheduler) stop(policy ScheduleClosePolicy) []ScheduledEvent {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	s.mu.Unlock()
+	<-s.stopped
+	defer s.closeStore()
+
+	s.mu.Lock()
+	pending := s.snapshot()
+	s.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	switch policy {
+	case ScheduleFlush:
+		var failed []ScheduledEvent
+		for _, p := range pending {
+			if err := s.publish(p.Event); err != nil {
+				log.Printf("[eventbus] scheduled flush key=%s id=%s err=%v", p.Key, p.ID, err)
+				failed = append(failed, p)
+				continue
+			}
+			s.mu.Lock()
+			s.remove(p.ID)
+			s.mu.Unlock()
+		}
+		if s.store != "" {
+			// 发布失败的事件留在磁盘，重启后继续
+			return nil
+		}
+		s.clear()
+		return failed
+	case SchedulePersist:
+		if s.store != "" {
+			return nil
+		}
+	}
+	s.clear()
+	return pending
+}
+
+func (s *scheduler) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = make(map[string]*scheduledItem)
+	s.queue = nil
+	if s.store == "" {
+		return
+	}
+	if err := s.rewrite(); err != nil {
+		log.Printf("[eventbus] save scheduled events file=%s err=%v", s.store, err)
+	}
+}
+
+func (s *scheduler) closeStore() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// persist 向追加日志写入一条记录，记录过多时重写日志，调用方需持有锁
+func (s *scheduler) persist(e scheduleEntry) error {
+	if s.store == "" {
+		return nil
+	}
+	if s.file == nil {
+		if err := s.rewrite(); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.entries++
+	if s.entries > 2*len(s.items)+scheduleCompactMin {
+		return s.rewrite()
+	}
+	return nil
+}
+
+// rewrite 只写入待发布事件生成新的日志并替换旧文件，调用方需持有锁
+func (s *scheduler) rewrite() error {
+	tmp := s.store + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, it := range s.items {
+		if err := enc.Encode(addEntry(it)); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.store); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.store, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.entries = len(s.items)
+	return nil
+}
+
+// load 回放追加日志，随后重写日志
+func (s *scheduler) load() error {
+	f, err := os.Open(s.store)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if f != nil {
+		err := s.replay(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for _, it := range s.items {
+		heap.Push(&s.queue, it)
+	}
+
+	return s.rewrite()
+}
+
+func (s *scheduler) replay(r *bufio.Reader) error {
+	for {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var e scheduleEntry
+			if jerr := json.Unmarshal(line, &e); jerr != nil {
+				// 崩溃时可能只写了一半，跳过残缺的行
+				log.Printf("[eventbus] skip corrupt scheduled entry file=%s err=%v", s.store, jerr)
+			} else if e.Op == scheduleOpDel {
+				delete(s.items, e.ID)
+			} else {
+				s.items[e.ID] = &scheduledItem{evt: e.event(), due: e.Due}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func scheduleStore(walDir string) string {
+	if walDir == "" {
+		return ""
+	}
+	return filepath.Join(walDir, scheduleFile)
+}
@@ -0,0 +1,177 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPublishAfter(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+
+	got := make(chan time.Time, 4)
+	b.SubscribeFunc("order.*", func(ctx context.Context, evt Event) error {
+		got <- time.Now()
+		return nil
+	}, EventOptions{})
+
+	start := time.Now()
+	id, err := b.PublishAfter(context.Background(), mustNewEvt(t, "order.timeout", 1, 1), 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	cancelled, _ := b.PublishAfter(context.Background(), mustNewEvt(t, "order.timeout", 2, 2), 30*time.Millisecond)
+	if _, err := b.PublishAt(context.Background(), mustNewEvt(t, "order.later", 3, 3), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+
+	list := b.Scheduled()
+	if len(list) != 3 || list[0].ID != cancelled || list[1].ID != id {
+		t.Fatalf("unexpected schedule %+v", list)
+	}
+	if !b.CancelScheduled(cancelled) || b.CancelScheduled(cancelled) {
+		t.Fatalf("cancel should succeed exactly once")
+	}
+
+	select {
+	case at := <-got:
+		if at.Sub(start) < 50*time.Millisecond {
+			t.Fatalf("published too early: %v", at.Sub(start))
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("scheduled event not published")
+	}
+	select {
+	case <-got:
+		t.Fatalf("cancelled event was published")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n := len(b.Scheduled()); n != 1 {
+		t.Fatalf("expected 1 pending event, got %d", n)
+	}
+}
+
+func TestScheduleFlushOnClose(t *testing.T) {
+	b := New(WithScheduleClosePolicy(ScheduleFlush))
+
+	var n int32
+	b.SubscribeFunc("reminder", func(ctx context.Context, evt Event) error {
+		atomic.AddInt32(&n, 1)
+		return nil
+	}, EventOptions{})
+	_, _ = b.PublishAfter(context.Background(), mustNewEvt(t, "reminder", 1, 1), time.Hour)
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if atomic.LoadInt32(&n) != 1 {
+		t.Fatalf("pending event not flushed on close")
+	}
+	if _, err := b.PublishAfter(context.Background(), mustNewEvt(t, "reminder", 2, 2), time.Second); !errors.Is(err, ErrBusClosed) {
+		t.Fatalf("expected ErrBusClosed, got %v", err)
+	}
+}
+
+func TestSchedulePersistWithWAL(t *testing.T) {
+	dir := t.TempDir()
+
+	b := New(WithWAL(dir))
+	id, err := b.PublishAfter(context.Background(), mustNewEvt(t, "invoice.due", 7, 7), 80*time.Millisecond)
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	_ = b.Close(context.Background())
+
+	b2 := New(WithWAL(dir))
+	defer b2.Close(context.Background())
+	if list := b2.Scheduled(); len(list) != 1 || list[0].ID != id {
+		t.Fatalf("schedule not restored: %+v", list)
+	}
+
+	got := make(chan Event, 1)
+	b2.SubscribeFunc("invoice.due", func(ctx context.Context, evt Event) error {
+		got <- evt
+		return nil
+	}, EventOptions{})
+	select {
+	case evt := <-got:
+		if dto, _ := DecodeJSON[shippedDTO](evt); dto.OrderID != 7 || evt.ID() != id {
+			t.Fatalf("unexpected restored event %+v", dto)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("restored event not published")
+	}
+}
+
+func TestScheduleAppendLog(t *testing.T) {
+	dir := t.TempDir()
+	store := scheduleStore(dir)
+	s := newScheduler(func(Event) error { return nil }, store)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := s.add(mustNewEvt(t, "a", i, i), time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	s.cancel(ids[1])
+	if lines := countLines(t, store); lines != 4 {
+		t.Fatalf("expected an entry per operation, got %d lines", lines)
+	}
+	s.stop(SchedulePersist)
+
+	s2 := newScheduler(func(Event) error { return nil }, store)
+	defer s2.stop(ScheduleDiscard)
+	if list := s2.list(); len(list) != 2 || list[0].ID != ids[0] || list[1].ID != ids[2] {
+		t.Fatalf("unexpected restored schedule %+v", list)
+	}
+	if lines := countLines(t, store); lines != 2 {
+		t.Fatalf("expected the log to be compacted on load, got %d lines", lines)
+	}
+}
+
+func TestScheduleKeepsFailedPublish(t *testing.T) {
+	store := scheduleStore(t.TempDir())
+	var calls int32
+	s := newScheduler(func(Event) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("redis down")
+	}, store)
+	id, err := s.add(mustNewEvt(t, "a", 1, 1), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, time.Second, func() bool { return atomic.LoadInt32(&calls) >= 2 })
+	s.stop(SchedulePersist)
+
+	published := make(chan string, 1)
+	s2 := newScheduler(func(evt Event) error {
+		published <- evt.ID()
+		return nil
+	}, store)
+	defer s2.stop(ScheduleDiscard)
+	select {
+	case got := <-published:
+		if got != id {
+			t.Fatalf("unexpected event %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failed event was not kept")
+	}
+	waitUntil(t, time.Second, func() bool { return len(s2.list()) == 0 && countLines(t, store) == 2 })
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(b, []byte("\n"))
+}
@@ -0,0 +1,274 @@
+package eventbus
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets 处理耗时直方图的桶上界，最后还有一个 +Inf 桶
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Inspector 订阅与计数的查询接口，内置的 EventBus 实现都支持
+type Inspector interface {
+	// Subscriptions 返回当前所有订阅，按 ID 排序
+	Subscriptions() []SubscriptionInfo
+	// Stats 返回总线累计计数以及每个订阅的计数
+	Stats() BusStats
+}
+
+// Histogram 处理耗时直方图，Counts[i] 为耗时不超过 Bounds[i] 的次数（非累计），
+// Counts[len(Bounds)] 为超过最大上界的次数
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// Counters 投递计数
+type Counters struct {
+	Delivered uint64 // 处理成功（含重试后成功）
+	Failed    uint64 // 重试耗尽仍失败（无论是否进入死信）
+	Retried   uint64 // 重试次数
+	Dropped   uint64 // 缓冲满或订阅取消而被丢弃
+	Panicked  uint64 // 处理器 panic 次数
+}
+
+// SubscriptionStats 单个订阅的计数
+type SubscriptionStats struct {
+	SubscriptionInfo
+	Counters
+	InFlight int64 // 正在执行的处理器数
+	Buffered int   // 缓冲中等待处理的事件数
+	Paused   bool
+	Latency  Histogram
+}
+
+// BusStats 总线计数，Totals 包含已取消的订阅
+type BusStats struct {
+	Published     uint64
+	Totals        Counters
+	Scheduled     int
+	Subscriptions []SubscriptionStats
+}
+
+// stats 订阅或总线的原子计数
+type stats struct {
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+	retried   atomic.Uint64
+	dropped   atomic.Uint64
+	panicked  atomic.Uint64
+	inFlight  atomic.Int64
+
+	buckets []atomic.Uint64
+	count   atomic.Uint64
+	sum     atomic.Int64
+}
+
+func newStats() *stats {
+	return &stats{buckets: make([]atomic.Uint64, len(LatencyBuckets)+1)}
+}
+
+func (st *stats) observe(d time.Duration) {
+	i := sort.Search(len(LatencyBuckets), func(i int) bool { return d <= LatencyBuckets[i] })
+	st.buckets[i].Add(1)
+	st.count.Add(1)
+	st.sum.Add(int64(d))
+}
+
+func (st *stats) counters() Counters {
+	return Counters{
+		Delivered: st.delivered.Load(),
+		Failed:    st.failed.Load(),
+		Retried:   st.retried.Load(),
+		Dropped:   st.dropped.Load(),
+		Panicked:  st.panicked.Load(),
+	}
+}
+
+func (st *stats) histogram() Histogram {
+	h := Histogram{
+		Bounds: LatencyBuckets,
+		Counts: make([]uint64, len(st.buckets)),
+		Count:  st.count.Load(),
+		Sum:    time.Duration(st.sum.Load()),
+	}
+	for i := range st.buckets {
+		h.Counts[i] = st.buckets[i].Load()
+	}
+	return h
+}
+
+// 以下 record* 同时更新订阅和总线的计数
+
+func (b *bus) recordDelivered(s *subscriber) {
+	s.stats.delivered.Add(1)
+	b.stats.delivered.Add(1)
+}
+
+func (b *bus) recordFailed(s *subscriber) {
+	s.stats.failed.Add(1)
+	b.stats.failed.Add(1)
+}
+
+func (b *bus) recordRetried(s *subscriber) {
+	s.stats.retried.Add(1)
+	b.stats.retried.Add(1)
+}
+
+func (b *bus) recordDropped(s *subscriber) {
+	s.stats.dropped.Add(1)
+	b.stats.dropped.Add(1)
+}
+
+func (b *bus) recordPanicked(s *subscriber) {
+	s.stats.panicked.Add(1)
+	b.stats.panicked.Add(1)
+}
+
+func (b *bus) recordLatency(s *subscriber, d time.Duration) {
+	s.stats.observe(d)
+	b.stats.observe(d)
+}
+
+// buffered 订阅缓冲及顺序分区中等待处理的事件数
+func (s *subscriber) buffered() int {
+	n := len(s.ch)
+	for _, p := range s.parts {
+		n += len(p)
+	}
+	return n
+}
+
+func (b *bus) Subscriptions() []SubscriptionInfo {
+	b.mu.RLock()
+	res := make([]SubscriptionInfo, 0, len(b.subs))
+	for _, s := range b.subs {
+		res = append(res, s.info())
+	}
+	b.mu.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+func (b *bus) Stats() BusStats {
+	b.mu.RLock()
+	subs := make([]*subscriber, 0, len(b.subs))
+	for _, s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.RUnlock()
+
+	res := BusStats{
+		Published:     b.published.Load(),
+		Totals:        b.stats.counters(),
+		Scheduled:     len(b.sched.list()),
+		Subscriptions: make([]SubscriptionStats, 0, len(subs)),
+	}
+	for _, s := range subs {
+		res.Subscriptions = append(res.Subscriptions, SubscriptionStats{
+			SubscriptionInfo: s.info(),
+			Counters:         s.stats.counters(),
+			InFlight:         s.stats.inFlight.Load(),
+			Buffered:         s.buffered(),
+			Paused:           s.paused(),
+			Latency:          s.stats.histogram(),
+		})
+	}
+	sort.Slice(res.Subscriptions, func(i, j int) bool {
+		return res.Subscriptions[i].ID < res.Subscriptions[j].ID
+	})
+	return res
+}
+
+// WritePrometheus 以 Prometheus 文本格式输出计数，每个订阅以 sub、pattern 作为标签，
+// 不带标签的序列为总线累计值（包含已取消的订阅）；
+// 也可以直接 expvar.Publish("eventbus", expvar.Func(func() any { return bus.Stats() })) 导出为 JSON
+func (s BusStats) WritePrometheus(w io.Writer, namespace string) error {
+	if namespace == "" {
+		namespace = "eventbus"
+	}
+	ew := &errWriter{w: w}
+
+	ew.printf("# TYPE %s_published_total counter\n", namespace)
+	ew.printf("%s_published_total %d\n", namespace, s.Published)
+	ew.printf("# TYPE %s_scheduled gauge\n", namespace)
+	ew.printf("%s_scheduled %d\n", namespace, s.Scheduled)
+
+	counters := []struct {
+		name string
+		get  func(Counters) uint64
+	}{
+		{"delivered_total", func(c Counters) uint64 { return c.Delivered }},
+		{"failed_total", func(c Counters) uint64 { return c.Failed }},
+		{"retried_total", func(c Counters) uint64 { return c.Retried }},
+		{"dropped_total", func(c Counters) uint64 { return c.Dropped }},
+		{"panicked_total", func(c Counters) uint64 { return c.Panicked }},
+	}
+	for _, c := range counters {
+		ew.printf("# TYPE %s_%s counter\n", namespace, c.name)
+		ew.printf("%s_%s %d\n", namespace, c.name, c.get(s.Totals))
+		for _, sub := range s.Subscriptions {
+			ew.printf("%s_%s{%s} %d\n", namespace, c.name, sub.labels(), c.get(sub.Counters))
+		}
+	}
+
+	ew.printf("# TYPE %s_in_flight gauge\n", namespace)
+	for _, sub := range s.Subscriptions {
+		ew.printf("%s_in_flight{%s} %d\n", namespace, sub.labels(), sub.InFlight)
+	}
+	ew.printf("# TYPE %s_buffered gauge\n", namespace)
+	for _, sub := range s.Subscriptions {
+		ew.printf("%s_buffered{%s} %d\n", namespace, sub.labels(), sub.Buffered)
+	}
+
+	ew.printf("# TYPE %s_handler_seconds histogram\n", namespace)
+	for _, sub := range s.Subscriptions {
+		var cum uint64
+		for i, c := range sub.Latency.Counts {
+			cum += c
+			le := "+Inf"
+			if i < len(sub.Latency.Bounds) {
+				le = fmt.Sprintf("%g", sub.Latency.Bounds[i].Seconds())
+			}
+			ew.printf("%s_handler_seconds_bucket{%s,le=%q} %d\n", namespace, sub.labels(), le, cum)
+		}
+		ew.printf("%s_handler_seconds_sum{%s} %g\n", namespace, sub.labels(), sub.Latency.Sum.Seconds())
+		ew.printf("%s_handler_seconds_count{%s} %d\n", namespace, sub.labels(), sub.Latency.Count)
+	}
+	return ew.err
+}
+
+func (s SubscriptionStats) labels() string {
+	return fmt.Sprintf("sub=%q,pattern=%q", s.ID, s.Pattern)
+}
+
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...any) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
@@ -0,0 +1,101 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+	in := b.(Inspector)
+
+	okID := b.SubscribeFunc("order.*", func(ctx context.Context, evt Event) error {
+		time.Sleep(2 * time.Millisecond)
+		return nil
+	}, EventOptions{})
+	failID := b.SubscribeFunc("order.shipped", func(ctx context.Context, evt Event) error {
+		if dto, _ := DecodeJSON[shippedDTO](evt); dto.OrderID == 2 {
+			panic("boom")
+		}
+		return errors.New("down")
+	}, EventOptions{Async: true, Retry: RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}})
+
+	release := make(chan struct{})
+	slowID := b.SubscribeFunc("order.*", func(ctx context.Context, evt Event) error {
+		<-release
+		return nil
+	}, EventOptions{Async: true, Buffer: 1, DropPolicy: DropNewest})
+
+	subs := in.Subscriptions()
+	if len(subs) != 3 {
+		t.Fatalf("expected 3 subscriptions, got %d", len(subs))
+	}
+
+	byID := func(st BusStats, id string) SubscriptionStats {
+		for _, s := range st.Subscriptions {
+			if s.ID == id {
+				return s
+			}
+		}
+		t.Fatalf("subscription %s not found", id)
+		return SubscriptionStats{}
+	}
+
+	// 先让慢订阅进入执行，之后的事件才能确定地进入缓冲或被丢弃
+	_ = b.Publish(context.Background(), mustNewEvt(t, "order.shipped", 1, 1))
+	waitUntil(t, time.Second, func() bool { return byID(in.Stats(), slowID).InFlight == 1 })
+	for i := 2; i <= 4; i++ {
+		_ = b.Publish(context.Background(), mustNewEvt(t, "order.shipped", i, i))
+	}
+
+	// 慢订阅：1 条执行中，1 条在缓冲，其余被丢弃
+	waitUntil(t, time.Second, func() bool {
+		s := byID(in.Stats(), slowID)
+		return s.InFlight == 1 && s.Buffered == 1 && s.Dropped == 2 && byID(in.Stats(), failID).Failed == 4
+	})
+
+	st := in.Stats()
+	if st.Published != 4 {
+		t.Fatalf("published want 4 got %d", st.Published)
+	}
+	if s := byID(st, okID); s.Delivered != 4 || s.Latency.Count != 4 || s.Latency.Sum < 8*time.Millisecond {
+		t.Fatalf("unexpected ok stats %+v", s)
+	}
+	if s := byID(st, failID); s.Failed != 4 || s.Retried != 4 || s.Panicked != 2 || s.Delivered != 0 {
+		t.Fatalf("unexpected failing stats %+v", s.Counters)
+	}
+	close(release)
+
+	var buf bytes.Buffer
+	if err := st.WritePrometheus(&buf, ""); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"eventbus_published_total 4",
+		`eventbus_dropped_total{sub="` + slowID + `",pattern="order.*"} 2`,
+		`eventbus_handler_seconds_bucket{sub="` + okID + `",pattern="order.*",le="+Inf"} 4`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+
+	b.Unsubscribe(failID)
+	st = in.Stats()
+	if len(st.Subscriptions) != 2 || st.Totals.Failed != 4 {
+		t.Fatalf("totals should survive unsubscribe: %+v", st.Totals)
+	}
+	buf.Reset()
+	if err := st.WritePrometheus(&buf, ""); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "\neventbus_failed_total 4\n") {
+		t.Fatalf("missing bus total in:\n%s", out)
+	}
+}
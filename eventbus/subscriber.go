@@ -2,12 +2,11 @@ package eventbus
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
 	"runtime/debug"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,12 +21,20 @@ type subscriber struct {
 	opt     EventOptions
 	ch      chan job
 	closed  chan struct{}
+	durable bool       // 由 WAL 驱动，不走 ch
+	parts   []chan job // 设置了 OrderingKey 时的顺序分区
+	stats   *stats
+	pending atomic.Int64 // 已进入缓冲尚未处理完的事件数
+
+	pmu    sync.Mutex
+	resume chan struct{} // 非 nil 表示已暂停
+	held   []job         // 关闭时处理协程手中未处理的事件
 }
 
 type bus struct {
-	mu      sync.RWMutex
-	subs    map[string]*subscriber
-	pattern map[string]map[string]bool
+	mu     sync.RWMutex
+	subs   map[string]*subscriber
+	topics *topicNode
 
 	aw      *asyncWorker
 	workers int
@@ -36,7 +43,33 @@ type bus struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	panicHandler PanicHandler
+	panicHandler   PanicHandler
+	deadLetterSink DeadLetterSink
+
+	publishInterceptors []PublishInterceptor
+	handlerInterceptors []HandlerInterceptor
+	publishFn           PublishFunc
+	propagators         []ContextPropagator
+	decodeErrorHandler  DecodeErrorHandler
+
+	walDir       string
+	walSegment   int64
+	walSync      bool
+	walRetention time.Duration
+	wal          *wal
+	walErr       error
+	durables     map[string]string // durable name -> subID
+
+	sched          *scheduler
+	schedulePolicy ScheduleClosePolicy
+
+	stats     *stats
+	published atomic.Uint64
+
+	gate       sync.Mutex
+	closing    bool
+	publishing int
+	idle       chan struct{} // closing 且没有进行中的 Publish 时关闭
 }
 
 type BusOption func(*bus)
@@ -49,22 +82,66 @@ func WithPanicHandler(h PanicHandler) BusOption {
 	return func(b *bus) { b.panicHandler = h }
 }
 
+// WithWAL 开启持久模式：所有发布的事件先追加到 dir 下的分段日志，
+// 设置了 EventOptions.Durable 的订阅者从日志消费并提交 offset，重启后从上次提交处继续
+func WithWAL(dir string) BusOption {
+	return func(b *bus) { b.walDir = dir }
+}
+
+// WithWALSegmentSize 设置单个日志段的最大字节数，默认 64MB
+func WithWALSegmentSize(n int64) BusOption {
+	return func(b *bus) { b.walSegment = n }
+}
+
+// WithWALRetention 设置没有持久订阅者引用的日志段在滚动新段时再保留多久，默认立即删除；
+// 持久订阅不再使用时用 DurableAdmin.DeleteDurable 删除，否则它的 offset 会一直保留日志
+func WithWALRetention(d time.Duration) BusOption {
+	return func(b *bus) { b.walRetention = d }
+}
+
+// WithWALSync 每次追加和提交后都执行 fsync，更可靠但更慢
+func WithWALSync(sync bool) BusOption {
+	return func(b *bus) { b.walSync = sync }
+}
+
 func New(opts ...BusOption) EventBus {
+	b := newBus(opts...)
+	b.publishFn = b.chainPublish(b.publish)
+	if b.walDir != "" {
+		b.wal, b.walErr = openWAL(b.walDir, b.walSegment, b.walSync)
+		if b.walErr != nil {
+			log.Printf("[eventbus] open wal dir=%s err=%v", b.walDir, b.walErr)
+		} else {
+			b.wal.retention = b.walRetention
+		}
+	}
+	store := ""
+	if b.wal != nil {
+		store = scheduleStore(b.walDir)
+	}
+	b.sched = newScheduler(b.publishScheduled, store)
+
+	b.startWorkers()
+	return b
+}
+
+// newBus 只创建并应用选项，不启动 worker，供其他传输实现复用处理器调用逻辑
+func newBus(opts ...BusOption) *bus {
 	ctx, cancel := context.WithCancel(context.Background())
 	b := &bus{
-		subs:    make(map[string]*subscriber),
-		pattern: make(map[string]map[string]bool),
-		aw:      newAsyncWorker(),
-		workers: 4,
-		ctx:     ctx,
-		cancel:  cancel,
+		subs:     make(map[string]*subscriber),
+		topics:   newTopicNode(),
+		durables: make(map[string]string),
+		aw:       newAsyncWorker(),
+		workers:  4,
+		ctx:      ctx,
+		cancel:   cancel,
+		stats:    newStats(),
 	}
 
 	for _, o := range opts {
 		o(b)
 	}
-
-	b.startWorkers()
 	return b
 }
 
@@ -80,6 +157,7 @@ func (b *bus) startWorkers() {
 					return
 				}
 				b.dispatchAsyncJob(j)
+				b.aw.done()
 			}
 		}()
 	}
@@ -88,6 +166,7 @@ func (b *bus) startWorkers() {
 func (b *bus) safeInvoke(s *subscriber, ctx context.Context, evt Event) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
+			b.recordPanicked(s)
 			st := debug.Stack()
 			if b.panicHandler != nil {
 				b.panicHandler(s.id, s.pattern, evt, r, st)
@@ -114,6 +193,10 @@ func (b *bus) Subscribe(pattern string, h EventHandle, opt EventOptions) (subID
 }
 
 func (b *bus) subscribe(pattern string, fn EventFunc, opt EventOptions) (subID string) {
+	if err := ValidatePattern(pattern); err != nil {
+		log.Printf("[eventbus] subscribe rejected: %v", err)
+		return ""
+	}
 	if opt.Buffer <= 0 {
 		opt.Buffer = 256
 	}
@@ -124,41 +207,44 @@ func (b *bus) subscribe(pattern string, fn EventFunc, opt EventOptions) (subID s
 		fn:      fn,
 		opt:     opt,
 		closed:  make(chan struct{}),
+		stats:   newStats(),
 	}
-	if opt.Async {
-		sub.ch = make(chan job, opt.Buffer)
+	if opt.Durable != "" && b.wal != nil {
+		sub.opt.Async = true
+		sub.durable = true
+	}
+	sub.fn = b.chainHandler(sub)
+
+	if sub.durable {
+		b.mu.Lock()
+		if owner, ok := b.durables[opt.Durable]; ok {
+			b.mu.Unlock()
+			log.Printf("[eventbus] durable name %q already used by sub=%s", opt.Durable, owner)
+			return ""
+		}
+		b.durables[opt.Durable] = sub.id
+		b.mu.Unlock()
+
+		from, err := b.wal.cursor(opt.Durable)
+		if err != nil {
+			log.Printf("[eventbus] load cursor durable=%s err=%v", opt.Durable, err)
+			b.mu.Lock()
+			delete(b.durables, opt.Durable)
+			b.mu.Unlock()
+			return ""
+		}
 		b.wg.Add(1)
-		go func(s *subscriber) {
-			defer b.wg.Done()
-			for {
-				select {
-				case <-b.ctx.Done():
-					return
-				case <-s.closed:
-					return
-				case j := <-s.ch:
-					err := b.safeInvoke(s, context.Background(), j.evt)
-					if err != nil {
-						log.Printf("[eventbus] handler error sub=%s pattern=%s key=%s id=%s err=%v",
-							s.id, s.pattern, j.evt.Key(), j.evt.ID(), err)
-					}
-					if s.opt.Once {
-						b.Unsubscribe(s.id)
-						return
-					}
-				}
-			}
-		}(sub)
+		go b.runDurable(sub, from+1)
+	} else if opt.Async {
+		sub.ch = make(chan job, opt.Buffer)
+		b.startAsync(sub)
 	}
 
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	b.subs[sub.id] = sub
-	if _, ok := b.pattern[pattern]; !ok {
-		b.pattern[pattern] = map[string]bool{}
-	}
-	b.pattern[pattern][sub.id] = true
+	b.topics.insert(pattern, sub)
 	return sub.id
 }
 
@@ -172,12 +258,10 @@ func (b *bus) Unsubscribe(subID string) bool {
 	}
 
 	delete(b.subs, subID)
-	if set, ok := b.pattern[sub.pattern]; ok {
-		delete(set, subID)
-		if len(set) == 0 {
-			delete(b.pattern, sub.pattern)
-		}
+	if sub.durable {
+		delete(b.durables, sub.opt.Durable)
 	}
+	b.topics.remove(sub.pattern, subID)
 
 	close(sub.closed)
 	return true
@@ -187,6 +271,32 @@ func (b *bus) Publish(ctx context.Context, evt Event) error {
 	if evt == nil {
 		return nil
 	}
+	if err := b.beginPublish(); err != nil {
+		return err
+	}
+	defer b.endPublish()
+
+	if err := b.publishFn(ctx, evt); err != nil {
+		return err
+	}
+	b.published.Add(1)
+	return nil
+}
+
+func (b *bus) publish(ctx context.Context, evt Event) error {
+	if evt == nil {
+		return nil
+	}
+	evt = b.inject(ctx, evt)
+
+	if b.walErr != nil {
+		return b.walErr
+	}
+	if b.wal != nil {
+		if _, err := b.wal.append(evt); err != nil {
+			return err
+		}
+	}
 
 	subs := b.snapshot(evt.Key())
 	if len(subs) == 0 {
@@ -197,8 +307,8 @@ func (b *bus) Publish(ctx context.Context, evt Event) error {
 	// 同步（按优先级）
 	for _, s := range subs {
 		if !s.opt.Async {
-			if err := b.safeInvoke(s, ctx, evt); err != nil {
-				// 如需 StopOnError，可改为 return err
+			if err := b.deliver(ctx, s, evt); err != nil {
+				// 重试耗尽且没有死信接收端时中止本次发布
 				log.Printf("[eventbus] handler error sub=%s pattern=%s key=%s id=%s err=%v",
 					s.id, s.pattern, evt.Key(), evt.ID(), err)
 				return err
@@ -206,7 +316,10 @@ func (b *bus) Publish(ctx context.Context, evt Event) error {
 			if s.opt.Once {
 				b.Unsubscribe(s.id)
 			}
-		} else {
+		} else if s.ordered() {
+			// 有顺序键的订阅在发布时直接入队，不经过全局优先队列，保证同一发布者的事件顺序
+			b.enqueue(ctx, s, job{evt: evt, priority: s.opt.Priority, ts: time.Now()})
+		} else if !s.durable {
 			hasAsync = true
 		}
 	}
@@ -222,16 +335,24 @@ func (b *bus) Publish(ctx context.Context, evt Event) error {
 }
 
 func (b *bus) Close(ctx context.Context) error {
+	b.stopScheduler()
+	b.stopAccepting()
 	b.cancel()
 	b.aw.close()
 
 	done := make(chan struct{})
-	go func() { b.wg.Wait(); close(done) }()
+	go func() {
+		b.wg.Wait()
+		if b.wal != nil {
+			b.wal.close()
+		}
+		close(done)
+	}()
 	select {
 	case <-done:
 		return nil
 	case <-ctx.Done():
-		return errors.New("event bus close timeout")
+		return errCloseTimeout
 	}
 }
 
@@ -239,24 +360,7 @@ func (b *bus) snapshot(key string) []*subscriber {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	var res []*subscriber
-
-	// 精确匹配
-	for sid := range b.pattern[key] {
-		res = append(res, b.subs[sid])
-	}
-
-	// 前缀通配："order.*" 命中 "order.created"
-	for pat, set := range b.pattern {
-		if strings.HasSuffix(pat, "*") {
-			prefix := strings.TrimSuffix(pat, "*")
-			if strings.HasPrefix(key, prefix) {
-				for sid := range set {
-					res = append(res, b.subs[sid])
-				}
-			}
-		}
-	}
+	res := b.topics.match(key)
 
 	// 同步执行顺序：优先级高在前
 	if len(res) > 1 {
@@ -275,27 +379,43 @@ func (b *bus) snapshot(key string) []*subscriber {
 func (b *bus) dispatchAsyncJob(j job) {
 	subs := b.snapshot(j.evt.Key())
 	for _, s := range subs {
-		if !s.opt.Async {
+		if !s.opt.Async || s.durable || s.ordered() {
 			continue
 		}
+		b.enqueue(b.ctx, s, j)
+	}
+}
 
-		select {
-		case s.ch <- j:
-		default:
-			switch s.opt.DropPolicy {
-			case DropBlock:
-				s.ch <- j
-			case DropNewest:
-				// 丢这条
-			case DropOldest:
-				select {
-				case <-s.ch:
-				default:
-				}
-				select {
-				case s.ch <- j:
-				default:
-				}
+// enqueue 按订阅者的 DropPolicy 写入其缓冲
+func (b *bus) enqueue(ctx context.Context, s *subscriber, j job) {
+	s.pending.Add(1)
+	select {
+	case s.ch <- j:
+	default:
+		switch s.opt.DropPolicy {
+		case DropBlock:
+			select {
+			case s.ch <- j:
+			case <-s.closed:
+				b.dropped(s)
+			case <-b.ctx.Done():
+				b.dropped(s)
+			case <-ctx.Done():
+				b.dropped(s)
+			}
+		case DropNewest:
+			// 丢这条
+			b.dropped(s)
+		case DropOldest:
+			select {
+			case <-s.ch:
+				b.dropped(s)
+			default:
+			}
+			select {
+			case s.ch <- j:
+			default:
+				b.dropped(s)
 			}
 		}
 	}
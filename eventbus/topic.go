@@ -0,0 +1,181 @@
+package eventbus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 主题按 "." 分段，订阅模式支持两种通配段：
+//   - "*"        恰好匹配一段："order.*" 命中 "order.created"，不命中 "order.item.refunded"
+//   - "#" / "**" 匹配零或多段："order.#" 命中 "order"、"order.created"、"order.item.refunded"
+const (
+	topicSep     = "."
+	wildcardOne  = "*"
+	wildcardMany = "#"
+)
+
+var ErrInvalidPattern = errors.New("eventbus: invalid pattern")
+
+// ValidatePattern 校验订阅模式：不能为空、不能有空段，通配符必须独占一段
+func ValidatePattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidPattern)
+	}
+	for _, seg := range strings.Split(pattern, topicSep) {
+		switch {
+		case seg == "":
+			return fmt.Errorf("%w: %q has empty segment", ErrInvalidPattern, pattern)
+		case seg == wildcardOne, seg == wildcardMany, seg == "**":
+		case strings.ContainsAny(seg, "*#"):
+			return fmt.Errorf("%w: %q wildcard must be a whole segment", ErrInvalidPattern, pattern)
+		}
+	}
+	return nil
+}
+
+// MatchPattern 判断 key 是否命中 pattern，语义与订阅匹配一致
+func MatchPattern(pattern, key string) bool {
+	return matchSegments(splitPattern(pattern), strings.Split(key, topicSep))
+}
+
+func splitPattern(pattern string) []string {
+	segs := strings.Split(pattern, topicSep)
+	for i, seg := range segs {
+		if seg == "**" {
+			segs[i] = wildcardMany
+		}
+	}
+	return segs
+}
+
+func matchSegments(pat, key []string) bool {
+	if len(pat) == 0 {
+		return len(key) == 0
+	}
+	switch pat[0] {
+	case wildcardMany:
+		for i := 0; i <= len(key); i++ {
+			if matchSegments(pat[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case wildcardOne:
+		return len(key) > 0 && matchSegments(pat[1:], key[1:])
+	default:
+		return len(key) > 0 && pat[0] == key[0] && matchSegments(pat[1:], key[1:])
+	}
+}
+
+// topicNode 订阅模式前缀树，查找开销只与主题段数和通配分支相关，与订阅数量无关
+type topicNode struct {
+	children map[string]*topicNode
+	one      *topicNode // "*"
+	many     *topicNode // "#"
+	subs     map[string]*subscriber
+}
+
+func newTopicNode() *topicNode {
+	return &topicNode{}
+}
+
+func (n *topicNode) insert(pattern string, s *subscriber) {
+	cur := n
+	for _, seg := range splitPattern(pattern) {
+		cur = cur.child(seg, true)
+	}
+	if cur.subs == nil {
+		cur.subs = make(map[string]*subscriber)
+	}
+	cur.subs[s.id] = s
+}
+
+func (n *topicNode) remove(pattern string, subID string) {
+	n.removeSegments(splitPattern(pattern), subID)
+}
+
+// removeSegments 删除订阅并回收空节点，返回当前节点是否已为空
+func (n *topicNode) removeSegments(segs []string, subID string) bool {
+	if len(segs) == 0 {
+		delete(n.subs, subID)
+		return n.empty()
+	}
+
+	c := n.child(segs[0], false)
+	if c == nil {
+		return n.empty()
+	}
+	if c.removeSegments(segs[1:], subID) {
+		switch segs[0] {
+		case wildcardOne:
+			n.one = nil
+		case wildcardMany:
+			n.many = nil
+		default:
+			delete(n.children, segs[0])
+		}
+	}
+	return n.empty()
+}
+
+func (n *topicNode) empty() bool {
+	return len(n.subs) == 0 && len(n.children) == 0 && n.one == nil && n.many == nil
+}
+
+func (n *topicNode) child(seg string, create bool) *topicNode {
+	switch seg {
+	case wildcardOne:
+		if n.one == nil && create {
+			n.one = newTopicNode()
+		}
+		return n.one
+	case wildcardMany:
+		if n.many == nil && create {
+			n.many = newTopicNode()
+		}
+		return n.many
+	default:
+		c := n.children[seg]
+		if c == nil && create {
+			if n.children == nil {
+				n.children = make(map[string]*topicNode)
+			}
+			c = newTopicNode()
+			n.children[seg] = c
+		}
+		return c
+	}
+}
+
+// match 返回命中 key 的所有订阅者（已去重）
+func (n *topicNode) match(key string) []*subscriber {
+	seen := make(map[string]*subscriber)
+	n.collect(strings.Split(key, topicSep), seen)
+
+	res := make([]*subscriber, 0, len(seen))
+	for _, s := range seen {
+		res = append(res, s)
+	}
+	return res
+}
+
+func (n *topicNode) collect(segs []string, seen map[string]*subscriber) {
+	if n.many != nil {
+		for i := 0; i <= len(segs); i++ {
+			n.many.collect(segs[i:], seen)
+		}
+	}
+	if len(segs) == 0 {
+		for id, s := range n.subs {
+			seen[id] = s
+		}
+		return
+	}
+	if c := n.children[segs[0]]; c != nil {
+		c.collect(segs[1:], seen)
+	}
+	if n.one != nil {
+		n.one.collect(segs[1:], seen)
+	}
+}
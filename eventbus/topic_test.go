@@ -0,0 +1,124 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"order.created", "order.created", true},
+		{"order.created", "order.updated", false},
+		{"order.*", "order.created", true},
+		{"order.*", "order.item.refunded", false},
+		{"order.*", "order", false},
+		{"order.*.refunded", "order.item.refunded", true},
+		{"order.*.refunded", "order.item.created", false},
+		{"order.#", "order", true},
+		{"order.#", "order.item.refunded", true},
+		{"order.**", "order.item", true},
+		{"#", "anything.at.all", true},
+		{"#.refunded", "order.item.refunded", true},
+		{"#.refunded", "order.item.created", false},
+		{"order.#.refunded", "order.refunded", true},
+		{"*.*", "a.b", true},
+		{"*.*", "a.b.c", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s", tt.pattern, tt.key), func(t *testing.T) {
+			if got := MatchPattern(tt.pattern, tt.key); got != tt.want {
+				t.Fatalf("MatchPattern(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+			}
+
+			// 前缀树与逐段匹配结果必须一致
+			root := newTopicNode()
+			root.insert(tt.pattern, &subscriber{id: "s"})
+			if got := len(root.match(tt.key)) == 1; got != tt.want {
+				t.Fatalf("trie match(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"order.created", true},
+		{"order.*", true},
+		{"order.#", true},
+		{"order.**", true},
+		{"", false},
+		{"order..created", false},
+		{"order.", false},
+		{"order.cre*", false},
+		{"order.#x", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidatePattern(tt.pattern)
+		if (err == nil) != tt.valid {
+			t.Fatalf("ValidatePattern(%q) err=%v, want valid=%v", tt.pattern, err, tt.valid)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidPattern) {
+			t.Fatalf("expected ErrInvalidPattern, got %v", err)
+		}
+	}
+
+	b := New()
+	defer b.Close(context.Background())
+	if id := b.SubscribeFunc("order.cre*", func(ctx context.Context, evt Event) error { return nil }, EventOptions{}); id != "" {
+		t.Fatalf("invalid pattern should be rejected")
+	}
+}
+
+func TestTopicTrieRemove(t *testing.T) {
+	root := newTopicNode()
+	root.insert("a.*.c", &subscriber{id: "1"})
+	root.insert("a.#", &subscriber{id: "2"})
+	root.insert("a.b.c", &subscriber{id: "3"})
+
+	ids := func(key string) []string {
+		var res []string
+		for _, s := range root.match(key) {
+			res = append(res, s.id)
+		}
+		sort.Strings(res)
+		return res
+	}
+	if got := fmt.Sprint(ids("a.b.c")); got != "[1 2 3]" {
+		t.Fatalf("match a.b.c = %s", got)
+	}
+
+	root.remove("a.*.c", "1")
+	root.remove("a.b.c", "3")
+	if got := fmt.Sprint(ids("a.b.c")); got != "[2]" {
+		t.Fatalf("match after remove = %s", got)
+	}
+	root.remove("a.#", "2")
+	if !root.empty() {
+		t.Fatalf("trie should be pruned to empty root")
+	}
+}
+
+func BenchmarkTopicMatch(b *testing.B) {
+	root := newTopicNode()
+	for i := 0; i < 500; i++ {
+		root.insert(fmt.Sprintf("svc%d.order.*", i), &subscriber{id: fmt.Sprint(i)})
+	}
+	root.insert("#.refunded", &subscriber{id: "all"})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.match("svc42.order.refunded")
+	}
+}
@@ -0,0 +1,139 @@
+package eventbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+var ErrInvalidTraceParent = errors.New("eventbus: invalid traceparent")
+
+// TraceContext W3C Trace Context（https://www.w3.org/TR/trace-context/）
+type TraceContext struct {
+	TraceID string // 32 位小写十六进制
+	SpanID  string // 16 位小写十六进制，即 traceparent 中的 parent-id
+	Flags   byte   // trace-flags，0x01 表示采样
+	State   string // tracestate，原样传递
+}
+
+type traceCtxKey struct{}
+
+// NewTraceContext 生成新的根 trace
+func NewTraceContext(sampled bool) TraceContext {
+	tc := TraceContext{TraceID: randomHex(16), SpanID: randomHex(8)}
+	if sampled {
+		tc.Flags = 0x01
+	}
+	return tc
+}
+
+// Child 返回同一 trace 下的新 span
+func (tc TraceContext) Child() TraceContext {
+	tc.SpanID = randomHex(8)
+	return tc
+}
+
+// Sampled 是否被采样
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&0x01 != 0
+}
+
+// TraceParent 返回 traceparent 头的值
+func (tc TraceContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// ParseTraceParent 解析 traceparent 头
+func ParseTraceParent(s string) (TraceContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 {
+		return TraceContext{}, ErrInvalidTraceParent
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || !isHex(version) {
+		return TraceContext{}, ErrInvalidTraceParent
+	}
+	// 版本 00 必须恰好 4 段，更高版本允许追加字段
+	if version == "00" && len(parts) != 4 {
+		return TraceContext{}, ErrInvalidTraceParent
+	}
+	if len(traceID) != 32 || !isHex(traceID) || traceID == strings.Repeat("0", 32) {
+		return TraceContext{}, ErrInvalidTraceParent
+	}
+	if len(spanID) != 16 || !isHex(spanID) || spanID == strings.Repeat("0", 16) {
+		return TraceContext{}, ErrInvalidTraceParent
+	}
+	if len(flags) != 2 || !isHex(flags) {
+		return TraceContext{}, ErrInvalidTraceParent
+	}
+	b, _ := hex.DecodeString(flags)
+	return TraceContext{TraceID: traceID, SpanID: spanID, Flags: b[0]}, nil
+}
+
+// ContextWithTrace 把 trace 放入 ctx
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceCtxKey{}, tc)
+}
+
+// TraceFromContext 从 ctx 取出 trace
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceCtxKey{}).(TraceContext)
+	return tc, ok
+}
+
+// TracePropagator 按 W3C 规范传播 traceparent/tracestate；
+// 处理器 ctx 中的 TraceContext 即发布方的 span，处理器可用 Child() 派生自己的 span
+func TracePropagator() ContextPropagator {
+	return tracePropagator{}
+}
+
+type tracePropagator struct{}
+
+func (tracePropagator) Inject(ctx context.Context, h Headers) {
+	tc, ok := TraceFromContext(ctx)
+	if !ok {
+		return
+	}
+	h[HeaderTraceParent] = tc.TraceParent()
+	if tc.State != "" {
+		h[HeaderTraceState] = tc.State
+	}
+}
+
+func (tracePropagator) Extract(ctx context.Context, h Headers) context.Context {
+	tc, err := ParseTraceParent(h[HeaderTraceParent])
+	if err != nil {
+		return ctx
+	}
+	tc.State = h[HeaderTraceState]
+	return ContextWithTrace(ctx, tc)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	for {
+		_, _ = rand.Read(b)
+		for _, c := range b {
+			if c != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,522 @@
+package eventbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	walSegmentExt       = ".wal"
+	walCursorExt        = ".offset"
+	walCursorDir        = "cursors"
+	walFrameHeader      = 8
+	defaultSegmentBytes = 64 << 20
+)
+
+var (
+	ErrWALClosed   = errors.New("eventbus: wal closed")
+	ErrWALCorrupt  = errors.New("eventbus: wal corrupt record")
+	ErrWALDisabled = errors.New("eventbus: wal not enabled")
+)
+
+// walRecord 是落盘的事件记录，Offset 从 1 开始单调递增
+type walRecord struct {
+	Offset  uint64    `json:"o"`
+	Key     string    `json:"k"`
+	ID      string    `json:"i"`
+	At      time.Time `json:"t"`
+	Payload []byte    `json:"p,omitempty"`
+	Headers Headers   `json:"h,omitempty"`
+}
+
+func (r *walRecord) event() Event {
+	return RestoreEvent(r.Key, r.ID, r.At, r.Payload, r.Headers)
+}
+
+type walSegment struct {
+	base uint64 // 段内第一条记录的 offset
+	path string
+}
+
+// wal 分段追加日志：
+//   - <dir>/<base>.wal       段文件，帧格式为 [len uint32][crc32 uint32][json body]
+//   - <dir>/cursors/<name>.offset  各持久订阅者已提交的 offset
+type wal struct {
+	mu         sync.RWMutex
+	dir        string
+	maxBytes   int64
+	sync       bool
+	segments   []walSegment
+	active     *os.File
+	activeSize int64
+	next       uint64
+	notify     chan struct{}
+	cursors    map[string]uint64
+	retention  time.Duration // 没有持久订阅者引用的段保留多久，0 表示立即删除
+	closed     bool
+}
+
+func openWAL(dir string, maxBytes int64, syncWrites bool) (*wal, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultSegmentBytes
+	}
+	if err := os.MkdirAll(filepath.Join(dir, walCursorDir), 0755); err != nil {
+		return nil, fmt.Errorf("eventbus: create wal dir %s failed: %w", dir, err)
+	}
+
+	w := &wal{
+		dir:      dir,
+		maxBytes: maxBytes,
+		sync:     syncWrites,
+		next:     1,
+		notify:   make(chan struct{}),
+		cursors:  map[string]uint64{},
+	}
+	if err := w.loadSegments(); err != nil {
+		return nil, err
+	}
+	if err := w.loadCursors(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *wal) loadSegments() error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, walSegmentExt) {
+			continue
+		}
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, walSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.segments = append(w.segments, walSegment{base: base, path: filepath.Join(w.dir, name)})
+	}
+	sort.Slice(w.segments, func(i, j int) bool { return w.segments[i].base < w.segments[j].base })
+
+	if len(w.segments) == 0 {
+		return w.roll()
+	}
+
+	// 只有最后一段可能在崩溃时写了一半，扫描并截断尾部的残缺帧
+	last := w.segments[len(w.segments)-1]
+	f, err := os.OpenFile(last.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	w.next = last.base
+	r := bufio.NewReader(f)
+	var good int64
+	for {
+		rec, n, err := readFrame(r)
+		if err != nil {
+			break
+		}
+		good += n
+		w.next = rec.Offset + 1
+	}
+	if err := f.Truncate(good); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	w.active = f
+	w.activeSize = good
+	return nil
+}
+
+func (w *wal) loadCursors() error {
+	dir := filepath.Join(w.dir, walCursorDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), walCursorExt) {
+			continue
+		}
+		name, err := url.PathUnescape(strings.TrimSuffix(e.Name(), walCursorExt))
+		if err != nil {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		off, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			return fmt.Errorf("eventbus: bad cursor %s: %w", e.Name(), err)
+		}
+		w.cursors[name] = off
+	}
+	return nil
+}
+
+// roll 关闭当前段并以 w.next 为 base 新建一段。调用方需持有写锁（或处于初始化阶段）
+func (w *wal) roll() error {
+	if w.active != nil {
+		if err := w.active.Sync(); err != nil {
+			return err
+		}
+		if err := w.active.Close(); err != nil {
+			return err
+		}
+	}
+
+	seg := walSegment{base: w.next, path: filepath.Join(w.dir, fmt.Sprintf("%020d%s", w.next, walSegmentExt))}
+	f, err := os.OpenFile(seg.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.segments = append(w.segments, seg)
+	w.active = f
+	w.activeSize = 0
+	w.compact()
+	return nil
+}
+
+// compact 删除没有持久订阅者引用的旧段（所有订阅者都已提交，或者没有任何订阅者），
+// 新的持久订阅者从日志尾部开始，不会再读到它们；段在超过 retention 后才删除，活动段永远保留
+func (w *wal) compact() {
+	low := w.next - 1
+	for _, off := range w.cursors {
+		if off < low {
+			low = off
+		}
+	}
+
+	keep := 0
+	for keep < len(w.segments)-1 && w.segments[keep+1].base <= low+1 {
+		if !w.expired(w.segments[keep]) {
+			break
+		}
+		os.Remove(w.segments[keep].path)
+		keep++
+	}
+	w.segments = w.segments[keep:]
+}
+
+// expired 判断不再被引用的段是否已超过保留时长，段的修改时间即最后一次写入的时间
+func (w *wal) expired(seg walSegment) bool {
+	if w.retention <= 0 {
+		return true
+	}
+	info, err := os.Stat(seg.path)
+	return err != nil || time.Since(info.ModTime()) >= w.retention
+}
+
+func (w *wal) append(evt Event) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrWALClosed
+	}
+
+	rec := walRecord{
+		Offset:  w.next,
+		Key:     evt.Key(),
+		ID:      evt.ID(),
+		At:      evt.At(),
+		Payload: evt.Payload(),
+		Headers: HeadersOf(evt),
+	}
+	frame, err := encodeFrame(&rec)
+	if err != nil {
+		return 0, err
+	}
+	if w.activeSize > 0 && w.activeSize+int64(len(frame)) > w.maxBytes {
+		if err := w.roll(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := w.active.Write(frame); err != nil {
+		return 0, err
+	}
+	if w.sync {
+		if err := w.active.Sync(); err != nil {
+			return 0, err
+		}
+	}
+
+	w.activeSize += int64(len(frame))
+	w.next++
+	close(w.notify)
+	w.notify = make(chan struct{})
+	return rec.Offset, nil
+}
+
+// lastOffset 返回已完整写入的最大 offset，0 表示日志为空
+func (w *wal) lastOffset() uint64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.next - 1
+}
+
+// changed 返回一个在下一次 append 后关闭的 channel
+func (w *wal) changed() <-chan struct{} {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.notify
+}
+
+// cursor 返回持久订阅者已提交的 offset；首次出现的名字从当前日志尾部开始
+func (w *wal) cursor(name string) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if off, ok := w.cursors[name]; ok {
+		return off, nil
+	}
+	off := w.next - 1
+	if err := w.writeCursor(name, off); err != nil {
+		return 0, err
+	}
+	w.cursors[name] = off
+	return off, nil
+}
+
+func (w *wal) commit(name string, off uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrWALClosed
+	}
+	if off <= w.cursors[name] {
+		return nil
+	}
+	if err := w.writeCursor(name, off); err != nil {
+		return err
+	}
+	w.cursors[name] = off
+	return nil
+}
+
+// deleteCursor 删除持久订阅者的 offset，之后它不再阻止旧段被清理
+func (w *wal) deleteCursor(name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrWALClosed
+	}
+	if _, ok := w.cursors[name]; !ok {
+		return nil
+	}
+	if err := os.Remove(w.cursorPath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(w.cursors, name)
+	w.compact()
+	return nil
+}
+
+func (w *wal) cursorPath(name string) string {
+	return filepath.Join(w.dir, walCursorDir, url.PathEscape(name)+walCursorExt)
+}
+
+func (w *wal) writeCursor(name string, off uint64) error {
+	path := w.cursorPath(name)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(strconv.FormatUint(off, 10)); err != nil {
+		f.Close()
+		return err
+	}
+	if w.sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// segmentFor 返回包含 off 的段；off 已被清理时返回最早的段
+func (w *wal) segmentFor(off uint64) (walSegment, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if len(w.segments) == 0 {
+		return walSegment{}, false
+	}
+	i := sort.Search(len(w.segments), func(i int) bool { return w.segments[i].base > off })
+	if i == 0 {
+		return w.segments[0], true
+	}
+	return w.segments[i-1], true
+}
+
+// segmentAfter 返回 base 之后的下一段
+func (w *wal) segmentAfter(base uint64) (walSegment, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for _, s := range w.segments {
+		if s.base > base {
+			return s, true
+		}
+	}
+	return walSegment{}, false
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	close(w.notify)
+	if err := w.active.Sync(); err != nil {
+		w.active.Close()
+		return err
+	}
+	return w.active.Close()
+}
+
+func (w *wal) newReader(from uint64) *walReader {
+	return &walReader{w: w, next: from}
+}
+
+// walReader 顺序读取日志，只会读到 lastOffset 为止，保证不会读到写了一半的帧
+type walReader struct {
+	w    *wal
+	next uint64
+	seg  walSegment
+	f    *os.File
+	r    *bufio.Reader
+}
+
+// read 返回下一条记录；没有新记录时 ok 为 false
+func (wr *walReader) read() (rec *walRecord, ok bool, err error) {
+	for {
+		if wr.next > wr.w.lastOffset() {
+			return nil, false, nil
+		}
+
+		if wr.f == nil {
+			seg, found := wr.w.segmentFor(wr.next)
+			if !found {
+				return nil, false, nil
+			}
+			if err := wr.open(seg); err != nil {
+				return nil, false, err
+			}
+		}
+
+		rec, _, err := readFrame(wr.r)
+		if errors.Is(err, io.EOF) {
+			seg, found := wr.w.segmentAfter(wr.seg.base)
+			if !found {
+				return nil, false, fmt.Errorf("%w: offset %d missing", ErrWALCorrupt, wr.next)
+			}
+			if err := wr.open(seg); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if rec.Offset < wr.next {
+			continue
+		}
+
+		wr.next = rec.Offset + 1
+		return rec, true, nil
+	}
+}
+
+// rewind 回到 off 重新读取，下一次 read 时重新定位段
+func (wr *walReader) rewind(off uint64) {
+	wr.close()
+	wr.next = off
+}
+
+func (wr *walReader) open(seg walSegment) error {
+	wr.close()
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	wr.seg = seg
+	wr.f = f
+	wr.r = bufio.NewReader(f)
+	if wr.next < seg.base {
+		wr.next = seg.base
+	}
+	return nil
+}
+
+func (wr *walReader) close() {
+	if wr.f != nil {
+		wr.f.Close()
+		wr.f = nil
+		wr.r = nil
+	}
+}
+
+func encodeFrame(rec *walRecord) ([]byte, error) {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, walFrameHeader+len(body))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(body))
+	copy(frame[walFrameHeader:], body)
+	return frame, nil
+}
+
+func readFrame(r io.Reader) (*walRecord, int64, error) {
+	var hdr [walFrameHeader]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, ErrWALCorrupt
+		}
+		return nil, 0, err
+	}
+	size := binary.BigEndian.Uint32(hdr[0:4])
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, ErrWALCorrupt
+	}
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(hdr[4:8]) {
+		return nil, 0, ErrWALCorrupt
+	}
+	var rec walRecord
+	if err := json.Unmarshal(body, &rec); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrWALCorrupt, err)
+	}
+	return &rec, int64(walFrameHeader + size), nil
+}
@@ -0,0 +1,289 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDurableReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// 第一次启动：注册持久订阅，处理前两条后“崩溃”
+	b := New(WithWAL(dir))
+	block := make(chan struct{})
+	var mu sync.Mutex
+	var got []int
+	id := b.SubscribeFunc("order.*", func(ctx context.Context, evt Event) error {
+		dto, _ := DecodeJSON[shippedDTO](evt)
+		mu.Lock()
+		got = append(got, dto.OrderID)
+		n := len(got)
+		mu.Unlock()
+		if n == 2 {
+			<-block
+		}
+		return nil
+	}, EventOptions{Durable: "shipping"})
+	if id == "" {
+		t.Fatalf("durable subscribe failed")
+	}
+
+	for i := 1; i <= 5; i++ {
+		if err := b.Publish(context.Background(), mustNewEvt(t, "order.shipped", i, 0)); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	waitUntil(t, time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 2
+	})
+	// 不放行 block：第二条永远不会被提交，相当于进程在处理中途崩溃
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_ = b.Close(ctx)
+	cancel()
+
+	// 第二次启动：同名订阅从第 2 条（未提交）开始重放
+	b2 := New(WithWAL(dir))
+	defer b2.Close(context.Background())
+
+	var replay []int
+	b2.SubscribeFunc("order.*", func(ctx context.Context, evt Event) error {
+		dto, _ := DecodeJSON[shippedDTO](evt)
+		mu.Lock()
+		replay = append(replay, dto.OrderID)
+		mu.Unlock()
+		return nil
+	}, EventOptions{Durable: "shipping"})
+
+	waitUntil(t, time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(replay) == 4
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	for i, v := range []int{2, 3, 4, 5} {
+		if replay[i] != v {
+			t.Fatalf("replay order wrong: %v", replay)
+		}
+	}
+}
+
+func TestDurableNewNameStartsAtTail(t *testing.T) {
+	dir := t.TempDir()
+	b := New(WithWAL(dir))
+	defer b.Close(context.Background())
+
+	_ = b.Publish(context.Background(), mustNewEvt(t, "user.created", 1, 1))
+
+	var mu sync.Mutex
+	var got []int
+	b.SubscribeFunc("user.created", func(ctx context.Context, evt Event) error {
+		dto, _ := DecodeJSON[shippedDTO](evt)
+		mu.Lock()
+		got = append(got, dto.OrderID)
+		mu.Unlock()
+		return nil
+	}, EventOptions{Durable: "mailer"})
+
+	if id := b.SubscribeFunc("user.created", func(ctx context.Context, evt Event) error { return nil },
+		EventOptions{Durable: "mailer"}); id != "" {
+		t.Fatalf("duplicate durable name should be rejected")
+	}
+
+	_ = b.Publish(context.Background(), mustNewEvt(t, "user.created", 2, 2))
+	waitUntil(t, time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 1
+	})
+	if got[0] != 2 {
+		t.Fatalf("new durable name should start at tail, got %v", got)
+	}
+}
+
+func TestWALSegmentsAndRecovery(t *testing.T) {
+	dir := t.TempDir()
+	w, err := openWAL(dir, 256, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 持久订阅者的 offset 保留它尚未提交的段
+	if _, err := w.cursor("c"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := w.append(mustNewEvt(t, "a.b", i, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(w.segments) < 2 {
+		t.Fatalf("expected segment roll, got %d segments", len(w.segments))
+	}
+
+	r := w.newReader(1)
+	for i := 1; i <= 20; i++ {
+		rec, ok, err := r.read()
+		if err != nil || !ok {
+			t.Fatalf("read %d: ok=%v err=%v", i, ok, err)
+		}
+		if rec.Offset != uint64(i) {
+			t.Fatalf("offset want %d got %d", i, rec.Offset)
+		}
+	}
+	if _, ok, _ := r.read(); ok {
+		t.Fatalf("expected end of log")
+	}
+	r.close()
+
+	// 提交后再滚动，旧段应被清理
+	before := len(w.segments)
+	if err := w.commit("c", 20); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		_, _ = w.append(mustNewEvt(t, "a.b", i, i))
+	}
+	if len(w.segments) >= before {
+		t.Fatalf("expected compaction, before=%d after=%d", before, len(w.segments))
+	}
+	last := w.segments[len(w.segments)-1].path
+	_ = w.close()
+
+	// 模拟写到一半崩溃：尾部追加残缺帧
+	f, _ := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0644)
+	_, _ = f.Write([]byte{0, 0, 1, 0, 1, 2})
+	f.Close()
+
+	w2, err := openWAL(dir, 256, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w2.close()
+	if w2.lastOffset() != 25 {
+		t.Fatalf("last offset want 25 got %d", w2.lastOffset())
+	}
+	if off, _ := w2.cursor("c"); off != 20 {
+		t.Fatalf("cursor want 20 got %d", off)
+	}
+	if _, err := os.Stat(filepath.Join(dir, walCursorDir, "c"+walCursorExt)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWALCompactUnreferencedSegments(t *testing.T) {
+	w, err := openWAL(t.TempDir(), 256, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+
+	// 没有持久订阅者时旧段不再被引用，滚动时即删除
+	for i := 0; i < 20; i++ {
+		if _, err := w.append(mustNewEvt(t, "a.b", i, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(w.segments) != 1 {
+		t.Fatalf("expected only the active segment, got %d", len(w.segments))
+	}
+
+	// 设置了保留时长时先保留
+	w.retention = time.Hour
+	for i := 0; i < 20; i++ {
+		_, _ = w.append(mustNewEvt(t, "a.b", i, i))
+	}
+	if len(w.segments) < 2 {
+		t.Fatalf("expected segments to be retained, got %d", len(w.segments))
+	}
+
+	// 删除 offset 后，它不再保留日志
+	w.retention = 0
+	if _, err := w.cursor("gone"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		_, _ = w.append(mustNewEvt(t, "a.b", i, i))
+	}
+	held := len(w.segments)
+	if err := w.deleteCursor("gone"); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.segments) != 1 || held < 2 {
+		t.Fatalf("expected the cursor to hold segments until deleted, got %d then %d", held, len(w.segments))
+	}
+	if _, err := os.Stat(w.cursorPath("gone")); !os.IsNotExist(err) {
+		t.Fatalf("expected the cursor file to be removed, got %v", err)
+	}
+}
+
+func TestDeleteDurable(t *testing.T) {
+	b := New(WithWAL(t.TempDir()))
+	defer b.Close(context.Background())
+
+	admin := b.(DurableAdmin)
+	id := b.SubscribeFunc("a.*", func(ctx context.Context, evt Event) error { return nil }, EventOptions{Durable: "audit"})
+	if err := admin.DeleteDurable("audit"); !errors.Is(err, ErrDurableInUse) {
+		t.Fatalf("expected ErrDurableInUse, got %v", err)
+	}
+	b.Unsubscribe(id)
+	if err := admin.DeleteDurable("audit"); err != nil {
+		t.Fatal(err)
+	}
+	w := b.(*bus).wal
+	w.mu.RLock()
+	_, ok := w.cursors["audit"]
+	w.mu.RUnlock()
+	if ok {
+		t.Fatal("expected the cursor to be deleted")
+	}
+
+	if err := New().(DurableAdmin).DeleteDurable("audit"); !errors.Is(err, ErrWALDisabled) {
+		t.Fatalf("expected ErrWALDisabled, got %v", err)
+	}
+}
+
+func TestDurableRedeliversFailedEvent(t *testing.T) {
+	dir := t.TempDir()
+	b := New(WithWAL(dir))
+
+	var mu sync.Mutex
+	var got []int
+	b.SubscribeFunc("order.*", func(ctx context.Context, evt Event) error {
+		dto, _ := DecodeJSON[shippedDTO](evt)
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, dto.OrderID)
+		if len(got) <= 2 {
+			return errors.New("db down")
+		}
+		return nil
+	}, EventOptions{Durable: "shipping", Retry: RetryPolicy{InitialBackoff: 5 * time.Millisecond}})
+
+	_ = b.Publish(context.Background(), mustNewEvt(t, "order.shipped", 1, 0))
+	_ = b.Publish(context.Background(), mustNewEvt(t, "order.shipped", 2, 0))
+	waitUntil(t, 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 4
+	})
+	mu.Lock()
+	if fmt.Sprint(got) != "[1 1 1 2]" {
+		t.Fatalf("expected the failed event to be redelivered in order, got %v", got)
+	}
+	mu.Unlock()
+	w := b.(*bus).wal
+	waitUntil(t, time.Second, func() bool {
+		w.mu.RLock()
+		defer w.mu.RUnlock()
+		return w.cursors["shipping"] == 2
+	})
+	_ = b.Close(context.Background())
+}
@@ -10,6 +10,7 @@ type asyncWorker struct {
 	cond   *sync.Cond
 	closed bool
 	queue  prioQueue
+	active int // 已取出尚未分发完的任务数
 }
 
 func newAsyncWorker() *asyncWorker {
@@ -41,9 +42,35 @@ func (aw *asyncWorker) pop() (job, bool) {
 	}
 
 	it := heap.Pop(&aw.queue).(*prioItem)
+	aw.active++
 	return it.value, true
 }
 
+// done 标记 pop 取出的任务已分发完
+func (aw *asyncWorker) done() {
+	aw.mu.Lock()
+	aw.active--
+	aw.mu.Unlock()
+}
+
+// idle 队列为空且没有正在分发的任务
+func (aw *asyncWorker) idle() bool {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	return aw.queue.Len() == 0 && aw.active == 0
+}
+
+// drain 取出队列中剩余的全部任务，用于关闭时上报
+func (aw *asyncWorker) drain() []job {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	res := make([]job, 0, aw.queue.Len())
+	for aw.queue.Len() > 0 {
+		res = append(res, heap.Pop(&aw.queue).(*prioItem).value)
+	}
+	return res
+}
+
 func (aw *asyncWorker) close() {
 	aw.mu.Lock()
 	aw.closed = true
@@ -18,7 +18,7 @@ type FileMutex struct {
 func MakeFileMutex(filename string) *FileMutex {
 	file, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0777)
 	if err != nil {
-		return &FileMutex{file: nil}
+		return &FileMutex{file: nil, mutex: &sync.Mutex{}}
 	}
 	mutex := &sync.Mutex{}
 	return &FileMutex{file: file, mutex: mutex}
@@ -0,0 +1,406 @@
+package process
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIVersion is the version prefix of the control API routes.
+const APIVersion = "v1"
+
+// Timeouts of the control API connections, used when APIConfig leaves them empty.
+const (
+	DefaultAPIReadTimeout  = 30 * time.Second
+	DefaultAPIWriteTimeout = 5 * time.Minute // long enough for rolling restarts and manifests waiting on readiness
+	DefaultAPIIdleTimeout  = 2 * time.Minute
+)
+
+// maxAPIBody is the largest request body accepted by the control API.
+const maxAPIBody = 1 << 20
+
+// Permissions granted to API tokens and client certificates.
+const (
+	PermissionRead  = "read"  // status, logs and manifest diffs
+	PermissionWrite = "write" // everything, including starting arbitrary commands
+)
+
+// APIToken is a bearer token accepted by the control API.
+type APIToken struct {
+	Token      string // Token is the secret sent in the Authorization header.
+	Permission string // Permission is read or write.
+}
+
+// APIConfig configures the listeners and the authentication of the control API.
+// At least one listener and one way to authenticate are required, and tokens are only
+// sent in clear text to loopback addresses and unix sockets.
+type APIConfig struct {
+	Addr       string // Addr is the tcp address to listen on, ie: 127.0.0.1:9999. Empty disables it.
+	SocketPath string // SocketPath is the unix socket to listen on. Empty disables it.
+
+	Tokens []APIToken // Tokens are the accepted bearer tokens.
+
+	CertFile          string            // CertFile enables TLS on Addr together with KeyFile.
+	KeyFile           string            // KeyFile is the private key of CertFile.
+	ClientCAFile      string            // ClientCAFile verifies client certificates, enabling mTLS.
+	RequireClientCert bool              // RequireClientCert rejects connections without a valid client certificate.
+	ClientCerts       map[string]string // ClientCerts grants a permission to verified client certificates by common name.
+
+	ReadTimeout  time.Duration // ReadTimeout bounds reading a request and its body, zero means DefaultAPIReadTimeout.
+	WriteTimeout time.Duration // WriteTimeout bounds handling a request and writing its response, zero means DefaultAPIWriteTimeout.
+	IdleTimeout  time.Duration // IdleTimeout closes keep-alive connections idle for longer, zero means DefaultAPIIdleTimeout.
+}
+
+// Validate will check the config enables a listener and some authentication.
+// Returns an error in case there's any.
+func (config *APIConfig) Validate() error {
+	if config.Addr == "" && config.SocketPath == "" {
+		return errors.New("api needs an address or a socket path")
+	}
+	if len(config.Tokens) == 0 && len(config.ClientCerts) == 0 {
+		return errors.New("api needs tokens or client certificates to authenticate requests")
+	}
+	for _, t := range config.Tokens {
+		if t.Token == "" {
+			return errors.New("api token can not be empty")
+		}
+		if !validPermission(t.Permission) {
+			return fmt.Errorf("unknown permission %q", t.Permission)
+		}
+	}
+	for cn, permission := range config.ClientCerts {
+		if !validPermission(permission) {
+			return fmt.Errorf("unknown permission %q for client certificate %s", permission, cn)
+		}
+	}
+	if len(config.ClientCerts) > 0 && config.ClientCAFile == "" {
+		return errors.New("client certificates need a client CA file")
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return errors.New("tls needs both a certificate and a key file")
+	}
+	if config.ClientCAFile != "" && config.CertFile == "" {
+		return errors.New("client certificates need tls")
+	}
+	if config.Addr != "" && len(config.Tokens) > 0 && config.CertFile == "" && !loopbackAddr(config.Addr) {
+		return fmt.Errorf("api tokens need tls on %s, only loopback addresses may serve them in clear text", config.Addr)
+	}
+	if config.ReadTimeout < 0 || config.WriteTimeout < 0 || config.IdleTimeout < 0 {
+		return errors.New("api timeouts can not be negative")
+	}
+	return nil
+}
+
+// loopbackAddr returns true if the tcp address addr only listens on a loopback interface.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// server returns the http server of the API listeners.
+func (config *APIConfig) server(handler http.Handler) *http.Server {
+	timeout := func(d, def time.Duration) time.Duration {
+		if d == 0 {
+			return def
+		}
+		return d
+	}
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       timeout(config.ReadTimeout, DefaultAPIReadTimeout),
+		WriteTimeout:      timeout(config.WriteTimeout, DefaultAPIWriteTimeout),
+		IdleTimeout:       timeout(config.IdleTimeout, DefaultAPIIdleTimeout),
+	}
+}
+
+func validPermission(permission string) bool {
+	return permission == PermissionRead || permission == PermissionWrite
+}
+
+// tlsConfig returns the TLS config of the tcp listener, nil if TLS is disabled.
+// Returns an error in case there's any.
+func (config *APIConfig) tlsConfig() (*tls.Config, error) {
+	if config.CertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if config.ClientCAFile != "" {
+		pem, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if config.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// permission returns the permission granted to r, empty if it is not authenticated.
+func (config *APIConfig) permission(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, t := range config.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+				return t.Permission
+			}
+		}
+		return ""
+	}
+	// Only certificates verified against ClientCAs end up in VerifiedChains.
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return config.ClientCerts[r.TLS.VerifiedChains[0][0].Subject.CommonName]
+	}
+	return ""
+}
+
+// apiError is the body of a failed API response.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// APIError is returned by RemoteClient when the API rejects a request.
+type APIError struct {
+	Status  int    // Status is the HTTP status code.
+	Message string // Message is the error reported by the server.
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("api error %d: %s", e.Status, e.Message)
+}
+
+// apiHandler is an API operation. The returned value is encoded as the JSON response.
+type apiHandler func(r *http.Request) (any, error)
+
+// newAPIHandler returns the http handler serving the control API of m.
+func newAPIHandler(m *RemoteMaster, config *APIConfig) http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern string, permission string, h apiHandler) {
+		method, path, _ := strings.Cut(pattern, " ")
+		mux.HandleFunc(method+" /"+APIVersion+path, func(w http.ResponseWriter, r *http.Request) {
+			granted := config.permission(r)
+			if granted == "" {
+				writeJSON(w, http.StatusUnauthorized, apiError{"missing or invalid credentials"})
+				return
+			}
+			if permission == PermissionWrite && granted != PermissionWrite {
+				writeJSON(w, http.StatusForbidden, apiError{"write permission required"})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxAPIBody)
+			res, err := h(r)
+			if err != nil {
+				writeJSON(w, apiErrorStatus(err), apiError{err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, res)
+		})
+	}
+
+	handle("GET /version", PermissionRead, func(r *http.Request) (any, error) {
+		return map[string]string{"version": APIVersion}, nil
+	})
+	handle("GET /procs", PermissionRead, func(r *http.Request) (any, error) {
+		var response ProcResponse
+		err := m.MonitStatus("", &response)
+		return response, err
+	})
+	handle("GET /procs/{name}/logs", PermissionRead, func(r *http.Request) (any, error) {
+		req, err := logsRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		var response LogsResponse
+		err = m.Logs(req, &response)
+		return response, err
+	})
+	handle("POST /manifest/diff", PermissionRead, func(r *http.Request) (any, error) {
+		manifest := &Manifest{}
+		if err := decodeJSON(r, manifest); err != nil {
+			return nil, err
+		}
+		var response ManifestResponse
+		err := m.DiffManifest(manifest, &response)
+		return response, err
+	})
+
+	handle("POST /save", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		return m.Save("", ack)
+	}))
+	handle("POST /resurrect", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		return m.Resurrect("", ack)
+	}))
+	handle("POST /gobins", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		goBin := &GoBin{}
+		if err := decodeJSON(r, goBin); err != nil {
+			return err
+		}
+		return m.StartGoBin(goBin, ack)
+	}))
+	handle("POST /commands", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		command := &Command{}
+		if err := decodeJSON(r, command); err != nil {
+			return err
+		}
+		return m.StartCommand(command, ack)
+	}))
+	handle("POST /procs/{name}/start", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		return m.StartProcess(r.PathValue("name"), ack)
+	}))
+	handle("POST /procs/{name}/stop", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		return m.StopProcess(r.PathValue("name"), ack)
+	}))
+	handle("POST /procs/{name}/restart", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		return m.RestartProcess(r.PathValue("name"), ack)
+	}))
+	handle("POST /procs/{name}/reload", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		return m.ReloadProcess(r.PathValue("name"), ack)
+	}))
+	handle("DELETE /procs/{name}", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		return m.DeleteProcess(r.PathValue("name"), ack)
+	}))
+	handle("PUT /procs/{name}/restart-policy", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		req := &ProcRestartPolicy{Name: r.PathValue("name")}
+		if err := decodeJSON(r, &req.Policy); err != nil {
+			return err
+		}
+		return m.SetRestartPolicy(req, ack)
+	}))
+	handle("POST /clusters", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		cluster := &Cluster{}
+		if err := decodeJSON(r, cluster); err != nil {
+			return err
+		}
+		return m.StartCluster(cluster, ack)
+	}))
+	handle("PUT /clusters/{name}/scale", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		req := &ScaleRequest{}
+		if err := decodeJSON(r, req); err != nil {
+			return err
+		}
+		req.Name = r.PathValue("name")
+		return m.Scale(req, ack)
+	}))
+	handle("POST /clusters/{name}/rolling-restart", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		return m.RollingRestart(r.PathValue("name"), ack)
+	}))
+	handle("DELETE /clusters/{name}", PermissionWrite, ackHandler(func(r *http.Request, ack *bool) error {
+		return m.DeleteCluster(r.PathValue("name"), ack)
+	}))
+	handle("POST /manifest/apply", PermissionWrite, func(r *http.Request) (any, error) {
+		manifest := &Manifest{}
+		if err := decodeJSON(r, manifest); err != nil {
+			return nil, err
+		}
+		// Report the actions applied before a failure along with the error.
+		actions, err := m.master.Apply(manifest)
+		response := ManifestResponse{Actions: actions}
+		if err != nil {
+			response.Error = err.Error()
+		}
+		return response, nil
+	})
+	return mux
+}
+
+// ackHandler adapts the RemoteMaster operations that only acknowledge the request.
+func ackHandler(fn func(r *http.Request, ack *bool) error) apiHandler {
+	return func(r *http.Request) (any, error) {
+		var ack bool
+		err := fn(r, &ack)
+		return struct{}{}, err
+	}
+}
+
+// badRequest wraps errors caused by malformed requests.
+type badRequest struct{ error }
+
+func (e badRequest) Unwrap() error { return e.error }
+
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequest{fmt.Errorf("invalid request body: %w", err)}
+	}
+	return nil
+}
+
+func logsRequest(r *http.Request) (*LogsRequest, error) {
+	q := r.URL.Query()
+	req := &LogsRequest{Name: r.PathValue("name")}
+	var err error
+	if v := q.Get("lines"); v != "" {
+		if req.Lines, err = strconv.Atoi(v); err != nil {
+			return nil, badRequest{fmt.Errorf("invalid lines: %w", err)}
+		}
+	}
+	if v := q.Get("follow"); v != "" {
+		if req.Follow, err = strconv.ParseBool(v); err != nil {
+			return nil, badRequest{fmt.Errorf("invalid follow: %w", err)}
+		}
+	}
+	if v := q.Get("after"); v != "" {
+		if req.After, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, badRequest{fmt.Errorf("invalid after: %w", err)}
+		}
+	}
+	if v := q.Get("wait"); v != "" {
+		if req.Wait, err = time.ParseDuration(v); err != nil {
+			return nil, badRequest{fmt.Errorf("invalid wait: %w", err)}
+		}
+	}
+	return req, nil
+}
+
+func apiErrorStatus(err error) int {
+	var bad badRequest
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &bad):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnknownProcess), errors.Is(err, ErrUnknownCluster):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Could not write api response due to %s.", err)
+	}
+}
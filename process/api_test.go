@@ -0,0 +1,309 @@
+package process
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testReadToken  = "read-token"
+	testWriteToken = "write-token"
+)
+
+var testTokens = []APIToken{
+	{Token: testReadToken, Permission: PermissionRead},
+	{Token: testWriteToken, Permission: PermissionWrite},
+}
+
+// newTestClient serves the API of master over http and returns a client authenticated
+// with a token granting permission.
+func newTestClient(t *testing.T, master *Master, permission string) *RemoteClient {
+	t.Helper()
+	config := &APIConfig{Addr: "127.0.0.1:0", Tokens: testTokens}
+	server := httptest.NewServer(newAPIHandler(&RemoteMaster{master: master}, config))
+	t.Cleanup(server.Close)
+
+	token := testReadToken
+	if permission == PermissionWrite {
+		token = testWriteToken
+	}
+	client, err := StartRemoteClient(server.URL, time.Second, WithToken(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+// newTestConfigFile returns an empty master config file in dir.
+func newTestConfigFile(t *testing.T, dir string) string {
+	t.Helper()
+	configFile := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(configFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configFile
+}
+
+func apiStatus(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return 0
+}
+
+func TestAPIPermissions(t *testing.T) {
+	master := newTestMaster(t, "sleeper")
+	err := master.RunPreparable(&Preparable{
+		Name:      "sleeper",
+		Cmd:       "/bin/sh",
+		Args:      []string{"-c", "sleep 30"},
+		SysFolder: master.SysFolder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(newAPIHandler(&RemoteMaster{master: master}, &APIConfig{Addr: "127.0.0.1:0", Tokens: testTokens}))
+	defer server.Close()
+	if _, err := StartRemoteClient(server.URL, time.Second); apiStatus(err) != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %v", err)
+	}
+	if _, err := StartRemoteClient(server.URL, time.Second, WithToken("wrong")); apiStatus(err) != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with a wrong token, got %v", err)
+	}
+
+	reader := newTestClient(t, master, PermissionRead)
+	status, err := reader.MonitStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Procs) != 1 || status.Procs[0].Name != "sleeper" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if err := reader.StopProcess("sleeper"); apiStatus(err) != http.StatusForbidden {
+		t.Fatalf("expected 403 for a read token, got %v", err)
+	}
+	if _, err := reader.DiffManifest(&Manifest{}); err != nil {
+		t.Fatalf("diff should only need read permission: %v", err)
+	}
+
+	writer := newTestClient(t, master, PermissionWrite)
+	if err := writer.StopProcess("missing"); apiStatus(err) != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown process, got %v", err)
+	}
+	if err := writer.StopProcess("sleeper"); err != nil {
+		t.Fatal(err)
+	}
+	if status := master.Procs["sleeper"].GetStatus().Status; status != "stopped" {
+		t.Fatalf("expected stopped, got %s", status)
+	}
+}
+
+func TestAPIBadRequest(t *testing.T) {
+	master := newTestMaster(t)
+	server := httptest.NewServer(newAPIHandler(&RemoteMaster{master: master}, &APIConfig{Addr: "127.0.0.1:0", Tokens: testTokens}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/procs/x/logs?lines=many", nil)
+	req.Header.Set("Authorization", "Bearer "+testReadToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+
+	body := `{"name": "` + strings.Repeat("x", maxAPIBody) + `"}`
+	req, _ = http.NewRequest(http.MethodPost, server.URL+"/v1/commands", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testWriteToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIConfigValidate(t *testing.T) {
+	for name, config := range map[string]APIConfig{
+		"no listener":           {Tokens: testTokens},
+		"no auth":               {Addr: "127.0.0.1:0"},
+		"unknown permission":    {Addr: "127.0.0.1:0", Tokens: []APIToken{{Token: "t", Permission: "admin"}}},
+		"certs without ca":      {Addr: "127.0.0.1:0", ClientCerts: map[string]string{"ops": PermissionWrite}},
+		"cert without key":      {Addr: "127.0.0.1:0", Tokens: testTokens, CertFile: "cert.pem"},
+		"client ca without tls": {Addr: "127.0.0.1:0", Tokens: testTokens, ClientCAFile: "ca.pem"},
+		"clear text tokens":     {Addr: "0.0.0.0:9999", Tokens: testTokens},
+		"all interfaces":        {Addr: ":9999", Tokens: testTokens},
+		"negative timeout":      {Addr: "127.0.0.1:0", Tokens: testTokens, WriteTimeout: -time.Second},
+	} {
+		if err := config.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	for _, config := range []APIConfig{
+		{Addr: "localhost:9999", Tokens: testTokens},
+		{Addr: "[::1]:9999", Tokens: testTokens},
+		{Addr: ":9999", Tokens: testTokens, CertFile: "cert.pem", KeyFile: "key.pem"},
+		{SocketPath: "apm.sock", Tokens: testTokens},
+	} {
+		if err := config.Validate(); err != nil {
+			t.Errorf("%+v: %v", config, err)
+		}
+	}
+}
+
+func TestAPIServerTimeouts(t *testing.T) {
+	server := (&APIConfig{ReadTimeout: time.Second}).server(nil)
+	if server.ReadTimeout != time.Second || server.WriteTimeout != DefaultAPIWriteTimeout || server.IdleTimeout != DefaultAPIIdleTimeout {
+		t.Fatalf("unexpected timeouts %+v", server)
+	}
+}
+
+func TestAPIUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "apm.sock")
+	// A stale socket from a previous run is replaced.
+	if err := os.WriteFile(socketPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	remote, err := StartRemoteMasterServer(APIConfig{SocketPath: socketPath, Tokens: testTokens}, newTestConfigFile(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Stop()
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected socket mode 0600, got %v", info.Mode().Perm())
+	}
+	client, err := StartRemoteClient("unix://"+socketPath, time.Second, WithToken(testWriteToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPIMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newTestCert(t, dir, "ca", nil, nil)
+	newTestCert(t, dir, "server", ca, caKey)
+	newTestCert(t, dir, "ops", ca, caKey)
+	newTestCert(t, dir, "viewer", ca, caKey)
+
+	remote, err := StartRemoteMasterServer(APIConfig{
+		Addr:              "127.0.0.1:0",
+		CertFile:          filepath.Join(dir, "server.pem"),
+		KeyFile:           filepath.Join(dir, "server.key"),
+		ClientCAFile:      filepath.Join(dir, "ca.pem"),
+		RequireClientCert: true,
+		ClientCerts:       map[string]string{"ops": PermissionWrite, "viewer": PermissionRead},
+	}, newTestConfigFile(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Stop()
+	addr := remote.Addrs()[0].String()
+
+	clientTLS := func(name string) *tls.Config {
+		cert, err := tls.LoadX509KeyPair(filepath.Join(dir, name+".pem"), filepath.Join(dir, name+".key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool := x509.NewCertPool()
+		pool.AddCert(ca)
+		return &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}}
+	}
+
+	viewer, err := StartRemoteClient("https://"+addr, time.Second, WithTLSConfig(clientTLS("viewer")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer viewer.Close()
+	if err := viewer.Save(); apiStatus(err) != http.StatusForbidden {
+		t.Fatalf("expected 403 for a read certificate, got %v", err)
+	}
+
+	ops, err := StartRemoteClient("https://"+addr, time.Second, WithTLSConfig(clientTLS("ops")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ops.Close()
+	if err := ops.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	if _, err := StartRemoteClient("https://"+addr, time.Second, WithTLSConfig(&tls.Config{RootCAs: pool})); err == nil {
+		t.Fatal("expected the handshake to fail without a client certificate")
+	}
+}
+
+// newTestCert writes name.pem and name.key to dir, signed by parent or self signed if parent is nil.
+func newTestCert(t *testing.T, dir string, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
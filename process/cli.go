@@ -15,14 +15,14 @@ type Cli struct {
 	log          logging.Logger // logger instance
 }
 
-// NewCli initiates a remote client connecting to dsn.
+// NewCli initiates a remote client connecting to dsn, configured by opts.
 // Returns a Cli instance.
-func NewCli(dsn string, timeout time.Duration, l logging.Logger) (*Cli, error) {
+func NewCli(dsn string, timeout time.Duration, l logging.Logger, opts ...ClientOption) (*Cli, error) {
 	if l == nil {
 		l = logging.NewLogAdapter(os.Stdout, logging.InfoLevel)
 	}
 
-	client, err := StartRemoteClient(dsn, timeout)
+	client, err := StartRemoteClient(dsn, timeout, opts...)
 	if err != nil {
 		l.Errorf("Failed to start remote client due to: %+v, dsn: %s", err, dsn)
 		return nil, err
@@ -67,6 +67,93 @@ func (cli *Cli) StartGoBin(sourcePath string, name string, keepAlive bool, args
 	return nil
 }
 
+// StartCommand will try to start the process described by command.
+// Returns an error in case there's any.
+func (cli *Cli) StartCommand(command *Command) error {
+	err := cli.remoteClient.StartCommand(command)
+	if err != nil {
+		cli.log.Errorf("Failed to start command due to: %+v, name: %s", err, command.Name)
+		return err
+	}
+	return nil
+}
+
+// StartBinary will try to start a prebuilt binary process.
+// Returns an error in case there's any.
+func (cli *Cli) StartBinary(path string, name string, keepAlive bool, args []string) error {
+	err := cli.remoteClient.StartBinary(path, name, keepAlive, args)
+	if err != nil {
+		cli.log.Errorf("Failed to start binary due to: %+v, name: %s", err, name)
+		return err
+	}
+	return nil
+}
+
+// StartShell will try to start a shell command process.
+// Returns an error in case there's any.
+func (cli *Cli) StartShell(command string, name string, keepAlive bool) error {
+	err := cli.remoteClient.StartShell(command, name, keepAlive)
+	if err != nil {
+		cli.log.Errorf("Failed to start shell command due to: %+v, name: %s", err, name)
+		return err
+	}
+	return nil
+}
+
+// StartScript will try to start a script run by the interpreter of language.
+// Returns an error in case there's any.
+func (cli *Cli) StartScript(language string, script string, name string, keepAlive bool, args []string) error {
+	err := cli.remoteClient.StartScript(language, script, name, keepAlive, args)
+	if err != nil {
+		cli.log.Errorf("Failed to start script due to: %+v, name: %s", err, name)
+		return err
+	}
+	return nil
+}
+
+// Apply will load the manifest at path and converge the remote master to it, displaying the applied actions.
+// Returns an error in case there's any.
+func (cli *Cli) Apply(path string) error {
+	manifest, err := LoadManifest(path)
+	if err != nil {
+		cli.log.Errorf("Failed to load manifest due to: %+v, path: %s", err, path)
+		return err
+	}
+	actions, err := cli.remoteClient.ApplyManifest(manifest)
+	printActions(actions)
+	if err != nil {
+		cli.log.Errorf("Failed to apply manifest due to: %+v, path: %s", err, path)
+		return err
+	}
+	return nil
+}
+
+// Diff will load the manifest at path and display the actions needed to converge to it.
+// Returns an error in case there's any.
+func (cli *Cli) Diff(path string) error {
+	manifest, err := LoadManifest(path)
+	if err != nil {
+		cli.log.Errorf("Failed to load manifest due to: %+v, path: %s", err, path)
+		return err
+	}
+	actions, err := cli.remoteClient.DiffManifest(manifest)
+	if err != nil {
+		cli.log.Errorf("Failed to diff manifest due to: %+v, path: %s", err, path)
+		return err
+	}
+	if len(actions) == 0 {
+		fmt.Println("Nothing to do.")
+	}
+	printActions(actions)
+	return nil
+}
+
+func printActions(actions []ManifestAction) {
+	for _, action := range actions {
+		fmt.Printf("%s %s (%s)\n", PadString(action.Action, 9), action.Name, action.Reason)
+	}
+}
+
 // RestartProcess will try to restart a process with procName. Note that this process
 // must have been already started through StartGoBin.
 func (cli *Cli) RestartProcess(procName string) error {
@@ -78,6 +165,17 @@ func (cli *Cli) RestartProcess(procName string) error {
 	return nil
 }
 
+// ReloadProcess will replace process procName without downtime, stopping the running
+// process only once the new one is ready.
+func (cli *Cli) ReloadProcess(procName string) error {
+	err := cli.remoteClient.ReloadProcess(procName)
+	if err != nil {
+		cli.log.Errorf("Failed to reload process due to: %+v, name: %s", err, procName)
+		return err
+	}
+	return nil
+}
+
 // StartProcess will try to start a process with procName. Note that this process
 // must have been already started through StartGoBin.
 func (cli *Cli) StartProcess(procName string) error {
@@ -99,6 +197,80 @@ func (cli *Cli) StopProcess(procName string) error {
 	return nil
 }
 
+// SetRestartPolicy will change the restart policy of process procName.
+func (cli *Cli) SetRestartPolicy(procName string, policy RestartPolicy) error {
+	err := cli.remoteClient.SetRestartPolicy(procName, policy)
+	if err != nil {
+		cli.log.Errorf("Failed to set restart policy due to: %+v, name: %s", err, procName)
+		return err
+	}
+	return nil
+}
+
+// StartCluster will start the instances of cluster.
+func (cli *Cli) StartCluster(cluster *Cluster) error {
+	err := cli.remoteClient.StartCluster(cluster)
+	if err != nil {
+		cli.log.Errorf("Failed to start cluster due to: %+v, name: %s", err, cluster.Name)
+		return err
+	}
+	return nil
+}
+
+// Scale will start or delete instances of cluster name until it runs n instances.
+func (cli *Cli) Scale(name string, n int) error {
+	err := cli.remoteClient.Scale(name, n)
+	if err != nil {
+		cli.log.Errorf("Failed to scale cluster due to: %+v, name: %s", err, name)
+		return err
+	}
+	return nil
+}
+
+// RollingRestart will restart the instances of cluster name one at a time.
+func (cli *Cli) RollingRestart(name string) error {
+	err := cli.remoteClient.RollingRestart(name)
+	if err != nil {
+		cli.log.Errorf("Failed to restart cluster due to: %+v, name: %s", err, name)
+		return err
+	}
+	return nil
+}
+
+// DeleteCluster will delete cluster name and its instances.
+func (cli *Cli) DeleteCluster(name string) error {
+	err := cli.remoteClient.DeleteCluster(name)
+	if err != nil {
+		cli.log.Errorf("Failed to delete cluster due to: %+v, name: %s", err, name)
+		return err
+	}
+	return nil
+}
+
+// Logs will display the last lines lines written by process procName, with their time and stream.
+// If follow is set it keeps displaying new lines until the connection is closed.
+func (cli *Cli) Logs(procName string, lines int, follow bool) error {
+	stream, err := cli.remoteClient.Logs(procName, lines, follow)
+	if err != nil {
+		cli.log.Errorf("Failed to get logs due to: %+v, name: %s", err, procName)
+		return err
+	}
+	defer stream.Close()
+
+	for line := range stream.Lines() {
+		ts := "-"
+		if !line.Time.IsZero() {
+			ts = line.Time.Format("2006-01-02 15:04:05.000")
+		}
+		fmt.Printf("%s %s %s | %s\n", ts, procName, line.Stream, line.Text)
+	}
+	if err := stream.Err(); err != nil {
+		cli.log.Errorf("Failed to follow logs due to: %+v, name: %s", err, procName)
+		return err
+	}
+	return nil
+}
+
 // DeleteProcess will stop and delete all dependencies from process procName forever.
 func (cli *Cli) DeleteProcess(procName string) error {
 	err := cli.remoteClient.DeleteProcess(procName)
@@ -122,31 +294,82 @@ func (cli *Cli) Status() error {
 		proc := procResponse.Procs[id]
 		maxName = int(math.Max(float64(maxName), float64(len(proc.Name))))
 	}
-	totalSize := maxName + 51
+	totalSize := maxName + 137
 	topBar := ""
 	for i := 1; i <= totalSize; i += 1 {
 		topBar += "-"
 	}
-	infoBar := fmt.Sprintf("|%s|%s|%s|%s|",
+	infoBar := fmt.Sprintf("|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|",
 		PadString("pid", 13),
 		PadString("name", maxName+2),
+		PadString("instance", 10),
 		PadString("status", 16),
-		PadString("keep-alive", 15))
+		PadString("keep-alive", 15),
+		PadString("restarts", 12),
+		PadString("exit-code", 12),
+		PadString("health", 12),
+		PadString("cpu", 9),
+		PadString("memory", 12),
+		PadString("uptime", 12))
 	fmt.Println(topBar)
 	fmt.Println(infoBar)
+	clusters := []string{}
+	running := map[string]int{}
+	instances := map[string]int{}
 	for id := range procResponse.Procs {
 		proc := procResponse.Procs[id]
+		instance := "-"
+		if proc.Instances > 0 {
+			instance = fmt.Sprintf("%d", proc.Instance)
+			if _, ok := instances[proc.App]; !ok {
+				clusters = append(clusters, proc.App)
+			}
+			instances[proc.App] = proc.Instances
+			if proc.Status.Status == "running" {
+				running[proc.App]++
+			}
+		}
 		kp := "True"
 		if !proc.KeepAlive {
 			kp = "False"
 		}
-		fmt.Printf("|%s|%s|%s|%s|\n",
+		exitCode := "-"
+		if !proc.Status.ExitedAt.IsZero() {
+			exitCode = fmt.Sprintf("%d", proc.Status.ExitCode)
+		}
+		health := "-"
+		if proc.Status.Health.State != "" {
+			health = proc.Status.Health.State
+		}
+		cpu, memory, uptime := "-", "-", "-"
+		if !proc.Status.Metrics.Time.IsZero() {
+			cpu = fmt.Sprintf("%.1f%%", proc.Status.Metrics.CPU)
+			memory = FormatBytes(proc.Status.Metrics.RSS)
+			uptime = proc.Status.Metrics.Uptime.Truncate(time.Second).String()
+		}
+		fmt.Printf("|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|\n",
 			PadString(fmt.Sprintf("%d", proc.Pid), 13),
 			PadString(proc.Name, maxName+2),
+			PadString(instance, 10),
 			PadString(proc.Status.Status, 16),
-			PadString(kp, 15))
+			PadString(kp, 15),
+			PadString(fmt.Sprintf("%d", proc.Status.Restarts), 12),
+			PadString(exitCode, 12),
+			PadString(health, 12),
+			PadString(cpu, 9),
+			PadString(memory, 12),
+			PadString(uptime, 12))
+		if proc.Status.Reason != "" {
+			fmt.Printf("  %s: %s\n", proc.Name, proc.Status.Reason)
+		}
+		if proc.Status.Health.State == HealthUnhealthy {
+			fmt.Printf("  %s: %s\n", proc.Name, proc.Status.Health.LastError)
+		}
 	}
 	fmt.Println(topBar)
+	for _, app := range clusters {
+		fmt.Printf("%s: %d/%d instances running\n", app, running[app], instances[app])
+	}
 	return nil
 }
 
@@ -0,0 +1,362 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownCluster is returned when an app name is not a cluster managed by the master.
+var ErrUnknownCluster = errors.New("unknown cluster")
+
+// Cluster is a group of instances of the same app, started from a common template.
+// Args, Env and Listeners of the template may contain {{expression}} placeholders expanded for each
+// instance, ie: PORT={{base+index}}. An expression is either name, app, or integers and
+// the variables index, base and instances added or subtracted, ie: {{base+index+1}}.
+type Cluster struct {
+	Name      string  // Name is the app name, instance 0 runs under it and instance i under name-i.
+	Template  Command // Template is the command of every instance, its Name is ignored.
+	Instances int     // Instances is the number of instances to run.
+	Base      int     // Base is the value of {{base}}, ie: the port of the first instance.
+}
+
+// instanceVars are the values available to the templates of an instance.
+type instanceVars struct {
+	app       string
+	name      string
+	index     int
+	base      int
+	instances int
+}
+
+var templateExpr = regexp.MustCompile(`{{\s*([^{}]*?)\s*}}`)
+
+// expand will replace the placeholders of s by their value.
+// Returns an error in case an expression is invalid.
+func (vars instanceVars) expand(s string) (string, error) {
+	var err error
+	expanded := templateExpr.ReplaceAllStringFunc(s, func(match string) string {
+		value, evalErr := vars.eval(templateExpr.FindStringSubmatch(match)[1])
+		if evalErr != nil && err == nil {
+			err = fmt.Errorf("invalid template %q: %w", s, evalErr)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+func (vars instanceVars) eval(expr string) (string, error) {
+	switch expr {
+	case "app":
+		return vars.app, nil
+	case "name":
+		return vars.name, nil
+	}
+	total := 0
+	sign := 1
+	term := ""
+	// Adding a trailing + flushes the last term.
+	for _, c := range strings.ReplaceAll(expr, " ", "") + "+" {
+		if c != '+' && c != '-' {
+			term += string(c)
+			continue
+		}
+		if term == "" {
+			return "", fmt.Errorf("missing operand in %q", expr)
+		}
+		value, err := vars.value(term)
+		if err != nil {
+			return "", err
+		}
+		total += sign * value
+		sign, term = 1, ""
+		if c == '-' {
+			sign = -1
+		}
+	}
+	return strconv.Itoa(total), nil
+}
+
+func (vars instanceVars) value(term string) (int, error) {
+	switch term {
+	case "index":
+		return vars.index, nil
+	case "base":
+		return vars.base, nil
+	case "instances":
+		return vars.instances, nil
+	}
+	value, err := strconv.Atoi(term)
+	if err != nil {
+		return 0, fmt.Errorf("unknown variable %q", term)
+	}
+	return value, nil
+}
+
+// Validate will check the cluster and its templates.
+// Returns an error in case there's any.
+func (cluster *Cluster) Validate() error {
+	if cluster.Name == "" {
+		return errors.New("cluster needs a name")
+	}
+	if cluster.Instances < 0 {
+		return fmt.Errorf("cluster %s can not have %d instances", cluster.Name, cluster.Instances)
+	}
+	_, err := cluster.command(0)
+	return err
+}
+
+// command returns the command running instance index of the cluster.
+// Returns an error in case a template is invalid.
+func (cluster *Cluster) command(index int) (*Command, error) {
+	command := cluster.Template
+	command.Name = instanceName(cluster.Name, index)
+	vars := instanceVars{
+		app:       cluster.Name,
+		name:      command.Name,
+		index:     index,
+		base:      cluster.Base,
+		instances: cluster.Instances,
+	}
+	var err error
+	if command.Args, err = vars.expandAll(cluster.Template.Args); err != nil {
+		return nil, err
+	}
+	if command.Env, err = vars.expandAll(cluster.Template.Env); err != nil {
+		return nil, err
+	}
+	if command.Listeners, err = vars.expandAll(cluster.Template.Listeners); err != nil {
+		return nil, err
+	}
+	return &command, nil
+}
+
+func (vars instanceVars) expandAll(templates []string) ([]string, error) {
+	if templates == nil {
+		return nil, nil
+	}
+	expanded := make([]string, len(templates))
+	for i, s := range templates {
+		var err error
+		if expanded[i], err = vars.expand(s); err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// StartCluster will register cluster and start its instances.
+// Returns an error in case there's any.
+func (master *Master) StartCluster(cluster *Cluster) error {
+	if err := cluster.Validate(); err != nil {
+		return err
+	}
+	defer master.lockCluster(cluster.Name)()
+	master.Lock()
+	if _, ok := master.Clusters[cluster.Name]; ok {
+		master.Unlock()
+		return fmt.Errorf("cluster %s already exist", cluster.Name)
+	}
+	if err := master.checkInstanceNames(cluster.Name, cluster.Instances); err != nil {
+		master.Unlock()
+		return err
+	}
+	instances := cluster.Instances
+	master.Clusters[cluster.Name] = &Cluster{
+		Name:     cluster.Name,
+		Template: cluster.Template,
+		Base:     cluster.Base,
+	}
+	master.Unlock()
+	return master.scale(cluster.Name, instances)
+}
+
+// Scale will start or delete instances of cluster name until it runs n instances.
+// New instances are started one at a time, waiting for each to be ready, and the
+// instances with the highest index are deleted first.
+// Returns an error in case there's any.
+func (master *Master) Scale(name string, n int) error {
+	defer master.lockCluster(name)()
+	return master.scale(name, n)
+}
+
+// scale will start or delete instances of cluster name until it runs n instances.
+// The cluster should be locked before calling it, see lockCluster.
+// Returns an error in case there's any.
+func (master *Master) scale(name string, n int) error {
+	if n < 0 {
+		return fmt.Errorf("can not scale %s to %d instances", name, n)
+	}
+	master.Lock()
+	cluster, ok := master.Clusters[name]
+	if !ok {
+		master.Unlock()
+		return ErrUnknownCluster
+	}
+	if err := master.checkInstanceNames(name, n); err != nil {
+		master.Unlock()
+		return err
+	}
+	cluster.Instances = n
+	spec := *cluster
+	instances := master.clusterInstances(name)
+	master.saveProcsWrapper()
+	master.Unlock()
+	log.Printf("Scaling cluster %s from %d to %d instances.", name, len(instances), n)
+
+	running := make(map[int]bool, len(instances))
+	for i := len(instances) - 1; i >= 0; i-- {
+		instance := instances[i]
+		if instance.index < n {
+			running[instance.index] = true
+			continue
+		}
+		if err := master.DeleteProcess(instance.name); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < n; i++ {
+		if running[i] {
+			continue
+		}
+		command, err := spec.command(i)
+		if err != nil {
+			return err
+		}
+		preparable, output, err := master.PrepareCommand(command)
+		if err != nil {
+			return fmt.Errorf("%s %s", err, string(output))
+		}
+		preparable.App = name
+		preparable.Instance = i
+		preparable.SpecHash = specHash(command)
+		if err := master.RunPreparable(preparable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollingRestart will restart the instances of cluster name one at a time, waiting for each
+// instance to be ready before restarting the next one.
+// Returns an error in case there's any, in which case the remaining instances are not restarted.
+func (master *Master) RollingRestart(name string) error {
+	defer master.lockCluster(name)()
+	master.Lock()
+	_, ok := master.Clusters[name]
+	master.Unlock()
+	if !ok {
+		return ErrUnknownCluster
+	}
+	for _, instance := range master.listInstances(name) {
+		log.Printf("Rolling restart of cluster %s: restarting %s.", name, instance.name)
+		if err := master.RestartProcess(instance.name); err != nil {
+			return fmt.Errorf("restart %s: %w", instance.name, err)
+		}
+	}
+	return nil
+}
+
+// DeleteCluster will delete cluster name and all of its instances.
+// Returns an error in case there's any.
+func (master *Master) DeleteCluster(name string) error {
+	defer master.lockCluster(name)()
+	if err := master.scale(name, 0); err != nil {
+		return err
+	}
+	master.Lock()
+	defer master.Unlock()
+	delete(master.Clusters, name)
+	return master.saveProcsWrapper()
+}
+
+// lockCluster will wait until no other operation runs on the instances of cluster name, so two
+// operations never start or delete the same instance. Empty names are not locked.
+// Returns the function releasing the cluster.
+func (master *Master) lockCluster(name string) func() {
+	if name == "" {
+		return func() {}
+	}
+	master.Lock()
+	if master.clusterOps == nil {
+		master.clusterOps = make(map[string]*sync.Mutex)
+	}
+	mu, ok := master.clusterOps[name]
+	if !ok {
+		mu = &sync.Mutex{}
+		master.clusterOps[name] = mu
+	}
+	master.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// checkInstanceNames will make sure the first n instances of cluster name do not collide with
+// processes that are not part of it.
+// Returns an error in case there's any.
+func (master *Master) checkInstanceNames(name string, n int) error {
+	for i := 0; i < n; i++ {
+		instance := instanceName(name, i)
+		if proc, ok := master.Procs[instance]; ok && procApp(proc) != name {
+			return fmt.Errorf("process %s already exist and is not an instance of cluster %s", instance, name)
+		}
+	}
+	return nil
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// reservedBy returns the cluster whose instances may be named name, empty if there's none.
+func (master *Master) reservedBy(name string) string {
+	for cluster := range master.Clusters {
+		if name == cluster {
+			return cluster
+		}
+		suffix, ok := strings.CutPrefix(name, cluster+"-")
+		if !ok {
+			continue
+		}
+		if index, err := strconv.Atoi(suffix); err == nil && index > 0 && instanceName(cluster, index) == name {
+			return cluster
+		}
+	}
+	return ""
+}
+
+// clusterInstance is a process running an instance of a cluster.
+type clusterInstance struct {
+	name  string
+	index int
+}
+
+// listInstances returns the instances of cluster name, ordered by index.
+func (master *Master) listInstances(name string) []clusterInstance {
+	master.Lock()
+	defer master.Unlock()
+	return master.clusterInstances(name)
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+func (master *Master) clusterInstances(name string) []clusterInstance {
+	var instances []clusterInstance
+	for procName, proc := range master.Procs {
+		if procApp(proc) == name {
+			instances = append(instances, clusterInstance{procName, procInstance(proc)})
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].index < instances[j].index })
+	return instances
+}
+
+// procInstance returns the index of a process within its app, 0 for processes that are not part of one.
+func procInstance(proc ProcContainer) int {
+	if p, ok := proc.(*Proc); ok {
+		return p.Instance
+	}
+	return 0
+}
@@ -0,0 +1,188 @@
+package process
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInstanceTemplates(t *testing.T) {
+	vars := instanceVars{app: "web", name: "web-2", index: 2, base: 8000, instances: 3}
+	for template, want := range map[string]string{
+		"PORT={{base+index}}":  "PORT=8002",
+		"--id={{ index + 1 }}": "--id=3",
+		"{{name}}.{{app}}":     "web-2.web",
+		"last={{instances-1}}": "last=2",
+		"{{base-index-1000}}":  "6998",
+		"no placeholder":       "no placeholder",
+	} {
+		got, err := vars.expand(template)
+		if err != nil {
+			t.Fatalf("%s: %v", template, err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", template, want, got)
+		}
+	}
+	for _, template := range []string{"{{port}}", "{{base+}}", "{{index*2}}"} {
+		if _, err := vars.expand(template); err == nil {
+			t.Errorf("%s: expected an error", template)
+		}
+	}
+}
+
+func clusterPids(t *testing.T, master *Master, name string) map[string]int {
+	t.Helper()
+	master.Lock()
+	defer master.Unlock()
+	pids := map[string]int{}
+	for _, instance := range master.clusterInstances(name) {
+		pids[instance.name] = master.Procs[instance.name].GetPid()
+	}
+	return pids
+}
+
+func TestClusterScale(t *testing.T) {
+	master := newTestMaster(t)
+	err := master.StartCluster(&Cluster{
+		Name: "web",
+		Template: Command{
+			Language: LanguageShell,
+			Source:   "sleep 30",
+			Env:      []string{"PORT={{base+index}}"},
+		},
+		Instances: 2,
+		Base:      9000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pids := clusterPids(t, master, "web"); len(pids) != 2 || pids["web"] == 0 || pids["web-1"] == 0 {
+		t.Fatalf("expected web and web-1 to run, got %v", pids)
+	}
+	if env := master.Procs["web-1"].(*Proc).Env; env[len(env)-1] != "PORT=9001" {
+		t.Fatalf("unexpected env %v", env)
+	}
+
+	if err := master.Scale("web", 3); err != nil {
+		t.Fatal(err)
+	}
+	before := clusterPids(t, master, "web")
+	if len(before) != 3 {
+		t.Fatalf("expected 3 instances, got %v", before)
+	}
+
+	if err := master.Scale("web", 1); err != nil {
+		t.Fatal(err)
+	}
+	after := clusterPids(t, master, "web")
+	if len(after) != 1 || after["web"] != before["web"] {
+		t.Fatalf("expected web to keep running alone, got %v", after)
+	}
+
+	if err := master.Scale("db", 1); !errors.Is(err, ErrUnknownCluster) {
+		t.Fatalf("expected an unknown cluster error, got %v", err)
+	}
+
+	// Clusters are saved along with the procs.
+	decodable := &DecodableMaster{}
+	if err := SafeReadTomlFile(master.getConfigPath(), decodable); err != nil {
+		t.Fatal(err)
+	}
+	if cluster := decodable.Clusters["web"]; cluster == nil || cluster.Instances != 1 || cluster.Template.Env[0] != "PORT={{base+index}}" {
+		t.Fatalf("unexpected saved cluster %+v", cluster)
+	}
+
+	if err := master.DeleteCluster("web"); err != nil {
+		t.Fatal(err)
+	}
+	if len(master.Procs) != 0 || len(master.Clusters) != 0 {
+		t.Fatalf("expected everything to be deleted, got %v %v", master.Procs, master.Clusters)
+	}
+}
+
+func TestClusterRollingRestart(t *testing.T) {
+	master := newTestMaster(t)
+	err := master.StartCluster(&Cluster{
+		Name: "worker",
+		Template: Command{
+			Language:    LanguageShell,
+			Source:      "sleep 30",
+			HealthCheck: &HealthCheck{Type: HealthCheckExec, Command: []string{"true"}, Interval: 10 * time.Millisecond, ReadyTimeout: 5 * time.Second},
+		},
+		Instances: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := clusterPids(t, master, "worker")
+	if err := master.RollingRestart("worker"); err != nil {
+		t.Fatal(err)
+	}
+	after := clusterPids(t, master, "worker")
+	for name, pid := range before {
+		if after[name] == 0 || after[name] == pid {
+			t.Fatalf("expected %s to be restarted, got %v then %v", name, before, after)
+		}
+		if !master.Procs[name].GetStatus().Health.Ready {
+			t.Fatalf("expected %s to be ready", name)
+		}
+	}
+}
+
+func TestClusterConcurrentScale(t *testing.T) {
+	master := newTestMaster(t)
+	err := master.StartCluster(&Cluster{
+		Name:      "web",
+		Template:  Command{Language: LanguageShell, Source: "sleep 30"},
+		Instances: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- master.Scale("web", 3) }()
+	go func() { errs <- master.Scale("web", 5) }()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	pids := clusterPids(t, master, "web")
+	if len(pids) != 3 && len(pids) != 5 {
+		t.Fatalf("expected 3 or 5 instances, got %v", pids)
+	}
+}
+
+func TestClusterInstanceCollision(t *testing.T) {
+	master := newTestMaster(t)
+	err := master.RunPreparable(&Preparable{Name: "web-2", Cmd: "/bin/sh", Args: []string{"-c", "sleep 30"}, SysFolder: master.SysFolder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := &Cluster{
+		Name:      "web",
+		Template:  Command{Language: LanguageShell, Source: "sleep 30"},
+		Instances: 3,
+	}
+	if err := master.StartCluster(cluster); err == nil {
+		t.Fatal("expected web-2 to collide with the standalone process")
+	}
+	master.Lock()
+	if len(master.Procs) != 1 || len(master.Clusters) != 0 {
+		t.Fatalf("expected nothing to be started, got %v %v", master.Procs, master.Clusters)
+	}
+	master.Unlock()
+
+	cluster.Instances = 2
+	if err := master.StartCluster(cluster); err != nil {
+		t.Fatal(err)
+	}
+	if err := master.Scale("web", 3); err == nil {
+		t.Fatal("expected web-2 to collide with the standalone process")
+	}
+	err = master.RunPreparable(&Preparable{Name: "web-3", Cmd: "/bin/sh", Args: []string{"-c", "sleep 30"}, SysFolder: master.SysFolder})
+	if err == nil {
+		t.Fatal("expected web-3 to be reserved for the cluster")
+	}
+}
@@ -0,0 +1,144 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Languages supported by Preparable.
+const (
+	LanguageGo     = "go"     // SourcePath is a go package compiled before running it
+	LanguageBinary = "binary" // SourcePath is a prebuilt binary, looked up in PATH if it is not a path
+	LanguageShell  = "shell"  // SourcePath is a command line run by /bin/sh, Args are its positional parameters
+)
+
+// Shell used to run LanguageShell commands.
+const shellPath = "/bin/sh"
+
+// defaultInterpreters maps the interpreted languages to the interpreter running their scripts.
+// Any language can be run by setting Preparable.Interpreter.
+var defaultInterpreters = map[string]string{
+	"python": "python3",
+	"node":   "node",
+	"nodejs": "node",
+	"ruby":   "ruby",
+	"php":    "php",
+	"perl":   "perl",
+	"bash":   "bash",
+}
+
+// resolveCommand will fill Cmd and Args for languages that do not need to be compiled.
+// Returns an error in case the command can't be found.
+func (preparable *Preparable) resolveCommand() error {
+	switch {
+	case preparable.Language == LanguageShell:
+		// sh -c command name args..., so the args are available as $1, $2...
+		preparable.Cmd = shellPath
+		preparable.Args = append([]string{"-c", preparable.SourcePath, preparable.Name}, preparable.Args...)
+		return nil
+	case preparable.Interpreter != "" || defaultInterpreters[preparable.Language] != "":
+		interpreter := preparable.Interpreter
+		if interpreter == "" {
+			interpreter = defaultInterpreters[preparable.Language]
+		}
+		cmd, err := exec.LookPath(interpreter)
+		if err != nil {
+			return err
+		}
+		preparable.Cmd = cmd
+		args := append([]string{}, preparable.InterpreterArgs...)
+		preparable.Args = append(append(args, preparable.SourcePath), preparable.Args...)
+		return nil
+	case preparable.Language == LanguageBinary || preparable.Language == "":
+		cmd, err := exec.LookPath(preparable.SourcePath)
+		if err != nil {
+			return err
+		}
+		preparable.Cmd = cmd
+		return nil
+	}
+	return fmt.Errorf("unknown language %q, set an interpreter to run it", preparable.Language)
+}
+
+// procCredential will resolve the user and group names or ids the process should run as.
+// Returns nil when both are empty, and an error in case there's any.
+func procCredential(username string, group string) (*syscall.Credential, error) {
+	if username == "" && group == "" {
+		return nil, nil
+	}
+	cred := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			if u, err = user.LookupId(username); err != nil {
+				return nil, err
+			}
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return nil, err
+			}
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		cred.Gid = uint32(gid)
+	}
+	// Only keep the supplementary groups when running as ourselves.
+	cred.NoSetGroups = cred.Uid == uint32(os.Getuid())
+	return cred, nil
+}
+
+// parseUmask will parse an octal umask such as 022.
+// Returns -1 when umask is empty, and an error in case there's any.
+func parseUmask(umask string) (int, error) {
+	if umask == "" {
+		return -1, nil
+	}
+	mask, err := strconv.ParseUint(umask, 8, 32)
+	if err != nil || mask > 0777 {
+		return 0, fmt.Errorf("invalid umask %q", umask)
+	}
+	return int(mask), nil
+}
+
+// startProcess will start a process with umask applied, or the master umask if umask is negative.
+// The umask is shared by the whole master, so it is not changed here: a shell sets it in the child
+// and then execs cmd in place, keeping the pid. cmd receives its path as argv[0] in that case.
+// Returns a tuple with the process and an error in case there's any.
+func startProcess(cmd string, args []string, attr *os.ProcAttr, umask int) (*os.Process, error) {
+	if umask < 0 {
+		return os.StartProcess(cmd, args, attr)
+	}
+	// exec looks up names without a slash in PATH, while os.StartProcess runs them from the working directory.
+	if !strings.Contains(cmd, "/") {
+		cmd = "./" + cmd
+	}
+	script := fmt.Sprintf(`umask %03o && exec "$0" "$@"`, umask)
+	shellArgs := []string{shellPath, "-c", script, cmd}
+	if len(args) > 1 {
+		shellArgs = append(shellArgs, args[1:]...)
+	}
+	return os.StartProcess(shellPath, shellArgs, attr)
+}
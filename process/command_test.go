@@ -0,0 +1,146 @@
+package process
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreparableResolveCommand(t *testing.T) {
+	shell := &Preparable{Name: "sh", Language: LanguageShell, SourcePath: "echo $1", Args: []string{"hi"}}
+	if _, err := shell.PrepareBin(); err != nil {
+		t.Fatal(err)
+	}
+	if shell.Cmd != shellPath || strings.Join(shell.Args, " ") != "-c echo $1 sh hi" {
+		t.Fatalf("unexpected shell command %s %v", shell.Cmd, shell.Args)
+	}
+
+	bin := &Preparable{Name: "bin", Language: LanguageBinary, SourcePath: "sleep", Args: []string{"1"}}
+	if _, err := bin.PrepareBin(); err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(bin.Cmd) || strings.Join(bin.Args, " ") != "1" {
+		t.Fatalf("unexpected binary command %s %v", bin.Cmd, bin.Args)
+	}
+
+	script := &Preparable{Name: "script", Language: "bash", Interpreter: "sh", InterpreterArgs: []string{"-e"}, SourcePath: "app.sh", Args: []string{"a"}}
+	if _, err := script.PrepareBin(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(script.Cmd, "/sh") || strings.Join(script.Args, " ") != "-e app.sh a" {
+		t.Fatalf("unexpected script command %s %v", script.Cmd, script.Args)
+	}
+
+	unknown := &Preparable{Name: "unknown", Language: "cobol", SourcePath: "app.cbl"}
+	if _, err := unknown.PrepareBin(); err == nil {
+		t.Fatal("expected an error for an unknown language")
+	}
+}
+
+func TestParseUmask(t *testing.T) {
+	if mask, err := parseUmask(""); err != nil || mask != -1 {
+		t.Fatalf("parseUmask(\"\") = %d, %v", mask, err)
+	}
+	if mask, err := parseUmask("027"); err != nil || mask != 027 {
+		t.Fatalf("parseUmask(027) = %o, %v", mask, err)
+	}
+	for _, umask := range []string{"9", "1000", "abc"} {
+		if _, err := parseUmask(umask); err == nil {
+			t.Errorf("parseUmask(%s) should fail", umask)
+		}
+	}
+}
+
+func TestStartProcessUmask(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\numask > out\necho \"$@\" >> out\n"
+	if err := os.WriteFile(filepath.Join(dir, "run"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	attr := &os.ProcAttr{Dir: dir, Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}}
+	process, err := startProcess("run", []string{"name", "a b", "c"}, attr, 027)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := process.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "out"))
+	if err != nil || string(b) != "0027\na b c\n" {
+		t.Fatalf("unexpected output %q, %v", b, err)
+	}
+}
+
+func TestProcCredential(t *testing.T) {
+	if cred, err := procCredential("", ""); err != nil || cred != nil {
+		t.Fatalf("expected no credential, got %v, %v", cred, err)
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, name := range []string{current.Username, current.Uid} {
+		cred, err := procCredential(name, current.Gid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cred.Uid != uint32(os.Getuid()) || !cred.NoSetGroups {
+			t.Fatalf("unexpected credential %+v", cred)
+		}
+	}
+	if _, err := procCredential("no-such-user-for-apm", ""); err == nil {
+		t.Fatal("expected an error for an unknown user")
+	}
+}
+
+func TestRemoteMasterStartCommand(t *testing.T) {
+	master := newTestMaster(t)
+	remote := &RemoteMaster{master: master}
+	dir := t.TempDir()
+
+	var ack bool
+	err := remote.StartCommand(&Command{
+		Name:     "shell",
+		Language: LanguageShell,
+		Source:   `pwd > result; umask >> result; echo "$GREETING $1" >> result; touch created`,
+		Args:     []string{"world"},
+		Env:      []string{"GREETING=hello"},
+		Dir:      dir,
+		Umask:    "027",
+	}, &ack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		b, _ := os.ReadFile(filepath.Join(dir, "result"))
+		if lines = strings.Split(strings.TrimSpace(string(b)), "\n"); len(lines) == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(lines) != 3 || lines[0] != dir || lines[1] != "0027" || lines[2] != "hello world" {
+		t.Fatalf("unexpected result %q", lines)
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	var info os.FileInfo
+	for time.Now().Before(deadline) {
+		if info, err = os.Stat(filepath.Join(dir, "created")); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil || info.Mode().Perm() != 0640 {
+		t.Fatalf("created file: %v %v", info, err)
+	}
+
+	if err := remote.StartCommand(&Command{Name: "bad", Language: LanguageShell, Source: "true", Umask: "999"}, &ack); err == nil {
+		t.Fatal("expected an invalid umask error")
+	}
+}
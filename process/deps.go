@@ -0,0 +1,252 @@
+package process
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sortByDependencies will order names so every name comes after the names it depends on,
+// keeping the original order otherwise. Dependencies that are not in names are ignored.
+// Returns an error naming the cycle in case there's any.
+func sortByDependencies(names []string, deps map[string][]string) ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[name] = true
+	}
+	state := make(map[string]int, len(names))
+	sorted := make([]string, 0, len(names))
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// name is already in path, the cycle goes from there back to name.
+			for i := range path {
+				if path[i] == name {
+					cycle := append(append([]string{}, path[i:]...), name)
+					return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if !known[dep] {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		sorted = append(sorted, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// Conditions a process waits for on its dependencies before it starts.
+const (
+	DependencyRunning = "running" // the dependencies are alive
+	DependencyHealthy = "healthy" // the dependencies passed their health check since they started, or have none
+)
+
+// DependencyTimeout is how long a process waits for its dependencies before giving up on starting.
+const DependencyTimeout = 30 * time.Second
+
+// dependencyPollInterval is how often the dependencies of a starting process are checked.
+const dependencyPollInterval = 50 * time.Millisecond
+
+// validDependencyCondition reports whether condition is a known dependency condition. Empty means running.
+func validDependencyCondition(condition string) bool {
+	return condition == "" || condition == DependencyRunning || condition == DependencyHealthy
+}
+
+// procDependencies returns the dependencies declared by proc, with their condition.
+func procDependencies(proc ProcContainer) ([]string, string) {
+	if p, ok := proc.(*Proc); ok {
+		return p.DependsOn, p.DependencyCondition
+	}
+	return nil, ""
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// resolveDependencies returns the processes named by deps. A dependency on an app or a
+// cluster is a dependency on all of its instances.
+func (master *Master) resolveDependencies(deps []string) []string {
+	var names []string
+	for _, dep := range deps {
+		instances := master.clusterInstances(dep)
+		if len(instances) == 0 {
+			names = append(names, dep)
+			continue
+		}
+		for _, instance := range instances {
+			names = append(names, instance.name)
+		}
+	}
+	return names
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// dependencyOrder returns names ordered so every process comes after its dependencies.
+// extra declares the dependencies of a process that is not managed yet, if any.
+// Returns an error naming the cycle in case there's any.
+func (master *Master) dependencyOrder(names []string, extra map[string][]string) ([]string, error) {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	return sortByDependencies(sorted, master.dependencyGraph(extra))
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// dependencyGraph returns the processes each managed process depends on, plus the ones of extra.
+func (master *Master) dependencyGraph(extra map[string][]string) map[string][]string {
+	graph := make(map[string][]string, len(master.Procs)+len(extra))
+	for name, proc := range master.Procs {
+		deps, _ := procDependencies(proc)
+		graph[name] = master.resolveDependencies(deps)
+	}
+	for name, deps := range extra {
+		graph[name] = master.resolveDependencies(deps)
+	}
+	return graph
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// checkDependencies will make sure adding process name depending on deps creates no cycle.
+// Returns an error in case there's any.
+func (master *Master) checkDependencies(name string, deps []string, condition string) error {
+	if !validDependencyCondition(condition) {
+		return fmt.Errorf("unknown dependency condition %q", condition)
+	}
+	if len(deps) == 0 {
+		return nil
+	}
+	names := []string{name}
+	for procName := range master.Procs {
+		if procName != name {
+			names = append(names, procName)
+		}
+	}
+	// Visiting name first reports the cycle from the new process.
+	_, err := sortByDependencies(names, master.dependencyGraph(map[string][]string{name: deps}))
+	return err
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// pendingDependency returns the first of deps that does not meet condition yet, empty if they all do.
+// Returns an error in case a dependency is unknown or stopped for good.
+func (master *Master) pendingDependency(deps []string, condition string) (string, error) {
+	for _, name := range master.resolveDependencies(deps) {
+		proc, ok := master.Procs[name]
+		if !ok {
+			return "", fmt.Errorf("%w: dependency %s", ErrUnknownProcess, name)
+		}
+		if !proc.IsAlive() {
+			// A dead dependency may still come back if the master restarts it.
+			if !proc.GetRestartPolicy().shouldRestart(proc.ShouldKeepAlive(), 1) {
+				return "", fmt.Errorf("dependency %s is not running", name)
+			}
+			return name, nil
+		}
+		if condition == DependencyHealthy && proc.GetHealthCheck() != nil && !proc.GetStatus().Health.Ready {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// waitDependencies will block until the dependencies of process name meet condition, up to DependencyTimeout.
+// Returns an error in case there's any.
+func (master *Master) waitDependencies(name string, deps []string, condition string) error {
+	if len(deps) == 0 {
+		return nil
+	}
+	if condition == "" {
+		condition = DependencyRunning
+	}
+	deadline := time.Now().Add(DependencyTimeout)
+	for {
+		master.Lock()
+		pending, err := master.pendingDependency(deps, condition)
+		master.Unlock()
+		if err != nil {
+			return fmt.Errorf("proc %s: %w", name, err)
+		}
+		if pending == "" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("proc %s: dependency %s is not %s after %s", name, pending, condition, DependencyTimeout)
+		}
+		time.Sleep(dependencyPollInterval)
+	}
+}
+
+// waitProcDependencies will block until the dependencies of the managed process name are met.
+// Returns an error in case there's any.
+func (master *Master) waitProcDependencies(name string) error {
+	master.Lock()
+	proc, ok := master.Procs[name]
+	master.Unlock()
+	if !ok {
+		return ErrUnknownProcess
+	}
+	deps, condition := procDependencies(proc)
+	return master.waitDependencies(name, deps, condition)
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// dependents returns the running processes that opted in to be restarted along with process name.
+func (master *Master) dependents(name string) []string {
+	var names []string
+	for procName, proc := range master.Procs {
+		p, ok := proc.(*Proc)
+		if !ok || !p.RestartWithDependencies || !p.IsAlive() {
+			continue
+		}
+		for _, dep := range master.resolveDependencies(p.DependsOn) {
+			if dep == name {
+				names = append(names, procName)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// propagateRestart will restart in the background the dependents of process name that opted in.
+func (master *Master) propagateRestart(name string) {
+	dependents := master.dependents(name)
+	if len(dependents) == 0 {
+		return
+	}
+	go func() {
+		for _, dependent := range dependents {
+			log.Printf("Restarting proc %s since its dependency %s restarted.", dependent, name)
+			if err := master.RestartProcess(dependent); err != nil {
+				log.Printf("Could not restart proc %s after its dependency %s due to %s.", dependent, name, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,172 @@
+package process
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runSleeper(t *testing.T, master *Master, preparable *Preparable) {
+	t.Helper()
+	preparable.Cmd = "/bin/sh"
+	preparable.Args = []string{"-c", "exec sleep 30"}
+	preparable.SysFolder = master.SysFolder
+	if err := master.RunPreparable(preparable); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDependencyCycle(t *testing.T) {
+	master := newTestMaster(t, "db", "api")
+	runSleeper(t, master, &Preparable{Name: "db"})
+	runSleeper(t, master, &Preparable{Name: "api", DependsOn: []string{"db"}})
+	if err := master.DeleteProcess("db"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := master.RunPreparable(&Preparable{Name: "db", Cmd: "/bin/sh", SysFolder: master.SysFolder, DependsOn: []string{"api"}})
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle: db -> api -> db") {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+	if _, ok := master.Procs["db"]; ok {
+		t.Fatal("expected db not to be started")
+	}
+
+	err = master.RunPreparable(&Preparable{Name: "db", Cmd: "/bin/sh", SysFolder: master.SysFolder, DependsOn: []string{"cache"}})
+	if !errors.Is(err, ErrUnknownProcess) {
+		t.Fatalf("expected an unknown dependency error, got %v", err)
+	}
+}
+
+func TestDependencyOrder(t *testing.T) {
+	master := newTestMaster(t, "db", "api", "web", "worker")
+	runSleeper(t, master, &Preparable{Name: "db"})
+	runSleeper(t, master, &Preparable{Name: "api", DependsOn: []string{"db"}})
+	runSleeper(t, master, &Preparable{Name: "web", DependsOn: []string{"api"}})
+	runSleeper(t, master, &Preparable{Name: "worker"})
+
+	master.Lock()
+	order, err := master.dependencyOrder([]string{"web", "worker", "api", "db"}, nil)
+	master.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(order, " "); got != "db api web worker" {
+		t.Fatalf("order = %q", got)
+	}
+}
+
+func TestStopInReverseDependencyOrder(t *testing.T) {
+	master := newTestMaster(t, "db", "api", "web")
+	stopped := filepath.Join(t.TempDir(), "stopped")
+	hook := []string{"/bin/sh", "-c", "echo $APM_PROC_NAME >> " + stopped}
+	runSleeper(t, master, &Preparable{Name: "db", PreStop: hook})
+	runSleeper(t, master, &Preparable{Name: "api", PreStop: hook, DependsOn: []string{"db"}})
+	runSleeper(t, master, &Preparable{Name: "web", PreStop: hook, DependsOn: []string{"api"}})
+
+	master.Stop()
+	b, err := os.ReadFile(stopped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(strings.Fields(string(b)), " "); got != "web api db" {
+		t.Fatalf("stop order = %q", got)
+	}
+}
+
+func TestWaitHealthyDependency(t *testing.T) {
+	master := newTestMaster(t, "db", "api")
+	healthy := filepath.Join(t.TempDir(), "healthy")
+	runSleeper(t, master, &Preparable{
+		Name:        "db",
+		HealthCheck: &HealthCheck{Type: HealthCheckExec, Command: []string{"test", "-f", healthy}, Interval: 10 * time.Millisecond},
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- master.RunPreparable(&Preparable{
+			Name:                "api",
+			Cmd:                 "/bin/sh",
+			Args:                []string{"-c", "exec sleep 30"},
+			SysFolder:           master.SysFolder,
+			DependsOn:           []string{"db"},
+			DependencyCondition: DependencyHealthy,
+		})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("api started before db was healthy: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(healthy, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("api did not start once db was healthy")
+	}
+}
+
+func TestRestartWithDependencies(t *testing.T) {
+	master := newTestMaster(t, "db", "api", "web")
+	runSleeper(t, master, &Preparable{Name: "db"})
+	runSleeper(t, master, &Preparable{Name: "api", DependsOn: []string{"db"}, RestartWithDependencies: true})
+	runSleeper(t, master, &Preparable{Name: "web", DependsOn: []string{"db"}})
+	master.Lock()
+	apiPid := master.Procs["api"].GetPid()
+	webPid := master.Procs["web"].GetPid()
+	master.Unlock()
+
+	if err := master.RestartProcess("db"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		master.Lock()
+		pid := master.Procs["api"].GetPid()
+		alive := master.Procs["api"].IsAlive()
+		master.Unlock()
+		if pid != apiPid && alive {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected api to be restarted with db")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	master.Lock()
+	defer master.Unlock()
+	if master.Procs["web"].GetPid() != webPid {
+		t.Fatal("expected web not to be restarted, it did not opt in")
+	}
+}
+
+func TestReviveSkipsUnmetDependencies(t *testing.T) {
+	master := newTestMaster(t, "setup", "audit", "db", "web")
+	runSleeper(t, master, &Preparable{Name: "setup"})
+	// setup is not kept alive, so it is not revived and audit, revived first, can't be either.
+	runSleeper(t, master, &Preparable{Name: "audit", KeepAlive: true, DependsOn: []string{"setup"}})
+	runSleeper(t, master, &Preparable{Name: "db", KeepAlive: true})
+	runSleeper(t, master, &Preparable{Name: "web", KeepAlive: true, DependsOn: []string{"db"}})
+	if err := master.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	revived := NewMaster(master.getConfigPath())
+	t.Cleanup(func() { revived.Stop() })
+	revived.Lock()
+	defer revived.Unlock()
+	for name, alive := range map[string]bool{"setup": false, "audit": false, "db": true, "web": true} {
+		if revived.Procs[name].IsAlive() != alive {
+			t.Errorf("expected %s alive to be %t", name, alive)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+)
+
+// Health check types supported by HealthCheck.
+const (
+	HealthCheckHTTP = "http" // GET URL and compare the response status
+	HealthCheckTCP  = "tcp"  // connect to Address
+	HealthCheckExec = "exec" // run Command, a zero exit code means healthy
+)
+
+// Health states reported in HealthStatus.
+const (
+	HealthUnknown   = "unknown"   // no check completed yet
+	HealthHealthy   = "healthy"   // last check passed
+	HealthUnhealthy = "unhealthy" // FailureThreshold consecutive checks failed
+)
+
+// Default values used when a HealthCheck field is left empty.
+const (
+	DefaultHealthInterval         = 10 * time.Second
+	DefaultHealthTimeout          = time.Second
+	DefaultHealthFailureThreshold = 3
+)
+
+// HealthCheck describes how Master probes a running process.
+type HealthCheck struct {
+	Type             string        // http, tcp or exec.
+	URL              string        // URL requested by http checks.
+	ExpectedStatus   int           // status expected by http checks. Zero accepts any 2xx or 3xx.
+	Address          string        // host:port dialed by tcp checks.
+	Command          []string      // command and arguments run by exec checks.
+	InitialDelay     time.Duration // delay before the first check after the process starts.
+	Interval         time.Duration // delay between two checks.
+	Timeout          time.Duration // timeout of a single check.
+	FailureThreshold int           // consecutive failures before the process is marked as unhealthy.
+	RestartOnFailure bool          // restart the process once it is unhealthy.
+	ReadyTimeout     time.Duration // how long start and restart wait for the first passing check. Zero does not wait.
+}
+
+// HealthStatus is the result of the health checks of a process.
+type HealthStatus struct {
+	State     string    // unknown, healthy or unhealthy.
+	Ready     bool      // true once a check passed since the last start.
+	Failures  int       // consecutive failed checks.
+	LastCheck time.Time // when the last check completed.
+	LastError string    // error of the last failed check.
+}
+
+// Validate will check that the health check is well formed.
+// Returns an error in case there's any.
+func (hc *HealthCheck) Validate() error {
+	switch hc.Type {
+	case HealthCheckHTTP:
+		if hc.URL == "" {
+			return errors.New("http health check needs an url")
+		}
+	case HealthCheckTCP:
+		if hc.Address == "" {
+			return errors.New("tcp health check needs an address")
+		}
+	case HealthCheckExec:
+		if len(hc.Command) == 0 {
+			return errors.New("exec health check needs a command")
+		}
+	default:
+		return fmt.Errorf("unknown health check type %q", hc.Type)
+	}
+	return nil
+}
+
+func (hc *HealthCheck) interval() time.Duration {
+	if hc.Interval <= 0 {
+		return DefaultHealthInterval
+	}
+	return hc.Interval
+}
+
+func (hc *HealthCheck) timeout() time.Duration {
+	if hc.Timeout <= 0 {
+		return DefaultHealthTimeout
+	}
+	return hc.Timeout
+}
+
+func (hc *HealthCheck) failureThreshold() int {
+	if hc.FailureThreshold <= 0 {
+		return DefaultHealthFailureThreshold
+	}
+	return hc.FailureThreshold
+}
+
+// Probe will run the check once.
+// Returns an error in case the check failed.
+func (hc *HealthCheck) Probe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.timeout())
+	defer cancel()
+
+	switch hc.Type {
+	case HealthCheckHTTP:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.URL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if hc.ExpectedStatus > 0 && resp.StatusCode != hc.ExpectedStatus {
+			return fmt.Errorf("unexpected status %d, want %d", resp.StatusCode, hc.ExpectedStatus)
+		}
+		if hc.ExpectedStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode >= 400) {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	case HealthCheckTCP:
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", hc.Address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case HealthCheckExec:
+		return exec.CommandContext(ctx, hc.Command[0], hc.Command[1:]...).Run()
+	}
+	return hc.Validate()
+}
+
+// healthMonitor runs the health check of a single proc run. A new monitor is
+// created every time the proc is started.
+type healthMonitor struct {
+	proc  ProcContainer
+	check HealthCheck
+	stop  chan struct{}
+	ready chan struct{}
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+func (master *Master) startHealth(proc ProcContainer) {
+	master.stopHealth(proc.Identifier())
+
+	status := proc.GetStatus()
+	check := proc.GetHealthCheck()
+	if check == nil {
+		status.Health = HealthStatus{}
+		return
+	}
+	status.Health = HealthStatus{State: HealthUnknown}
+	if err := check.Validate(); err != nil {
+		log.Printf("Proc %s has an invalid health check: %s", proc.Identifier(), err)
+		return
+	}
+
+	if master.health == nil {
+		master.health = make(map[string]*healthMonitor)
+	}
+	monitor := &healthMonitor{
+		proc:  proc,
+		check: *check,
+		stop:  make(chan struct{}),
+		ready: make(chan struct{}),
+	}
+	master.health[proc.Identifier()] = monitor
+	go master.runHealth(monitor)
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+func (master *Master) stopHealth(name string) {
+	if monitor, ok := master.health[name]; ok {
+		close(monitor.stop)
+		delete(master.health, name)
+	}
+}
+
+func (master *Master) runHealth(monitor *healthMonitor) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-monitor.stop
+		cancel()
+	}()
+
+	delay := monitor.check.InitialDelay
+	for {
+		select {
+		case <-monitor.stop:
+			return
+		case <-time.After(delay):
+		}
+		err := monitor.check.Probe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		master.Lock()
+		master.recordHealth(monitor, err)
+		master.Unlock()
+		delay = monitor.check.interval()
+	}
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+func (master *Master) recordHealth(monitor *healthMonitor, err error) {
+	proc := monitor.proc
+	// The proc may have been stopped or restarted while the check was running.
+	if master.health[proc.Identifier()] != monitor {
+		return
+	}
+
+	health := &proc.GetStatus().Health
+	health.LastCheck = time.Now()
+	if err == nil {
+		if !health.Ready {
+			health.Ready = true
+			close(monitor.ready)
+		}
+		if health.State == HealthUnhealthy {
+			log.Printf("Proc %s is healthy again.", proc.Identifier())
+		}
+		health.State = HealthHealthy
+		health.Failures = 0
+		health.LastError = ""
+		return
+	}
+
+	health.Failures++
+	health.LastError = err.Error()
+	if health.Failures < monitor.check.failureThreshold() || health.State == HealthUnhealthy {
+		return
+	}
+	health.State = HealthUnhealthy
+	log.Printf("Proc %s is unhealthy after %d failed checks: %s", proc.Identifier(), health.Failures, err)
+	if !monitor.check.RestartOnFailure {
+		return
+	}
+
+	master.stopAndRestart(proc, "failed health check")
+}
+
+// waitReady will block until the proc name passes its first health check after a start.
+// Procs without a health check or without ReadyTimeout are ready right away.
+// Returns an error in case the proc did not become ready in time.
+func (master *Master) waitReady(name string) error {
+	master.Lock()
+	monitor, ok := master.health[name]
+	master.Unlock()
+	if !ok || monitor.check.ReadyTimeout <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(monitor.check.ReadyTimeout)
+	defer timer.Stop()
+	select {
+	case <-monitor.ready:
+		return nil
+	case <-monitor.stop:
+		return fmt.Errorf("proc %s stopped before becoming ready", name)
+	case <-timer.C:
+		return fmt.Errorf("proc %s did not become ready within %s", name, monitor.check.ReadyTimeout)
+	}
+}
@@ -0,0 +1,178 @@
+package process
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cases := []struct {
+		check   HealthCheck
+		healthy bool
+	}{
+		{HealthCheck{Type: HealthCheckHTTP, URL: srv.URL + "/up"}, true},
+		{HealthCheck{Type: HealthCheckHTTP, URL: srv.URL + "/down"}, false},
+		{HealthCheck{Type: HealthCheckHTTP, URL: srv.URL + "/down", ExpectedStatus: http.StatusServiceUnavailable}, true},
+		{HealthCheck{Type: HealthCheckTCP, Address: srv.Listener.Addr().String()}, true},
+		{HealthCheck{Type: HealthCheckTCP, Address: addr}, false},
+		{HealthCheck{Type: HealthCheckExec, Command: []string{"true"}}, true},
+		{HealthCheck{Type: HealthCheckExec, Command: []string{"false"}}, false},
+		{HealthCheck{Type: HealthCheckExec, Command: []string{"sleep", "5"}, Timeout: 50 * time.Millisecond}, false},
+	}
+	for i, c := range cases {
+		err := c.check.Probe(context.Background())
+		if (err == nil) != c.healthy {
+			t.Errorf("case %d: Probe() = %v, want healthy %v", i, err, c.healthy)
+		}
+	}
+}
+
+func TestHealthCheckValidate(t *testing.T) {
+	for _, hc := range []HealthCheck{{}, {Type: "udp"}, {Type: HealthCheckHTTP}, {Type: HealthCheckTCP}, {Type: HealthCheckExec}} {
+		if err := hc.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", hc)
+		}
+	}
+}
+
+func TestMasterRestartsUnhealthyProc(t *testing.T) {
+	master := newTestMaster(t, "sick")
+	err := master.RunPreparable(&Preparable{
+		Name:      "sick",
+		Cmd:       "/bin/sh",
+		Args:      []string{"-c", "sleep 30"},
+		SysFolder: master.SysFolder,
+		HealthCheck: &HealthCheck{
+			Type:             HealthCheckExec,
+			Command:          []string{"false"},
+			Interval:         10 * time.Millisecond,
+			FailureThreshold: 2,
+			RestartOnFailure: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status ProcStatus
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		master.Lock()
+		status = *master.Procs["sick"].GetStatus()
+		master.Unlock()
+		if status.Restarts >= 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.Restarts < 1 {
+		t.Fatalf("unhealthy proc was not restarted: %+v", status)
+	}
+}
+
+func TestMasterUnhealthyCrashLoop(t *testing.T) {
+	master := newTestMaster(t, "sick")
+	err := master.RunPreparable(&Preparable{
+		Name:      "sick",
+		Cmd:       "/bin/sh",
+		Args:      []string{"-c", "sleep 30"},
+		SysFolder: master.SysFolder,
+		HealthCheck: &HealthCheck{
+			Type:             HealthCheckExec,
+			Command:          []string{"false"},
+			Interval:         10 * time.Millisecond,
+			FailureThreshold: 1,
+			RestartOnFailure: true,
+		},
+		RestartPolicy: RestartPolicy{
+			InitialBackoff: 10 * time.Millisecond,
+			MaxBackoff:     20 * time.Millisecond,
+			MaxRestarts:    3,
+			Window:         time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status ProcStatus
+	var alive bool
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		master.Lock()
+		status = *master.Procs["sick"].GetStatus()
+		alive = master.Procs["sick"].IsAlive()
+		master.Unlock()
+		if status.Status == "errored" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.Status != "errored" || status.Restarts != 3 || !strings.Contains(status.Reason, "health check") {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if alive {
+		t.Fatal("expected the crash looping proc to be stopped")
+	}
+}
+
+func TestMasterReadinessGate(t *testing.T) {
+	master := newTestMaster(t, "ready", "never")
+
+	err := master.RunPreparable(&Preparable{
+		Name:      "ready",
+		Cmd:       "/bin/sh",
+		Args:      []string{"-c", "sleep 30"},
+		SysFolder: master.SysFolder,
+		HealthCheck: &HealthCheck{
+			Type:         HealthCheckExec,
+			Command:      []string{"true"},
+			Interval:     10 * time.Millisecond,
+			ReadyTimeout: 5 * time.Second,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	master.Lock()
+	health := master.Procs["ready"].GetStatus().Health
+	master.Unlock()
+	if !health.Ready || health.State != HealthHealthy {
+		t.Fatalf("unexpected health %+v", health)
+	}
+
+	err = master.RunPreparable(&Preparable{
+		Name:      "never",
+		Cmd:       "/bin/sh",
+		Args:      []string{"-c", "sleep 30"},
+		SysFolder: master.SysFolder,
+		HealthCheck: &HealthCheck{
+			Type:         HealthCheckExec,
+			Command:      []string{"false"},
+			Interval:     10 * time.Millisecond,
+			ReadyTimeout: 100 * time.Millisecond,
+		},
+	})
+	if err == nil {
+		t.Fatal("expected a readiness timeout")
+	}
+}
@@ -0,0 +1,397 @@
+package process
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spcent/x/helper"
+)
+
+// Log streams of a process.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+const (
+	logBufferSize    = 1000                    // recent lines kept in memory per process
+	logBackupLayout  = "20060102-150405.000"   // suffix appended to rotated log files
+	logTimeLayout    = time.RFC3339Nano        // timestamp prefixed to every stored line
+	logMaxFollowWait = 30 * time.Second        // upper bound of a single follow request
+	logTailChunk     = int64(64 * 1024)        // block size used to read a log file backwards
+	logCompressExt   = ".gz"                   // extension of compressed backups
+	logCompressTmp   = logCompressExt + ".tmp" // extension of backups being compressed
+)
+
+// LogRotation describes how the output files of a process are rotated.
+// The zero value never rotates.
+type LogRotation struct {
+	MaxSize    int64         // rotate once the file would grow past MaxSize bytes. Zero disables size rotation.
+	Interval   time.Duration // rotate files older than Interval. Zero disables time rotation.
+	MaxBackups int           // rotated files kept per stream. Zero keeps them all.
+	MaxAge     time.Duration // rotated files older than MaxAge are removed. Zero keeps them all.
+	Compress   bool          // gzip rotated files.
+}
+
+// LogLine is a single line written by a process.
+type LogLine struct {
+	Seq    uint64    // position of the line in the process log buffer, zero for lines read from files
+	Time   time.Time // when the line was written
+	Stream string    // stdout or stderr
+	Text   string    // line content without the trailing new line
+}
+
+// rotatingFile is an append only file rotated according to a LogRotation.
+// The runs of a process writing at the same time, ie: during a reload, share it so they
+// rotate it together. It is closed once the last of them is done.
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	rotation LogRotation
+	f        *os.File
+	size     int64
+	openedAt time.Time
+	refs     int // writers holding the file open
+}
+
+func openRotatingFile(path string, rotation LogRotation) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, rotation: rotation}
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// acquire will open the file for one more writer, reusing it if it is already open.
+// Every acquire must be followed by a Close.
+// Returns an error in case there's any.
+func (r *rotatingFile) acquire() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.refs == 0 {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	r.refs++
+	return nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := helper.GetFile(r.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = info.Size()
+	r.openedAt = time.Now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			log.Printf("Could not rotate %s due to %s.", r.path, err)
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) shouldRotate(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.rotation.MaxSize > 0 && r.size+n > r.rotation.MaxSize {
+		return true
+	}
+	return r.rotation.Interval > 0 && time.Since(r.openedAt) >= r.rotation.Interval
+}
+
+// rotate will move the current file aside and open a new one at the same path.
+// The current file is renamed while still open, so writes keep going to it if anything fails.
+// Returns an error in case there's any.
+func (r *rotatingFile) rotate() error {
+	backup := r.path + "." + time.Now().Format(logBackupLayout)
+	if err := os.Rename(r.path, backup); err != nil {
+		return err
+	}
+	old := r.f
+	if err := r.open(); err != nil {
+		return err
+	}
+	if err := old.Close(); err != nil {
+		log.Printf("Could not close %s due to %s.", backup, err)
+	}
+	go func() {
+		if r.rotation.Compress {
+			if err := compressFile(backup); err != nil {
+				log.Printf("Could not compress %s due to %s.", backup, err)
+			}
+		}
+		if err := pruneBackups(r.path, r.rotation); err != nil {
+			log.Printf("Could not prune backups of %s due to %s.", r.path, err)
+		}
+	}()
+	return nil
+}
+
+// Close will release the file, closing it once no writer holds it anymore.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refs--
+	if r.refs > 0 {
+		return nil
+	}
+	return r.f.Close()
+}
+
+// compressFile will gzip path into path.gz and remove path afterwards.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + logCompressTmp
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+logCompressExt)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// logBackups returns the rotated files of path, oldest first.
+func logBackups(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	backups := matches[:0]
+	for _, m := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(m, path+"."), logCompressExt)
+		if _, err := time.Parse(logBackupLayout, suffix); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// pruneBackups will remove the rotated files of path that exceed the retention of rotation.
+func pruneBackups(path string, rotation LogRotation) error {
+	backups, err := logBackups(path)
+	if err != nil {
+		return err
+	}
+	for i, backup := range backups {
+		expired := rotation.MaxBackups > 0 && i < len(backups)-rotation.MaxBackups
+		if !expired && rotation.MaxAge > 0 {
+			info, err := os.Stat(backup)
+			expired = err == nil && time.Since(info.ModTime()) > rotation.MaxAge
+		}
+		if expired {
+			if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// logBuffer keeps the most recent lines of a process so they can be followed remotely.
+type logBuffer struct {
+	mu      sync.Mutex
+	lines   []LogLine // ring of at most logBufferSize lines
+	next    uint64    // sequence of the next line
+	changed chan struct{}
+}
+
+func newLogBuffer() *logBuffer {
+	return &logBuffer{next: 1, changed: make(chan struct{})}
+}
+
+func (b *logBuffer) add(line LogLine) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	line.Seq = b.next
+	b.next++
+	if len(b.lines) < logBufferSize {
+		b.lines = append(b.lines, line)
+	} else {
+		b.lines[int(line.Seq-1)%logBufferSize] = line
+	}
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// last returns the sequence of the last line added.
+func (b *logBuffer) last() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.next - 1
+}
+
+// since returns the lines added after seq, waiting up to wait for new lines if there's none.
+func (b *logBuffer) since(seq uint64, wait time.Duration) []LogLine {
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	for {
+		b.mu.Lock()
+		var res []LogLine
+		first := b.next - uint64(len(b.lines))
+		if seq+1 < first {
+			seq = first - 1
+		}
+		for s := seq + 1; s < b.next; s++ {
+			res = append(res, b.lines[int(s-1)%logBufferSize])
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		if len(res) > 0 {
+			return res
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return nil
+		}
+	}
+}
+
+// pipeLogs will copy every line read from r to w prefixed with its timestamp, and to buffer.
+// It closes r and w once the process closes its end of the pipe.
+func pipeLogs(stream string, r io.ReadCloser, w io.WriteCloser, buffer *logBuffer) {
+	defer r.Close()
+	defer w.Close()
+
+	reader := bufio.NewReader(r)
+	for {
+		text, err := reader.ReadString('\n')
+		if text != "" {
+			now := time.Now()
+			text = strings.TrimSuffix(text, "\n")
+			if _, werr := io.WriteString(w, now.Format(logTimeLayout)+" "+text+"\n"); werr != nil {
+				log.Printf("Could not write %s log due to %s.", stream, werr)
+			}
+			buffer.add(LogLine{Time: now, Stream: stream, Text: text})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// tailLogFile returns the last n lines stored in path.
+func tailLogFile(path string, stream string, n int) ([]LogLine, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read backwards until there's more than n new lines, the first one may be partial.
+	end := info.Size()
+	off := end
+	var data []byte
+	for off > 0 && strings.Count(string(data), "\n") <= n {
+		size := min(logTailChunk, off)
+		off -= size
+		chunk := make([]byte, size)
+		if _, err := f.ReadAt(chunk, off); err != nil {
+			return nil, err
+		}
+		data = append(chunk, data...)
+	}
+
+	rows := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if off > 0 {
+		rows = rows[1:]
+	}
+	if len(rows) > n {
+		rows = rows[len(rows)-n:]
+	}
+	lines := make([]LogLine, 0, len(rows))
+	for _, row := range rows {
+		if row == "" && end == 0 {
+			continue
+		}
+		lines = append(lines, parseLogLine(stream, row))
+	}
+	return lines, nil
+}
+
+// parseLogLine splits a stored line into its timestamp and text. Lines written before
+// the timestamp prefix was introduced are returned with a zero Time.
+func parseLogLine(stream string, row string) LogLine {
+	line := LogLine{Stream: stream, Text: row}
+	if ts, text, ok := strings.Cut(row, " "); ok {
+		if t, err := time.Parse(logTimeLayout, ts); err == nil {
+			line.Time = t
+			line.Text = text
+		}
+	}
+	return line
+}
+
+// mergeLogLines merges stdout and stderr lines by time and keeps the last n.
+func mergeLogLines(n int, streams ...[]LogLine) []LogLine {
+	var lines []LogLine
+	for _, s := range streams {
+		lines = append(lines, s...)
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
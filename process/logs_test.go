@@ -0,0 +1,209 @@
+package process
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.out")
+	w, err := openRotatingFile(path, LogRotation{MaxSize: 10, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// Backups are named by millisecond.
+		time.Sleep(2 * time.Millisecond)
+	}
+	w.Close()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "fourth\n" {
+		t.Fatalf("current file = %q", b)
+	}
+
+	var backups []string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		backups, _ = filepath.Glob(path + ".*")
+		if len(backups) == 2 && strings.HasSuffix(backups[0], logCompressExt) && strings.HasSuffix(backups[1], logCompressExt) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want 2", backups)
+	}
+	f, err := os.Open(backups[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "third\n" {
+		t.Fatalf("newest backup = %q", b)
+	}
+}
+
+func TestRotatingFileRenameFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.out")
+	w, err := openRotatingFile(path, LogRotation{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write([]byte("first line\n")); err != nil {
+		t.Fatal(err)
+	}
+	// Renaming fails once the directory is gone, the open file must stay usable.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := w.Write([]byte("second line\n")); err != nil {
+			t.Fatalf("write after failed rotation: %v", err)
+		}
+	}
+}
+
+func TestRotatingFileShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.out")
+	w, err := openRotatingFile(path, LogRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.acquire(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if _, err := w.Write([]byte("still open\n")); err != nil {
+		t.Fatalf("expected the file to stay open for the other writer: %v", err)
+	}
+	w.Close()
+	if _, err := w.Write([]byte("closed\n")); err == nil {
+		t.Fatal("expected the file to be closed once both writers are done")
+	}
+
+	// A new run reopens the file.
+	if err := w.acquire(); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("reopened\n"))
+	w.Close()
+	b, err := os.ReadFile(path)
+	if err != nil || string(b) != "still open\nreopened\n" {
+		t.Fatalf("unexpected content %q %v", b, err)
+	}
+}
+
+func TestTailLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.err")
+	now := time.Now()
+	var sb strings.Builder
+	sb.WriteString("legacy line\n")
+	for i := 0; i < 5; i++ {
+		sb.WriteString(now.Add(time.Duration(i)*time.Second).Format(logTimeLayout) + " line " + string(rune('a'+i)) + "\n")
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := tailLogFile(path, StreamStderr, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0].Text != "line d" || lines[1].Text != "line e" || lines[1].Stream != StreamStderr {
+		t.Fatalf("unexpected lines %+v", lines)
+	}
+	if !lines[1].Time.Equal(now.Add(4 * time.Second)) {
+		t.Fatalf("time = %s", lines[1].Time)
+	}
+
+	lines, err = tailLogFile(path, StreamStderr, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 6 || lines[0].Text != "legacy line" || !lines[0].Time.IsZero() {
+		t.Fatalf("unexpected lines %+v", lines)
+	}
+
+	lines, err = tailLogFile(filepath.Join(t.TempDir(), "missing"), StreamStdout, 10)
+	if err != nil || len(lines) != 0 {
+		t.Fatalf("missing file: %v %v", lines, err)
+	}
+}
+
+func TestLogBufferOverflow(t *testing.T) {
+	b := newLogBuffer()
+	for i := 0; i < logBufferSize+10; i++ {
+		b.add(LogLine{Text: "x"})
+	}
+	lines := b.since(0, time.Millisecond)
+	if len(lines) != logBufferSize || lines[0].Seq != 11 || lines[len(lines)-1].Seq != logBufferSize+10 {
+		t.Fatalf("got %d lines from %d", len(lines), lines[0].Seq)
+	}
+	if lines := b.since(b.last(), 10*time.Millisecond); lines != nil {
+		t.Fatalf("expected no new lines, got %d", len(lines))
+	}
+}
+
+func TestRemoteLogs(t *testing.T) {
+	master := newTestMaster(t, "talker")
+	err := master.RunPreparable(&Preparable{
+		Name:      "talker",
+		Cmd:       "/bin/sh",
+		Args:      []string{"-c", "echo hello; echo oops >&2; sleep 0.3; echo later; sleep 30"},
+		SysFolder: master.SysFolder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newTestClient(t, master, PermissionRead)
+
+	time.Sleep(100 * time.Millisecond)
+	stream, err := client.Logs("talker", 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	got := map[string]string{}
+	timeout := time.After(5 * time.Second)
+	for len(got) < 3 {
+		select {
+		case line, ok := <-stream.Lines():
+			if !ok {
+				t.Fatalf("stream closed: %v", stream.Err())
+			}
+			if line.Time.IsZero() {
+				t.Fatalf("line without time %+v", line)
+			}
+			got[line.Text] = line.Stream
+		case <-timeout:
+			t.Fatalf("timed out, got %v", got)
+		}
+	}
+	if got["hello"] != StreamStdout || got["oops"] != StreamStderr || got["later"] != StreamStdout {
+		t.Fatalf("unexpected lines %v", got)
+	}
+}
@@ -0,0 +1,565 @@
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest actions computed by Master.Diff.
+const (
+	ActionStart   = "start"   // the process is missing or not running
+	ActionStop    = "stop"    // the process is running but disabled in the manifest
+	ActionRestart = "restart" // the process runs with an outdated spec and is replaced
+	ActionDelete  = "delete"  // the process is not in the manifest anymore
+)
+
+// Duration is a time.Duration written in manifests as a string, ie: 1m30s.
+type Duration time.Duration
+
+// MarshalText will format the duration as a string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText will parse a duration string.
+// Returns an error in case there's any.
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Manifest describes all the apps a master should run.
+type Manifest struct {
+	Prune bool      `toml:"prune" yaml:"prune"` // delete the processes that are not in the manifest
+	Apps  []AppSpec `toml:"apps" yaml:"apps"`
+}
+
+// AppSpec describes an app of a manifest.
+type AppSpec struct {
+	Name            string   `toml:"name" yaml:"name"`
+	Language        string   `toml:"language" yaml:"language"` // go, binary, shell or an interpreted language
+	Source          string   `toml:"source" yaml:"source"`     // go package, binary, shell command or script
+	Args            []string `toml:"args" yaml:"args"`
+	Env             []string `toml:"env" yaml:"env"`
+	Interpreter     string   `toml:"interpreter" yaml:"interpreter"`
+	InterpreterArgs []string `toml:"interpreter_args" yaml:"interpreter_args"`
+	Dir             string   `toml:"dir" yaml:"dir"`
+	User            string   `toml:"user" yaml:"user"`
+	Group           string   `toml:"group" yaml:"group"`
+	Umask           string   `toml:"umask" yaml:"umask"`
+	KeepAlive       bool     `toml:"keep_alive" yaml:"keep_alive"`
+	MaxMemory       uint64   `toml:"max_memory" yaml:"max_memory"`   // bytes
+	Instances       int      `toml:"instances" yaml:"instances"`     // defaults to 1
+	Base            int      `toml:"base" yaml:"base"`               // value of {{base}} in templates, see Cluster
+	Disabled        bool     `toml:"disabled" yaml:"disabled"`       // keep the processes stopped
+	DependsOn       []string `toml:"depends_on" yaml:"depends_on"`   // apps started before this one
+	Listeners       []string `toml:"listeners" yaml:"listeners"`     // sockets handed to the process, ie: tcp://:8080
+	StopSignal      string   `toml:"stop_signal" yaml:"stop_signal"` // defaults to SIGTERM
+	StopTimeout     Duration `toml:"stop_timeout" yaml:"stop_timeout"`
+	PostStart       []string `toml:"post_start" yaml:"post_start"` // command run after every start
+	PreStop         []string `toml:"pre_stop" yaml:"pre_stop"`     // command run before every stop
+
+	DependencyCondition     string `toml:"dependency_condition" yaml:"dependency_condition"`           // running, the default, or healthy
+	RestartWithDependencies bool   `toml:"restart_with_dependencies" yaml:"restart_with_dependencies"` // restart after a dependency restarts
+
+	Restart   *RestartSpec   `toml:"restart" yaml:"restart"`
+	Health    *HealthSpec    `toml:"health" yaml:"health"`
+	Logs      *LogSpec       `toml:"logs" yaml:"logs"`
+	Readiness *ReadinessSpec `toml:"readiness" yaml:"readiness"`
+}
+
+// RestartSpec is the manifest form of RestartPolicy.
+type RestartSpec struct {
+	Mode           string   `toml:"mode" yaml:"mode"`
+	SuccessCodes   []int    `toml:"success_codes" yaml:"success_codes"`
+	InitialBackoff Duration `toml:"initial_backoff" yaml:"initial_backoff"`
+	MaxBackoff     Duration `toml:"max_backoff" yaml:"max_backoff"`
+	MaxRestarts    int      `toml:"max_restarts" yaml:"max_restarts"`
+	Window         Duration `toml:"window" yaml:"window"`
+}
+
+// HealthSpec is the manifest form of HealthCheck.
+type HealthSpec struct {
+	Type             string   `toml:"type" yaml:"type"`
+	URL              string   `toml:"url" yaml:"url"`
+	ExpectedStatus   int      `toml:"expected_status" yaml:"expected_status"`
+	Address          string   `toml:"address" yaml:"address"`
+	Command          []string `toml:"command" yaml:"command"`
+	InitialDelay     Duration `toml:"initial_delay" yaml:"initial_delay"`
+	Interval         Duration `toml:"interval" yaml:"interval"`
+	Timeout          Duration `toml:"timeout" yaml:"timeout"`
+	FailureThreshold int      `toml:"failure_threshold" yaml:"failure_threshold"`
+	RestartOnFailure bool     `toml:"restart_on_failure" yaml:"restart_on_failure"`
+	ReadyTimeout     Duration `toml:"ready_timeout" yaml:"ready_timeout"`
+}
+
+// LogSpec is the manifest form of LogRotation.
+type LogSpec struct {
+	MaxSize    int64    `toml:"max_size" yaml:"max_size"`
+	Interval   Duration `toml:"interval" yaml:"interval"`
+	MaxBackups int      `toml:"max_backups" yaml:"max_backups"`
+	MaxAge     Duration `toml:"max_age" yaml:"max_age"`
+	Compress   bool     `toml:"compress" yaml:"compress"`
+}
+
+// ReadinessSpec is the manifest form of Readiness.
+type ReadinessSpec struct {
+	File    string   `toml:"file" yaml:"file"`
+	Notify  bool     `toml:"notify" yaml:"notify"`
+	Timeout Duration `toml:"timeout" yaml:"timeout"`
+}
+
+// ManifestAction is a change needed to converge to a manifest.
+type ManifestAction struct {
+	Action string // start, stop, restart or delete
+	Name   string // process name
+	Reason string // why the action is needed
+}
+
+func (a ManifestAction) String() string {
+	return fmt.Sprintf("%s %s: %s", a.Action, a.Name, a.Reason)
+}
+
+// LoadManifest will read a manifest from a .toml, .yaml or .yml file.
+// Returns an error in case there's any.
+func LoadManifest(path string) (*Manifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(b, filepath.Ext(path))
+}
+
+// ParseManifest will decode a manifest written in format, either toml or yaml, and validate it.
+// Returns an error in case there's any.
+func ParseManifest(b []byte, format string) (*Manifest, error) {
+	manifest := &Manifest{}
+	var err error
+	switch format {
+	case "toml", ".toml":
+		err = toml.Unmarshal(b, manifest)
+	case "yaml", ".yaml", "yml", ".yml":
+		err = yaml.Unmarshal(b, manifest)
+	default:
+		return nil, fmt.Errorf("unknown manifest format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return manifest, manifest.Validate()
+}
+
+// Validate will check the apps of the manifest are well formed and their dependencies have no cycle.
+// Returns an error in case there's any.
+func (manifest *Manifest) Validate() error {
+	apps := make(map[string]bool, len(manifest.Apps))
+	names := make(map[string]string)
+	for i := range manifest.Apps {
+		app := &manifest.Apps[i]
+		if app.Name == "" {
+			return fmt.Errorf("app #%d has no name", i+1)
+		}
+		if apps[app.Name] {
+			return fmt.Errorf("app %s is declared twice", app.Name)
+		}
+		apps[app.Name] = true
+		if app.Instances < 0 {
+			return fmt.Errorf("app %s has a negative number of instances", app.Name)
+		}
+		if _, err := parseUmask(app.Umask); err != nil {
+			return fmt.Errorf("app %s: %w", app.Name, err)
+		}
+		cluster := app.cluster()
+		if err := cluster.Validate(); err != nil {
+			return fmt.Errorf("app %s: %w", app.Name, err)
+		}
+		if _, err := parseSignal(app.StopSignal); err != nil {
+			return fmt.Errorf("app %s: %w", app.Name, err)
+		}
+		if !validDependencyCondition(app.DependencyCondition) {
+			return fmt.Errorf("app %s has an unknown dependency condition %q", app.Name, app.DependencyCondition)
+		}
+		for _, listener := range app.Listeners {
+			if _, _, err := parseListener(listener); err != nil {
+				return fmt.Errorf("app %s: %w", app.Name, err)
+			}
+		}
+		if app.Health != nil {
+			if err := cluster.Template.HealthCheck.Validate(); err != nil {
+				return fmt.Errorf("app %s: %w", app.Name, err)
+			}
+		}
+		for j := 0; j < app.instances(); j++ {
+			name := instanceName(app.Name, j)
+			if other, ok := names[name]; ok {
+				return fmt.Errorf("app %s and app %s both have a process named %s", other, app.Name, name)
+			}
+			names[name] = app.Name
+		}
+	}
+
+	for _, app := range manifest.Apps {
+		for _, dep := range app.DependsOn {
+			if !apps[dep] {
+				return fmt.Errorf("app %s depends on unknown app %s", app.Name, dep)
+			}
+		}
+	}
+	_, err := manifest.sortedApps()
+	return err
+}
+
+// sortedApps returns the apps ordered by their dependencies.
+func (manifest *Manifest) sortedApps() ([]*AppSpec, error) {
+	byName := make(map[string]*AppSpec, len(manifest.Apps))
+	names := make([]string, 0, len(manifest.Apps))
+	deps := make(map[string][]string, len(manifest.Apps))
+	for i := range manifest.Apps {
+		app := &manifest.Apps[i]
+		byName[app.Name] = app
+		names = append(names, app.Name)
+		deps[app.Name] = app.DependsOn
+	}
+	sorted, err := sortByDependencies(names, deps)
+	if err != nil {
+		return nil, err
+	}
+	apps := make([]*AppSpec, 0, len(sorted))
+	for _, name := range sorted {
+		apps = append(apps, byName[name])
+	}
+	return apps, nil
+}
+
+func (app *AppSpec) instances() int {
+	if app.Instances == 0 {
+		return 1
+	}
+	return app.Instances
+}
+
+// instanceName returns the process name of instance index of app. The first instance
+// is named after the app so scaling an app up does not rename it.
+func instanceName(app string, index int) string {
+	if index == 0 {
+		return app
+	}
+	return app + "-" + strconv.Itoa(index)
+}
+
+// cluster returns the cluster running the instances of the app.
+func (app *AppSpec) cluster() *Cluster {
+	command := Command{
+		Language:        app.Language,
+		Source:          app.Source,
+		KeepAlive:       app.KeepAlive,
+		Args:            app.Args,
+		Env:             app.Env,
+		Interpreter:     app.Interpreter,
+		InterpreterArgs: app.InterpreterArgs,
+		Dir:             app.Dir,
+		User:            app.User,
+		Group:           app.Group,
+		Umask:           app.Umask,
+		MaxMemory:       app.MaxMemory,
+		Listeners:       app.Listeners,
+		StopSignal:      app.StopSignal,
+		StopTimeout:     time.Duration(app.StopTimeout),
+		PostStart:       app.PostStart,
+		PreStop:         app.PreStop,
+
+		DependsOn:               app.DependsOn,
+		DependencyCondition:     app.DependencyCondition,
+		RestartWithDependencies: app.RestartWithDependencies,
+	}
+	if r := app.Restart; r != nil {
+		command.RestartPolicy = RestartPolicy{
+			Mode:           r.Mode,
+			SuccessCodes:   r.SuccessCodes,
+			InitialBackoff: time.Duration(r.InitialBackoff),
+			MaxBackoff:     time.Duration(r.MaxBackoff),
+			MaxRestarts:    r.MaxRestarts,
+			Window:         time.Duration(r.Window),
+		}
+	}
+	if h := app.Health; h != nil {
+		command.HealthCheck = &HealthCheck{
+			Type:             h.Type,
+			URL:              h.URL,
+			ExpectedStatus:   h.ExpectedStatus,
+			Address:          h.Address,
+			Command:          h.Command,
+			InitialDelay:     time.Duration(h.InitialDelay),
+			Interval:         time.Duration(h.Interval),
+			Timeout:          time.Duration(h.Timeout),
+			FailureThreshold: h.FailureThreshold,
+			RestartOnFailure: h.RestartOnFailure,
+			ReadyTimeout:     time.Duration(h.ReadyTimeout),
+		}
+	}
+	if l := app.Logs; l != nil {
+		command.LogRotation = LogRotation{
+			MaxSize:    l.MaxSize,
+			Interval:   time.Duration(l.Interval),
+			MaxBackups: l.MaxBackups,
+			MaxAge:     time.Duration(l.MaxAge),
+			Compress:   l.Compress,
+		}
+	}
+	if r := app.Readiness; r != nil {
+		command.Readiness = Readiness{
+			File:    r.File,
+			Notify:  r.Notify,
+			Timeout: time.Duration(r.Timeout),
+		}
+	}
+	return &Cluster{
+		Name:      app.Name,
+		Template:  command,
+		Instances: app.instances(),
+		Base:      app.Base,
+	}
+}
+
+// specHash returns a fingerprint of command, used to detect the processes running an outdated spec.
+func specHash(command *Command) string {
+	b, _ := json.Marshal(command)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// desiredProc is a process described by a manifest.
+type desiredProc struct {
+	app      *AppSpec
+	index    int
+	command  *Command
+	hash     string
+	disabled bool
+}
+
+// desiredProcs returns the processes described by manifest, ordered by dependencies.
+func (manifest *Manifest) desiredProcs() ([]desiredProc, error) {
+	apps, err := manifest.sortedApps()
+	if err != nil {
+		return nil, err
+	}
+	var procs []desiredProc
+	for _, app := range apps {
+		cluster := app.cluster()
+		for i := 0; i < cluster.Instances; i++ {
+			command, err := cluster.command(i)
+			if err != nil {
+				return nil, err
+			}
+			procs = append(procs, desiredProc{
+				app:      app,
+				index:    i,
+				command:  command,
+				hash:     specHash(command),
+				disabled: app.Disabled,
+			})
+		}
+	}
+	return procs, nil
+}
+
+// Diff will compute the actions needed to converge to manifest, without applying them.
+// Deletions come first, then the other actions ordered by dependencies.
+// Returns an error in case the manifest is invalid.
+func (master *Master) Diff(manifest *Manifest) ([]ManifestAction, error) {
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+	desired, err := manifest.desiredProcs()
+	if err != nil {
+		return nil, err
+	}
+
+	master.Lock()
+	defer master.Unlock()
+
+	wanted := make(map[string]bool, len(desired))
+	apps := make(map[string]bool, len(manifest.Apps))
+	for _, d := range desired {
+		wanted[d.command.Name] = true
+		apps[d.app.Name] = true
+	}
+
+	var deletes []ManifestAction
+	for name, proc := range master.Procs {
+		if wanted[name] {
+			continue
+		}
+		if app := procApp(proc); apps[app] {
+			deletes = append(deletes, ManifestAction{ActionDelete, name, fmt.Sprintf("app %s was scaled down", app)})
+		} else if manifest.Prune {
+			deletes = append(deletes, ManifestAction{ActionDelete, name, "not in the manifest"})
+		}
+	}
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Name < deletes[j].Name })
+
+	actions := deletes
+	for _, d := range desired {
+		name := d.command.Name
+		proc, ok := master.Procs[name]
+		switch {
+		case !ok && !d.disabled:
+			actions = append(actions, ManifestAction{ActionStart, name, "not started yet"})
+		case !ok:
+		case d.disabled && proc.IsAlive():
+			actions = append(actions, ManifestAction{ActionStop, name, "disabled"})
+		case d.disabled:
+		case procSpecHash(proc) != d.hash:
+			actions = append(actions, ManifestAction{ActionRestart, name, "spec changed"})
+		case !proc.IsAlive():
+			actions = append(actions, ManifestAction{ActionStart, name, "not running"})
+		}
+	}
+	return actions, nil
+}
+
+// Apply will start, stop, restart and delete processes to converge to manifest.
+// Returns the actions that were applied and an error in case there's any, in which
+// case the remaining actions are not applied.
+func (master *Master) Apply(manifest *Manifest) ([]ManifestAction, error) {
+	actions, err := master.Diff(manifest)
+	if err != nil {
+		return nil, err
+	}
+	desired, err := manifest.desiredProcs()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]desiredProc, len(desired))
+	for _, d := range desired {
+		byName[d.command.Name] = d
+	}
+	master.applyClusters(manifest)
+
+	for i, action := range actions {
+		log.Printf("Applying manifest: %s", action)
+		d := byName[action.Name]
+		unlock := master.lockCluster(master.actionApp(action, d))
+		err := master.applyAction(action, d)
+		unlock()
+		if err != nil {
+			return actions[:i], fmt.Errorf("%s %s: %w", action.Action, action.Name, err)
+		}
+	}
+	return actions, nil
+}
+
+// actionApp returns the app whose instance is changed by action, empty if there's none.
+func (master *Master) actionApp(action ManifestAction, d desiredProc) string {
+	if d.app != nil {
+		return d.app.Name
+	}
+	master.Lock()
+	defer master.Unlock()
+	if proc, ok := master.Procs[action.Name]; ok {
+		return procApp(proc)
+	}
+	return ""
+}
+
+// applyClusters will register the apps of manifest as clusters, so they can be scaled and
+// restarted like the clusters started by StartCluster.
+func (master *Master) applyClusters(manifest *Manifest) {
+	master.Lock()
+	defer master.Unlock()
+	apps := make(map[string]bool, len(manifest.Apps))
+	for i := range manifest.Apps {
+		app := &manifest.Apps[i]
+		apps[app.Name] = true
+		master.Clusters[app.Name] = app.cluster()
+	}
+	if manifest.Prune {
+		for name := range master.Clusters {
+			if !apps[name] {
+				delete(master.Clusters, name)
+			}
+		}
+	}
+}
+
+func (master *Master) applyAction(action ManifestAction, d desiredProc) error {
+	switch action.Action {
+	case ActionDelete:
+		return master.DeleteProcess(action.Name)
+	case ActionStop:
+		return master.StopProcess(action.Name)
+	case ActionStart:
+		master.Lock()
+		_, ok := master.Procs[action.Name]
+		master.Unlock()
+		if ok {
+			return master.StartProcess(action.Name)
+		}
+		fallthrough
+	case ActionRestart:
+		preparable, output, err := master.PrepareCommand(d.command)
+		if err != nil {
+			return fmt.Errorf("%s %s", err, string(output))
+		}
+		preparable.App = d.app.Name
+		preparable.Instance = d.index
+		preparable.SpecHash = d.hash
+		return master.replaceProcess(preparable)
+	}
+	return errors.New("unknown action")
+}
+
+// replaceProcess will stop the process with the same name as procPreparable, if any, and run
+// procPreparable in its place. The files of the old process are kept, its sockets are closed
+// so the new process can listen on the same addresses.
+// Returns an error in case there's any.
+func (master *Master) replaceProcess(procPreparable *Preparable) error {
+	name := procPreparable.Identifier()
+	master.Lock()
+	if proc, ok := master.Procs[name]; ok {
+		if err := master.stop(proc); err != nil {
+			master.Unlock()
+			return err
+		}
+		if p, ok := proc.(*Proc); ok {
+			p.closeListeners()
+		}
+		if master.Procs[name] == proc {
+			delete(master.Procs, name)
+		}
+	}
+	master.Unlock()
+	return master.RunPreparable(procPreparable)
+}
+
+// procApp returns the app a process belongs to, empty for processes not started from a manifest.
+func procApp(proc ProcContainer) string {
+	if p, ok := proc.(*Proc); ok {
+		return p.App
+	}
+	return ""
+}
+
+// procSpecHash returns the fingerprint of the spec a process was started from.
+func procSpecHash(proc ProcContainer) string {
+	if p, ok := proc.(*Proc); ok {
+		return p.SpecHash
+	}
+	return ""
+}
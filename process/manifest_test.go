@@ -0,0 +1,220 @@
+package process
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const tomlManifest = `
+prune = true
+
+[[apps]]
+name = "web"
+language = "shell"
+source = "sleep 30"
+instances = 2
+base = 8000
+env = ["PORT={{base+index}}"]
+depends_on = ["db"]
+
+[apps.restart]
+mode = "on-failure"
+initial_backoff = "500ms"
+
+[apps.health]
+type = "tcp"
+address = "127.0.0.1:8080"
+interval = "5s"
+
+[[apps]]
+name = "db"
+language = "shell"
+source = "sleep 30"
+`
+
+const yamlManifest = `
+apps:
+  - name: worker
+    language: shell
+    source: sleep 30
+    env: ["QUEUE=default"]
+    logs:
+      max_size: 1024
+      max_age: 24h
+`
+
+func TestParseManifest(t *testing.T) {
+	manifest, err := ParseManifest([]byte(tomlManifest), "toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !manifest.Prune || len(manifest.Apps) != 2 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+	web, err := manifest.Apps[0].cluster().command(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if web.Name != "web-1" || web.Env[0] != "PORT=8001" || web.RestartPolicy.InitialBackoff != 500*time.Millisecond || web.HealthCheck.Interval != 5*time.Second {
+		t.Fatalf("unexpected command %+v", web)
+	}
+
+	manifest, err = ParseManifest([]byte(yamlManifest), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker, err := manifest.Apps[0].cluster().command(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if worker.Env[0] != "QUEUE=default" || worker.LogRotation.MaxAge != 24*time.Hour || worker.LogRotation.MaxSize != 1024 {
+		t.Fatalf("unexpected command %+v", worker)
+	}
+
+	if _, err := ParseManifest([]byte(yamlManifest), "json"); err == nil {
+		t.Fatal("expected an unknown format error")
+	}
+}
+
+func TestManifestValidate(t *testing.T) {
+	cases := map[string]Manifest{
+		"no name":   {Apps: []AppSpec{{}}},
+		"twice":     {Apps: []AppSpec{{Name: "a"}, {Name: "a"}}},
+		"unknown":   {Apps: []AppSpec{{Name: "a", DependsOn: []string{"b"}}}},
+		"cycle":     {Apps: []AppSpec{{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"a"}}}},
+		"collision": {Apps: []AppSpec{{Name: "a", Instances: 2}, {Name: "a-1"}}},
+		"umask":     {Apps: []AppSpec{{Name: "a", Umask: "9"}}},
+		"template":  {Apps: []AppSpec{{Name: "a", Env: []string{"PORT={{port}}"}}}},
+		"health":    {Apps: []AppSpec{{Name: "a", Health: &HealthSpec{Type: "udp"}}}},
+		"instances": {Apps: []AppSpec{{Name: "a", Instances: -1}}},
+		"condition": {Apps: []AppSpec{{Name: "a", DependencyCondition: "ready"}}},
+	}
+	for name, manifest := range cases {
+		if err := manifest.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSortByDependencies(t *testing.T) {
+	sorted, err := sortByDependencies([]string{"web", "cache", "db", "jobs"}, map[string][]string{
+		"web":  {"db", "cache"},
+		"jobs": {"db"},
+		"db":   {"external"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(sorted, ","); got != "db,cache,web,jobs" {
+		t.Fatalf("sorted = %s", got)
+	}
+
+	_, err = sortByDependencies([]string{"a", "b", "c"}, map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"b"}})
+	if err == nil || !strings.Contains(err.Error(), "b -> c -> b") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func actionList(actions []ManifestAction) string {
+	var parts []string
+	for _, a := range actions {
+		parts = append(parts, a.Action+" "+a.Name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func TestMasterApplyManifest(t *testing.T) {
+	master := newTestMaster(t)
+	manifest := &Manifest{Apps: []AppSpec{
+		{Name: "web", Language: LanguageShell, Source: "sleep 30", Instances: 2, DependsOn: []string{"db"}},
+		{Name: "db", Language: LanguageShell, Source: "sleep 30"},
+	}}
+
+	actions, err := master.Apply(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actionList(actions); got != "start db, start web, start web-1" {
+		t.Fatalf("applied %s", got)
+	}
+	if actions, err := master.Diff(manifest); err != nil || len(actions) != 0 {
+		t.Fatalf("expected no changes, got %s %v", actionList(actions), err)
+	}
+
+	// A process started outside of the manifest is only deleted when pruning.
+	err = master.RunPreparable(&Preparable{Name: "manual", Cmd: "/bin/sh", Args: []string{"-c", "sleep 30"}, SysFolder: master.SysFolder})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest.Apps[0].Instances = 1
+	manifest.Apps[1].Source = "sleep 20"
+	actions, err = master.Diff(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actionList(actions); got != "delete web-1, restart db" {
+		t.Fatalf("diff %s", got)
+	}
+	if _, err := master.Apply(manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest.Apps[0].Disabled = true
+	manifest.Prune = true
+	actions, err = master.Apply(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actionList(actions); got != "delete manual, stop web" {
+		t.Fatalf("applied %s", got)
+	}
+
+	master.Lock()
+	defer master.Unlock()
+	if len(master.Procs) != 2 || master.Procs["web"].IsAlive() || !master.Procs["db"].IsAlive() {
+		t.Fatalf("unexpected procs %v", master.Procs)
+	}
+	if p := master.Procs["db"].(*Proc); p.App != "db" || p.Args[1] != "sleep 20" {
+		t.Fatalf("unexpected db proc %+v", p)
+	}
+}
+
+func TestMasterApplyReplacesListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := "tcp://" + l.Addr().String()
+	l.Close()
+
+	master := newTestMaster(t)
+	manifest := &Manifest{Apps: []AppSpec{
+		{Name: "web", Language: LanguageShell, Source: "sleep 30", Listeners: []string{listener}},
+	}}
+	if _, err := master.Apply(manifest); err != nil {
+		t.Fatal(err)
+	}
+	master.Lock()
+	old := master.Procs["web"].(*Proc)
+	master.Unlock()
+
+	manifest.Apps[0].Env = []string{"VERSION=2"}
+	actions, err := master.Apply(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actionList(actions); got != "restart web" {
+		t.Fatalf("applied %s", got)
+	}
+	master.Lock()
+	defer master.Unlock()
+	if old.sockets != nil {
+		t.Fatal("expected the sockets of the replaced process to be closed")
+	}
+	if next := master.Procs["web"].(*Proc); next == old || len(next.sockets) != 1 {
+		t.Fatalf("expected the new process to listen, got %+v", next)
+	}
+}
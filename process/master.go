@@ -4,14 +4,14 @@ package process
 Master is the main package that keeps everything running as it should be.
 It's responsible for starting, stopping and deleting processes.
 It also will keep an eye on the Watcher in case a process dies so it can restart it again.
-RemoteMaster is responsible for exporting the main APM operations as HTTP requests.
+RemoteMaster is responsible for exporting the main APM operations as an authenticated HTTP/JSON API.
 
 If you want to start a Remote Server, run:
-- remoteServer, err := master.StartRemoteMasterServer(dsn, configFile)
+- remoteServer, err := master.StartRemoteMasterServer(apiConfig, configFile)
 
 It will start a remote master and return the instance.
 To make remote requests, use the Remote Client by instantiating using:
-- remoteClient, err := master.StartRemoteClient(dsn, timeout)
+- remoteClient, err := master.StartRemoteClient(dsn, timeout, master.WithToken(token))
 
 It will start the remote client and return the instance so you can use to initiate requests, such as:
 - remoteClient.StartGoBin(sourcePath, name, keepAlive, args)
@@ -31,6 +31,9 @@ import (
 	"github.com/spcent/x/lock"
 )
 
+// ErrUnknownProcess is returned when a process name is not managed by the master.
+var ErrUnknownProcess = errors.New("unknown process")
+
 // Master is the main module that keeps everything in place and execute
 // the necessary actions to keep the process running as they should be.
 type Master struct {
@@ -42,7 +45,13 @@ type Master struct {
 	ErrFile   string   // ErrFile is the APM err log file path.
 	Watcher   *Watcher // Watcher is a watcher instance.
 
-	Procs map[string]ProcContainer // Procs is a map containing all procs started on APM.
+	Procs    map[string]ProcContainer // Procs is a map containing all procs started on APM.
+	Clusters map[string]*Cluster      // Clusters is a map containing the clusters whose instances are in Procs.
+
+	health     map[string]*healthMonitor       // running health checks by proc name
+	cpu        map[string]cpuSample            // previous cpu sample by proc name
+	stopping   map[ProcContainer]chan struct{} // procs being stopped, closed once they are
+	clusterOps map[string]*sync.Mutex          // serializes the operations on the instances of each cluster
 }
 
 // DecodableMaster is a struct that the config toml file will decode to.
@@ -56,7 +65,8 @@ type DecodableMaster struct {
 
 	Watcher *Watcher
 
-	Procs map[string]*Proc
+	Procs    map[string]*Proc
+	Clusters map[string]*Cluster
 }
 
 // SafeReadTomlFile will try to acquire a lock on the file and then read its content afterwards.
@@ -77,7 +87,7 @@ func SafeReadTomlFile(filename string, v any) error {
 	defer f.Close()
 
 	decoder := toml.NewDecoder(f)
-	return decoder.Decode(&v)
+	return decoder.Decode(v)
 }
 
 // SafeWriteTomlFile will try to acquire a lock on the file and then write to it.
@@ -125,48 +135,127 @@ func NewMaster(configFile string) *Master {
 		ErrFile:   decodableMaster.ErrFile,
 		Watcher:   decodableMaster.Watcher,
 		Procs:     procs,
+		Clusters:  decodableMaster.Clusters,
+		health:    make(map[string]*healthMonitor),
+		cpu:       make(map[string]cpuSample),
+		stopping:  make(map[ProcContainer]chan struct{}),
 	}
 
+	if master.Clusters == nil {
+		master.Clusters = make(map[string]*Cluster)
+	}
 	if master.SysFolder == "" {
 		os.MkdirAll(path.Dir(configFile), 0777)
 		master.SysFolder = path.Dir(configFile) + "/"
 	}
 	master.Watcher = watcher
+	// Watch first, so the procs dying while their dependents are revived get restarted.
+	go master.WatchProcs()
 	master.Revive()
 	log.Printf("All procs revived...")
-	go master.WatchProcs()
 	go master.SaveProcsLoop()
 	go master.UpdateStatus()
+	go master.SampleMetrics()
 	return master
 }
 
-// WatchProcs will keep the procs running forever.
+// WatchProcs will keep the procs running forever, applying each proc restart policy.
 func (master *Master) WatchProcs() {
 	for proc := range master.Watcher.RestartProc() {
-		if !proc.ShouldKeepAlive() {
-			master.Lock()
-			master.updateStatus(proc)
-			master.Unlock()
-			log.Printf("Proc %s does not have keep alive set. Will not be restarted.", proc.Identifier())
-			continue
-		}
-		log.Printf("Restarting proc %s.", proc.Identifier())
-		if proc.IsAlive() {
-			log.Printf("Proc %s was supposed to be dead, but it is alive.", proc.Identifier())
-		}
 		master.Lock()
-		proc.AddRestart()
-		err := master.restart(proc)
+		master.handleExit(proc)
 		master.Unlock()
-		if err != nil {
-			log.Printf("Could not restart process %s due to %s.", proc.Identifier(), err)
+	}
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// handleExit decides what to do with a proc that just died: leave it exited, restart it
+// right away, restart it after a backoff delay or mark it as errored if it is crash looping.
+func (master *Master) handleExit(proc ProcContainer) {
+	status := proc.GetStatus()
+	status.SetExit(proc.GetExitState())
+	master.stopHealth(proc.Identifier())
+	policy := proc.GetRestartPolicy()
+	proc.NotifyStopped()
+
+	if !policy.shouldRestart(proc.ShouldKeepAlive(), status.ExitCode) {
+		proc.SetStatus("exited")
+		log.Printf("Proc %s exited with code %d. Will not be restarted.", proc.Identifier(), status.ExitCode)
+		return
+	}
+	master.restartWithPolicy(proc, fmt.Sprintf("exit code %d", status.ExitCode))
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// restartWithPolicy will restart a proc that is no longer running, right away or after a backoff
+// delay, or mark it as errored if it restarted too many times within its restart policy window.
+// cause tells why the proc is restarted, ie: exit code 3.
+func (master *Master) restartWithPolicy(proc ProcContainer, cause string) {
+	status := proc.GetStatus()
+	policy := proc.GetRestartPolicy()
+	now := time.Now()
+	recent := status.pruneRestarts(now, policy.window())
+	if limit := policy.maxRestarts(); limit > 0 && recent >= limit {
+		status.Reason = fmt.Sprintf("restarted %d times within %s, last %s", recent, policy.window(), cause)
+		proc.SetStatus("errored")
+		log.Printf("Proc %s is crash looping: %s. Will not be restarted.", proc.Identifier(), status.Reason)
+		return
+	}
+	status.RecentRestarts = append(status.RecentRestarts, now)
+
+	delay := policy.backoff(recent)
+	if delay <= 0 {
+		master.restartAfterExit(proc)
+		return
+	}
+
+	log.Printf("Proc %s stopped with %s. Restarting in %s.", proc.Identifier(), cause, delay)
+	status.NextRestartAt = now.Add(delay)
+	proc.SetStatus("backoff")
+	time.AfterFunc(delay, func() {
+		master.Lock()
+		defer master.Unlock()
+		// The proc may have been stopped, started or deleted during the backoff.
+		if current, ok := master.Procs[proc.Identifier()]; !ok || current != proc || status.Status != "backoff" {
+			return
 		}
+		master.restartAfterExit(proc)
+	})
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// stopAndRestart will stop a running proc and restart it through restartWithPolicy,
+// so it waits for its backoff delay and counts towards the crash loop limit like a proc that died.
+func (master *Master) stopAndRestart(proc ProcContainer, cause string) {
+	log.Printf("Stopping proc %s due to %s.", proc.Identifier(), cause)
+	if err := master.stop(proc); err != nil {
+		log.Printf("Could not stop process %s due to %s.", proc.Identifier(), err)
+		return
+	}
+	if master.Procs[proc.Identifier()] != proc {
+		// Deleted or replaced while it was stopping.
+		return
+	}
+	master.restartWithPolicy(proc, cause)
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+func (master *Master) restartAfterExit(proc ProcContainer) {
+	log.Printf("Restarting proc %s.", proc.Identifier())
+	status := proc.GetStatus()
+	status.NextRestartAt = time.Time{}
+	proc.SetStatus("restarting")
+	proc.AddRestart()
+	if err := master.restart(proc); err != nil {
+		status.Reason = fmt.Sprintf("restart failed: %s", err)
+		proc.SetStatus("errored")
+		log.Printf("Could not restart process %s due to %s.", proc.Identifier(), err)
 	}
 }
 
 // Prepare will compile the source code into a binary and return a preparable
 // ready to be executed.
-func (master *Master) Prepare(sourcePath string, name string, language string, keepAlive bool, args []string) (ProcPreparable, []byte, error) {
+func (master *Master) Prepare(sourcePath string, name string, language string, keepAlive bool, args []string) (*Preparable, []byte, error) {
 	procPreparable := &Preparable{
 		Name:       name,
 		SourcePath: sourcePath,
@@ -179,8 +268,82 @@ func (master *Master) Prepare(sourcePath string, name string, language string, k
 	return procPreparable, output, err
 }
 
-// RunPreparable will run procPreparable and add it to the watch list in case everything goes well.
+// PrepareCommand will build a preparable from command, compiling it first for go,
+// and return it ready to be executed.
+func (master *Master) PrepareCommand(command *Command) (*Preparable, []byte, error) {
+	procPreparable := &Preparable{
+		Name:       command.Name,
+		SourcePath: command.Source,
+		SysFolder:  master.SysFolder,
+		Language:   command.Language,
+		KeepAlive:  command.KeepAlive,
+		Args:       command.Args,
+		Env:        command.Env,
+
+		Interpreter:     command.Interpreter,
+		InterpreterArgs: command.InterpreterArgs,
+		Dir:             command.Dir,
+		User:            command.User,
+		Group:           command.Group,
+		Umask:           command.Umask,
+
+		RestartPolicy: command.RestartPolicy,
+		HealthCheck:   command.HealthCheck,
+		LogRotation:   command.LogRotation,
+		MaxMemory:     command.MaxMemory,
+		Readiness:     command.Readiness,
+		Listeners:     command.Listeners,
+
+		StopSignal:  command.StopSignal,
+		StopTimeout: command.StopTimeout,
+		PostStart:   command.PostStart,
+		PreStop:     command.PreStop,
+
+		DependsOn:               command.DependsOn,
+		DependencyCondition:     command.DependencyCondition,
+		RestartWithDependencies: command.RestartWithDependencies,
+	}
+	if _, err := parseUmask(command.Umask); err != nil {
+		return nil, nil, err
+	}
+	if _, err := parseSignal(command.StopSignal); err != nil {
+		return nil, nil, err
+	}
+	for _, listener := range command.Listeners {
+		if _, _, err := parseListener(listener); err != nil {
+			return nil, nil, err
+		}
+	}
+	if command.HealthCheck != nil {
+		if err := command.HealthCheck.Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	output, err := procPreparable.PrepareBin()
+	return procPreparable, output, err
+}
+
+// RunPreparable will run procPreparable, once its dependencies are met, and add it to the watch
+// list in case everything goes well.
 func (master *Master) RunPreparable(procPreparable ProcPreparable) error {
+	if preparable, ok := procPreparable.(*Preparable); ok {
+		master.Lock()
+		err := master.checkDependencies(preparable.Identifier(), preparable.DependsOn, preparable.DependencyCondition)
+		master.Unlock()
+		if err != nil {
+			return err
+		}
+		if err := master.waitDependencies(preparable.Identifier(), preparable.DependsOn, preparable.DependencyCondition); err != nil {
+			return err
+		}
+	}
+	if err := master.runPreparable(procPreparable); err != nil {
+		return err
+	}
+	return master.waitReady(procPreparable.Identifier())
+}
+
+func (master *Master) runPreparable(procPreparable ProcPreparable) error {
 	master.Lock()
 	defer master.Unlock()
 
@@ -188,6 +351,11 @@ func (master *Master) RunPreparable(procPreparable ProcPreparable) error {
 		log.Printf("Proc %s already exist.", procPreparable.Identifier())
 		return errors.New("trying to start a process that already exist")
 	}
+	if preparable, ok := procPreparable.(*Preparable); ok {
+		if cluster := master.reservedBy(preparable.Name); cluster != "" && cluster != preparable.App {
+			return fmt.Errorf("process name %s is reserved for the instances of cluster %s", preparable.Name, cluster)
+		}
+	}
 
 	proc, err := procPreparable.Start()
 	if err != nil {
@@ -197,6 +365,7 @@ func (master *Master) RunPreparable(procPreparable ProcPreparable) error {
 	master.Procs[proc.Identifier()] = proc
 	master.saveProcsWrapper()
 	master.Watcher.AddProcWatcher(proc)
+	master.startHealth(proc)
 	proc.SetStatus("running")
 	return nil
 }
@@ -210,23 +379,112 @@ func (master *Master) ListProcs() []ProcContainer {
 	return procsList
 }
 
-// RestartProcess will restart a process.
+// RestartProcess will restart a process, then the dependents that opted in.
 func (master *Master) RestartProcess(name string) error {
 	err := master.StopProcess(name)
 	if err != nil {
 		return err
 	}
-	return master.StartProcess(name)
+	if err := master.StartProcess(name); err != nil {
+		return err
+	}
+	master.Lock()
+	defer master.Unlock()
+	master.propagateRestart(name)
+	return nil
 }
 
-// StartProcess will a start a process.
+// StartProcess will a start a process once its dependencies are met and wait for it to be ready.
 func (master *Master) StartProcess(name string) error {
+	if err := master.waitProcDependencies(name); err != nil {
+		return err
+	}
+	if err := master.startProcess(name); err != nil {
+		return err
+	}
+	return master.waitReady(name)
+}
+
+func (master *Master) startProcess(name string) error {
 	master.Lock()
 	defer master.Unlock()
 	if proc, ok := master.Procs[name]; ok {
+		// A manual start gives a crash looping proc a fresh restart budget.
+		proc.GetStatus().ResetRestarts()
 		return master.start(proc)
 	}
-	return errors.New("unknown process")
+	return ErrUnknownProcess
+}
+
+// SetRestartPolicy will change the restart policy of a process. It takes effect the next time the process dies.
+func (master *Master) SetRestartPolicy(name string, policy RestartPolicy) error {
+	master.Lock()
+	defer master.Unlock()
+
+	proc, ok := master.Procs[name].(*Proc)
+	if !ok {
+		return ErrUnknownProcess
+	}
+	switch policy.Mode {
+	case "", RestartAlways, RestartOnFailure, RestartNever:
+	default:
+		return fmt.Errorf("unknown restart mode %q", policy.Mode)
+	}
+	proc.RestartPolicy = policy
+	return master.saveProcsWrapper()
+}
+
+// Logs will return the last lines written by process name, merging stdout and stderr by time,
+// along with the sequence to pass to FollowLogs to get the lines written afterwards.
+// Returns an error in case there's any.
+func (master *Master) Logs(name string, lines int) ([]LogLine, uint64, error) {
+	master.Lock()
+	proc, ok := master.Procs[name].(*Proc)
+	var buffer *logBuffer
+	if ok {
+		buffer = proc.logBuffer()
+	}
+	master.Unlock()
+	if !ok {
+		return nil, 0, ErrUnknownProcess
+	}
+
+	// Take the sequence first so no line is lost between the files and the buffer.
+	last := buffer.last()
+	out, err := tailLogFile(proc.Outfile, StreamStdout, lines)
+	if err != nil {
+		return nil, 0, err
+	}
+	errs, err := tailLogFile(proc.Errfile, StreamStderr, lines)
+	if err != nil {
+		return nil, 0, err
+	}
+	return mergeLogLines(lines, out, errs), last, nil
+}
+
+// FollowLogs will return the lines written by process name after sequence after, waiting up to
+// wait for new lines if there's none yet. The returned sequence is the one to pass on the next call.
+// Returns an error in case there's any.
+func (master *Master) FollowLogs(name string, after uint64, wait time.Duration) ([]LogLine, uint64, error) {
+	master.Lock()
+	proc, ok := master.Procs[name].(*Proc)
+	var buffer *logBuffer
+	if ok {
+		buffer = proc.logBuffer()
+	}
+	master.Unlock()
+	if !ok {
+		return nil, 0, ErrUnknownProcess
+	}
+
+	if wait <= 0 || wait > logMaxFollowWait {
+		wait = logMaxFollowWait
+	}
+	lines := buffer.since(after, wait)
+	if len(lines) > 0 {
+		after = lines[len(lines)-1].Seq
+	}
+	return lines, after, nil
 }
 
 // StopProcess will stop a process with the given name.
@@ -237,7 +495,7 @@ func (master *Master) StopProcess(name string) error {
 		return master.stop(proc)
 	}
 
-	return errors.New("unknown process")
+	return ErrUnknownProcess
 }
 
 // DeleteProcess will delete a process and all its files and childs forever.
@@ -251,6 +509,10 @@ func (master *Master) DeleteProcess(name string) error {
 		if err != nil {
 			return err
 		}
+		if master.Procs[name] != proc {
+			// Deleted or replaced while it was stopping.
+			return nil
+		}
 		delete(master.Procs, name)
 		err = master.delete(proc)
 		if err != nil {
@@ -261,32 +523,70 @@ func (master *Master) DeleteProcess(name string) error {
 	return nil
 }
 
-// Revive will revive all procs listed on ListProcs. This should ONLY be called
-// during Master startup.
+// Revive will revive all procs listed on ListProcs, every proc after its dependencies.
+// A proc that can't be revived is logged and skipped, so it does not keep the others down.
+// This should ONLY be called during Master startup.
+// Returns an error in case the dependencies have a cycle, in which case no proc is revived.
 func (master *Master) Revive() error {
 	master.Lock()
-	defer master.Unlock()
-
-	procs := master.ListProcs()
-	log.Printf("Reviving all processes")
-	for id := range procs {
-		proc := procs[id]
+	names := []string{}
+	for name, proc := range master.Procs {
 		if !proc.ShouldKeepAlive() {
-			log.Printf("Proc %s does not have KeepAlive set. Will not revive it.", proc.Identifier())
+			log.Printf("Proc %s does not have KeepAlive set. Will not revive it.", name)
 			continue
 		}
-		log.Printf("Reviving proc %s", proc.Identifier())
-		err := master.start(proc)
-		if err != nil {
-			return fmt.Errorf("failed to revive proc %s due to %s", proc.Identifier(), err)
-		}
+		names = append(names, name)
+	}
+	order, err := master.dependencyOrder(names, nil)
+	master.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to revive procs due to %s", err)
 	}
 
+	log.Printf("Reviving all processes")
+	var wg sync.WaitGroup
+	for _, name := range order {
+		wg.Add(1)
+		// Every proc waits for its own dependencies, so a slow one only holds back its dependents.
+		go func() {
+			defer wg.Done()
+			master.revive(name)
+		}()
+	}
+	wg.Wait()
 	return nil
 }
 
+// revive will start proc name once its dependencies are met, logging why in case it can't.
+func (master *Master) revive(name string) {
+	// Dependencies are waited for without the lock, so their health checks can run.
+	err := master.waitProcDependencies(name)
+	if err == ErrUnknownProcess {
+		// The proc was deleted in the meantime.
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revive proc %s due to %s", name, err)
+		return
+	}
+
+	master.Lock()
+	defer master.Unlock()
+	proc, ok := master.Procs[name]
+	if !ok {
+		return
+	}
+	log.Printf("Reviving proc %s", name)
+	if err := master.start(proc); err != nil {
+		log.Printf("Failed to revive proc %s due to %s", name, err)
+	}
+}
+
 // NOT thread safe method. Lock should be acquire before calling it.
 func (master *Master) start(proc ProcContainer) error {
+	if _, ok := master.stopping[proc]; ok {
+		return fmt.Errorf("proc %s is stopping", proc.Identifier())
+	}
 	if !proc.IsAlive() {
 		err := proc.Start()
 		if err != nil {
@@ -294,6 +594,7 @@ func (master *Master) start(proc ProcContainer) error {
 		}
 
 		master.Watcher.AddProcWatcher(proc)
+		master.startHealth(proc)
 		proc.SetStatus("running")
 	}
 	return nil
@@ -304,20 +605,61 @@ func (master *Master) delete(proc ProcContainer) error {
 }
 
 // NOT thread safe method. Lock should be acquire before calling it.
+// The lock is released while the pre-stop hook runs and while waiting for the process to exit,
+// so a process slow to stop does not block the master. Starting the proc meanwhile fails and
+// stopping it again waits for the stop in progress.
 func (master *Master) stop(proc ProcContainer) error {
+	if stopping, ok := master.stopping[proc]; ok {
+		master.Unlock()
+		<-stopping
+		master.Lock()
+		return nil
+	}
+	master.stopHealth(proc.Identifier())
 	if proc.IsAlive() {
+		if master.stopping == nil {
+			master.stopping = make(map[ProcContainer]chan struct{})
+		}
+		stopping := make(chan struct{})
+		master.stopping[proc] = stopping
+		defer func() {
+			delete(master.stopping, proc)
+			close(stopping)
+		}()
+
+		// Stop watching first, so a process exiting during its hook is not restarted.
 		waitStop := master.Watcher.StopWatcher(proc.Identifier())
+		if hook, cancel := preStopHook(proc); hook != nil {
+			master.Unlock()
+			// A failing hook does not prevent the stop.
+			runHookCommand(proc.Identifier(), "pre-stop", hook)
+			cancel()
+			master.Lock()
+		}
 		err := proc.GracefullyStop()
 		if err != nil {
 			return err
 		}
 		if waitStop != nil {
-			<-waitStop
+			timeout := procStopTimeout(proc)
+			if !master.waitUnlocked(waitStop, timeout) {
+				log.Printf("Proc %s did not stop within %s, killing it.", proc.Identifier(), timeout)
+				proc.ForceStop()
+				if !master.waitUnlocked(waitStop, killTimeout) {
+					log.Printf("Proc %s was not reaped %s after being killed.", proc.Identifier(), killTimeout)
+				}
+				proc.GetStatus().Reason = fmt.Sprintf("killed after not stopping within %s", timeout)
+			}
 			proc.NotifyStopped()
 			proc.SetStatus("stopped")
 		}
 		log.Printf("Proc %s successfully stopped.", proc.Identifier())
 	}
+	// Cancel a pending restart of a proc waiting in backoff.
+	if proc.GetStatus().Status == "backoff" {
+		proc.GetStatus().NextRestartAt = time.Time{}
+		proc.SetStatus("stopped")
+	}
 
 	return nil
 }
@@ -341,7 +683,12 @@ func (master *Master) updateStatus(proc ProcContainer) {
 		proc.SetStatus("running")
 	} else {
 		proc.NotifyStopped()
-		proc.SetStatus("stopped")
+		switch proc.GetStatus().Status {
+		case "exited", "backoff", "errored", "restarting":
+			// Keep the state decided by the restart policy.
+		default:
+			proc.SetStatus("stopped")
+		}
 	}
 }
 
@@ -351,8 +698,16 @@ func (master *Master) restart(proc ProcContainer) error {
 	if err != nil {
 		return err
 	}
+	if master.Procs[proc.Identifier()] != proc {
+		// Deleted or replaced while it was stopping.
+		return ErrUnknownProcess
+	}
 
-	return master.start(proc)
+	if err := master.start(proc); err != nil {
+		return err
+	}
+	master.propagateRestart(proc.Identifier())
+	return nil
 }
 
 // SaveProcsLoop will loop forever to save the list of procs onto the proc file.
@@ -368,10 +723,25 @@ func (master *Master) SaveProcsLoop() {
 
 // Stop will stop APM and all of its running procs.
 func (master *Master) Stop() error {
+	master.Lock()
+	defer master.Unlock()
+
 	log.Printf("Stopping APM...")
-	procs := master.ListProcs()
-	for id := range procs {
-		proc := procs[id]
+	names := []string{}
+	for name := range master.Procs {
+		names = append(names, name)
+	}
+	order, err := master.dependencyOrder(names, nil)
+	if err != nil {
+		log.Printf("Stopping procs in any order due to %s", err)
+		order = names
+	}
+	// Stop every proc before its dependencies.
+	for i := len(order) - 1; i >= 0; i-- {
+		proc, ok := master.Procs[order[i]]
+		if !ok {
+			continue
+		}
 		log.Printf("Stopping proc %s", proc.Identifier())
 		master.stop(proc)
 	}
@@ -391,7 +761,32 @@ func (master *Master) SaveProcs() error {
 // NOT Thread Safe. Lock should be acquired before calling it.
 func (master *Master) saveProcsWrapper() error {
 	configPath := master.getConfigPath()
-	return SafeWriteTomlFile(master, configPath)
+	return SafeWriteTomlFile(master.snapshot(), configPath)
+}
+
+// NOT Thread Safe. Lock should be acquired before calling it.
+// snapshot returns a copy of what is saved in the config file, so the encoder never reads
+// the live master nor the procs its goroutines keep updating.
+func (master *Master) snapshot() *DecodableMaster {
+	procs := make(map[string]*Proc, len(master.Procs))
+	for name, proc := range master.Procs {
+		if p, ok := proc.(*Proc); ok {
+			procs[name] = p.persisted()
+		}
+	}
+	clusters := make(map[string]*Cluster, len(master.Clusters))
+	for name, cluster := range master.Clusters {
+		c := *cluster
+		clusters[name] = &c
+	}
+	return &DecodableMaster{
+		SysFolder: master.SysFolder,
+		PidFile:   master.PidFile,
+		OutFile:   master.OutFile,
+		ErrFile:   master.ErrFile,
+		Procs:     procs,
+		Clusters:  clusters,
+	}
 }
 
 func (master *Master) getConfigPath() string {
@@ -0,0 +1,260 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	procFS             = "/proc"
+	clockTicks         = 100 // USER_HZ, the unit of the cpu times in /proc/<pid>/stat
+	metricsInterval    = 5 * time.Second
+	metricsHistorySize = 60 // samples kept per process
+)
+
+// ProcMetrics is a resource usage sample of a process and all of its children.
+type ProcMetrics struct {
+	Time    time.Time     // when the sample was taken
+	CPU     float64       // cpu usage since the previous sample, in percent of one core
+	RSS     uint64        // resident memory in bytes
+	FDs     int           // open file descriptors
+	Threads int           // number of threads
+	Procs   int           // number of processes in the tree, including the process itself
+	Uptime  time.Duration // time since the process started
+}
+
+// procStat holds the fields of /proc/<pid>/stat used by the metrics.
+type procStat struct {
+	ppid      int
+	ticks     uint64 // user + system cpu time
+	threads   int
+	startTime uint64 // ticks after boot
+}
+
+// readProcStat will parse /proc/<pid>/stat.
+// Returns an error in case there's any.
+func readProcStat(pid int) (procStat, error) {
+	b, err := os.ReadFile(filepath.Join(procFS, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	// The command name is between parenthesis and may contain spaces.
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	fields := strings.Fields(string(b[i+1:]))
+	// fields[0] is the state, the third field of the file.
+	if len(fields) < 20 {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	field := func(n int) uint64 {
+		v, _ := strconv.ParseUint(fields[n-3], 10, 64)
+		return v
+	}
+	return procStat{
+		ppid:      int(field(4)),
+		ticks:     field(14) + field(15),
+		threads:   int(field(20)),
+		startTime: field(22),
+	}, nil
+}
+
+// readProcRSS will read the resident memory of pid from /proc/<pid>/status.
+// Returns an error in case there's any.
+func readProcRSS(pid int) (uint64, error) {
+	f, err := os.Open(filepath.Join(procFS, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "VmRSS:")
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		return kb * 1024, err
+	}
+	// Zombies and kernel threads have no memory.
+	return 0, scanner.Err()
+}
+
+// countProcFDs will count the open file descriptors of pid.
+func countProcFDs(pid int) int {
+	entries, err := os.ReadDir(filepath.Join(procFS, strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return 0
+	}
+	return len(entries)
+}
+
+// systemUptime will read the time since boot from /proc/uptime.
+// Returns an error in case there's any.
+func systemUptime() (time.Duration, error) {
+	b, err := os.ReadFile(filepath.Join(procFS, "uptime"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return 0, errors.New("malformed uptime")
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	return time.Duration(secs * float64(time.Second)), err
+}
+
+// procChildren will scan /proc and return the children of every process.
+// Returns an error in case there's any.
+func procChildren() (map[int][]int, error) {
+	entries, err := os.ReadDir(procFS)
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := readProcStat(pid)
+		if err != nil {
+			continue
+		}
+		children[stat.ppid] = append(children[stat.ppid], pid)
+	}
+	return children, nil
+}
+
+// procTree returns root followed by all of its descendants.
+func procTree(root int, children map[int][]int) []int {
+	tree := []int{root}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree
+}
+
+// cpuSample is the cpu time of a process tree at a given moment.
+type cpuSample struct {
+	pid   int
+	ticks uint64
+	at    time.Time
+}
+
+// collectMetrics will sample the process tree rooted at pid. The cpu usage is computed
+// against prev, the returned cpuSample is the one to pass on the next call.
+// Returns an error in case there's any.
+func collectMetrics(pid int, children map[int][]int, uptime time.Duration, prev cpuSample) (ProcMetrics, cpuSample, error) {
+	now := time.Now()
+	root, err := readProcStat(pid)
+	if err != nil {
+		return ProcMetrics{}, cpuSample{}, err
+	}
+
+	m := ProcMetrics{Time: now}
+	if uptime > 0 {
+		m.Uptime = max(uptime-time.Duration(root.startTime)*time.Second/clockTicks, 0)
+	}
+	var ticks uint64
+	for _, p := range procTree(pid, children) {
+		stat, err := readProcStat(p)
+		if err != nil {
+			// The process exited while sampling.
+			continue
+		}
+		rss, _ := readProcRSS(p)
+		ticks += stat.ticks
+		m.RSS += rss
+		m.Threads += stat.threads
+		m.FDs += countProcFDs(p)
+		m.Procs++
+	}
+
+	sample := cpuSample{pid: pid, ticks: ticks, at: now}
+	if prev.pid == pid && ticks > prev.ticks {
+		if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 {
+			m.CPU = float64(ticks-prev.ticks) / clockTicks / elapsed * 100
+		}
+	}
+	return m, sample, nil
+}
+
+// addMetrics will record m as the latest sample, keeping at most metricsHistorySize samples.
+func (p *ProcStatus) addMetrics(m ProcMetrics) {
+	p.Metrics = m
+	p.History = append(p.History, m)
+	if n := len(p.History); n > metricsHistorySize {
+		p.History = append(p.History[:0], p.History[n-metricsHistorySize:]...)
+	}
+}
+
+// SampleMetrics will sample the cpu and memory usage of every proc every metricsInterval.
+func (master *Master) SampleMetrics() {
+	for {
+		master.Lock()
+		master.sampleMetrics()
+		master.Unlock()
+		time.Sleep(metricsInterval)
+	}
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+func (master *Master) sampleMetrics() {
+	children, err := procChildren()
+	if err != nil {
+		// No /proc on this system.
+		return
+	}
+	uptime, _ := systemUptime()
+	if master.cpu == nil {
+		master.cpu = make(map[string]cpuSample)
+	}
+
+	for _, proc := range master.ListProcs() {
+		name := proc.Identifier()
+		status := proc.GetStatus()
+		pid := proc.GetPid()
+		if pid <= 0 || !proc.IsAlive() {
+			status.Metrics = ProcMetrics{}
+			delete(master.cpu, name)
+			continue
+		}
+		m, sample, err := collectMetrics(pid, children, uptime, master.cpu[name])
+		if err != nil {
+			continue
+		}
+		master.cpu[name] = sample
+		status.addMetrics(m)
+
+		if limit := proc.GetMaxMemory(); limit > 0 && m.RSS > limit {
+			log.Printf("Proc %s uses %d bytes of memory, over its %d bytes limit.", name, m.RSS, limit)
+			delete(master.cpu, name)
+			master.stopAndRestart(proc, "memory limit exceeded")
+		}
+	}
+}
+
+// FormatBytes will format n bytes using binary units, ie: 12.5MiB.
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
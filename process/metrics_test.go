@@ -0,0 +1,109 @@
+package process
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func skipWithoutProcFS(t *testing.T) {
+	t.Helper()
+	if _, err := os.Stat(procFS + "/self/stat"); err != nil {
+		t.Skip("no /proc on this system")
+	}
+}
+
+func TestCollectMetrics(t *testing.T) {
+	skipWithoutProcFS(t)
+	pid := os.Getpid()
+	children, err := procChildren()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uptime, err := systemUptime()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, sample, err := collectMetrics(pid, children, uptime, cpuSample{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.RSS == 0 || m.Threads == 0 || m.FDs == 0 || m.Procs == 0 || m.CPU != 0 {
+		t.Fatalf("unexpected first sample %+v", m)
+	}
+
+	// Burn some cpu so the second sample has something to measure.
+	for start := time.Now(); time.Since(start) < 100*time.Millisecond; {
+	}
+	m, _, err = collectMetrics(pid, children, uptime, sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.CPU <= 0 {
+		t.Fatalf("cpu = %f, want > 0", m.CPU)
+	}
+}
+
+func TestProcStatusMetricsHistory(t *testing.T) {
+	status := &ProcStatus{}
+	for i := 0; i < metricsHistorySize+5; i++ {
+		status.addMetrics(ProcMetrics{Procs: i})
+	}
+	if len(status.History) != metricsHistorySize || status.History[0].Procs != 5 || status.Metrics.Procs != metricsHistorySize+4 {
+		t.Fatalf("unexpected history of %d samples starting at %d", len(status.History), status.History[0].Procs)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[uint64]string{512: "512B", 2048: "2.0KiB", 5 << 20: "5.0MiB", 3 << 30: "3.0GiB"} {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
+
+func TestMasterMemoryCeiling(t *testing.T) {
+	skipWithoutProcFS(t)
+	master := newTestMaster(t, "tree")
+	err := master.RunPreparable(&Preparable{
+		Name:      "tree",
+		Cmd:       "/bin/sh",
+		Args:      []string{"-c", "sleep 30 & sleep 30"},
+		SysFolder: master.SysFolder,
+		// The second restart goes over the crash loop limit.
+		RestartPolicy: RestartPolicy{MaxRestarts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	master.Lock()
+	master.sampleMetrics()
+	proc := master.Procs["tree"].(*Proc)
+	metrics := proc.Status.Metrics
+	master.Unlock()
+	if metrics.Procs < 3 || metrics.RSS == 0 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+
+	master.Lock()
+	proc.MaxMemory = 1
+	master.sampleMetrics()
+	restarts := proc.Status.Restarts
+	master.Unlock()
+	if restarts != 1 {
+		t.Fatalf("restarts = %d, want 1", restarts)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	master.Lock()
+	master.sampleMetrics()
+	state, restarts, reason := proc.Status.Status, proc.Status.Restarts, proc.Status.Reason
+	master.Unlock()
+	if state != "errored" || restarts != 1 || !strings.Contains(reason, "memory") {
+		t.Fatalf("expected the crash loop limit to apply, got status=%s restarts=%d reason=%q", state, restarts, reason)
+	}
+}
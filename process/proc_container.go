@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/spcent/x/helper"
 )
@@ -23,6 +24,10 @@ type ProcContainer interface {
 	SetStatus(status string)
 	GetPid() int
 	GetStatus() *ProcStatus
+	GetRestartPolicy() RestartPolicy
+	GetExitState() *os.ProcessState
+	GetHealthCheck() *HealthCheck
+	GetMaxMemory() uint64
 	Watch() (*os.ProcessState, error)
 }
 
@@ -40,45 +45,152 @@ type Proc struct {
 	KeepAlive bool        // should the process be kept alive after stopping
 	Pid       int         // process pid
 	Status    *ProcStatus // process status
-	process   *os.Process // process instance
+
+	RestartPolicy RestartPolicy // when and how fast the process is restarted after it dies
+	HealthCheck   *HealthCheck  // how the process health is probed, nil disables health checks
+	LogRotation   LogRotation   // how the out and err files are rotated
+	MaxMemory     uint64        // resident memory in bytes above which the process is restarted, zero disables it
+	Readiness     Readiness     // how the process reports it is ready, used by reloads
+	Listeners     []string      // sockets owned by the master and passed to the process from fd 3, ie: tcp://:8080
+
+	StopSignal  string        // signal asking the process group to stop, ie: SIGINT, empty means SIGTERM
+	StopTimeout time.Duration // how long the process has to exit before its group is killed, zero means DefaultStopTimeout
+	PostStart   []string      // command run in the background after every start
+	PreStop     []string      // command run before every stop
+
+	DependsOn               []string // processes or apps started before this one and stopped after it
+	DependencyCondition     string   // what the dependencies must be before a start: running, the default, or healthy
+	RestartWithDependencies bool     // restart the process after one of its dependencies restarts
+
+	Dir   string // working directory, empty means the master one
+	User  string // user name or id the process runs as
+	Group string // group name or id the process runs as
+	Umask string // octal umask, empty means the master one
+
+	App      string // manifest app or cluster the process belongs to, empty if it is not part of one
+	Instance int    // index of the process within App
+	SpecHash string // fingerprint of the manifest spec the process was started from
+
+	process      *os.Process   // process instance
+	run          *procRun      // last run of the process, reaped in the background
+	logs         *logBuffer    // recent output lines, kept across restarts
+	outFile      *rotatingFile // out file, shared with the process replacing this one on reload
+	errFile      *rotatingFile // err file, shared with the process replacing this one on reload
+	sockets      []*os.File    // listening sockets of Listeners, kept across restarts
+	notifySocket string        // NOTIFY_SOCKET of the next start, set by reloads
+}
+
+// procRun is a single run of a process. It is reaped by its own goroutine, so state and err
+// must only be read once exited is closed.
+type procRun struct {
+	exited chan struct{}    // closed once the process is reaped
+	state  *os.ProcessState // state of the run
+	err    error            // error reaping the run
+}
+
+// exitState returns the state of the run, nil if the process was not reaped yet.
+func (run *procRun) exitState() *os.ProcessState {
+	if run == nil {
+		return nil
+	}
+	select {
+	case <-run.exited:
+		return run.state
+	default:
+		return nil
+	}
 }
 
 // Start will execute the command Cmd that should run the process. It will also create an out, err and pidfile
-// in case they do not exist yet.
+// in case they do not exist yet. The process output is piped through the master so it can be rotated and streamed.
 // Returns an error in case there's any.
 func (proc *Proc) Start() error {
-	outFile, err := helper.GetFile(proc.Outfile)
+	wd := proc.Dir
+	if wd == "" {
+		var err error
+		if wd, err = os.Getwd(); err != nil {
+			return err
+		}
+	}
+	cred, err := procCredential(proc.User, proc.Group)
 	if err != nil {
 		return err
 	}
-
-	errFile, err := helper.GetFile(proc.Errfile)
+	umask, err := parseUmask(proc.Umask)
 	if err != nil {
 		return err
 	}
 
-	wd, err := os.Getwd()
+	// Only go builds create the proc folder, make sure it exists for other commands.
+	if proc.Path != "" {
+		if err := os.MkdirAll(proc.Path, 0777); err != nil {
+			return err
+		}
+	}
+	sockets, err := proc.listenerFiles()
+	if err != nil {
+		return err
+	}
+	outFile, errFile, err := proc.outputFiles()
+	if err != nil {
+		return err
+	}
+	outRead, outWrite, err := os.Pipe()
+	if err != nil {
+		outFile.Close()
+		errFile.Close()
+		return err
+	}
+	errRead, errWrite, err := os.Pipe()
 	if err != nil {
+		outFile.Close()
+		errFile.Close()
+		outRead.Close()
+		outWrite.Close()
 		return err
 	}
 
 	env := append(os.Environ(), proc.Env...)
+	env = append(env, listenerEnv(len(sockets))...)
+	if proc.notifySocket != "" {
+		env = append(env, "NOTIFY_SOCKET="+proc.notifySocket)
+	}
 	procAtr := &os.ProcAttr{
 		Dir: wd,
 		Env: env,
-		Files: []*os.File{
+		Files: append([]*os.File{
 			os.Stdin,
-			outFile,
-			errFile,
-		},
+			outWrite,
+			errWrite,
+		}, sockets...),
 	}
+	// Lead a new process group, so stopping the process stops its children too.
+	procAtr.Sys = &syscall.SysProcAttr{Setpgid: true, Credential: cred}
 	args := append([]string{proc.Name}, proc.Args...)
-	process, err := os.StartProcess(proc.Cmd, args, procAtr)
+	process, err := startProcess(proc.Cmd, args, procAtr, umask)
+	// The child owns the write ends now, the pipes are closed once it exits.
+	outWrite.Close()
+	errWrite.Close()
 	if err != nil {
+		outRead.Close()
+		errRead.Close()
+		outFile.Close()
+		errFile.Close()
 		return err
 	}
 
+	go pipeLogs(StreamStdout, outRead, outFile, proc.logBuffer())
+	go pipeLogs(StreamStderr, errRead, errFile, proc.logBuffer())
+
+	// Reap the process right away, so it can be watched more than once.
+	run := &procRun{exited: make(chan struct{})}
+	go func() {
+		run.state, run.err = process.Wait()
+		close(run.exited)
+	}()
+
 	proc.process = process
+	proc.run = run
 	proc.Pid = process.Pid
 	err = helper.WriteFile(proc.Pidfile, []byte(strconv.Itoa(proc.process.Pid)))
 	if err != nil {
@@ -86,14 +198,15 @@ func (proc *Proc) Start() error {
 	}
 
 	proc.Status.SetStatus("started")
+	proc.postStart()
 	return nil
 }
 
-// ForceStop will forcefully send a SIGKILL signal to process killing it instantly.
+// ForceStop will forcefully send a SIGKILL signal to the process group killing it instantly.
 // Returns an error in case there's any.
 func (proc *Proc) ForceStop() error {
 	if proc.process != nil {
-		err := proc.process.Signal(syscall.SIGKILL)
+		err := proc.signalGroup(syscall.SIGKILL)
 		proc.Status.SetStatus("stopped")
 		proc.release()
 		return err
@@ -101,13 +214,17 @@ func (proc *Proc) ForceStop() error {
 	return errors.New("process does not exist")
 }
 
-// GracefullyStop will send a SIGTERM signal asking the process to terminate.
+// GracefullyStop will send StopSignal, SIGTERM by default, asking the process group to terminate.
 // The process may choose to die gracefully or ignore this signal completely. In that case
 // the process will keep running unless you call ForceStop()
 // Returns an error in case there's any.
 func (proc *Proc) GracefullyStop() error {
 	if proc.process != nil {
-		err := proc.process.Signal(syscall.SIGTERM)
+		sig, err := parseSignal(proc.StopSignal)
+		if err != nil {
+			return err
+		}
+		err = proc.signalGroup(sig)
 		proc.Status.SetStatus("asked to stop")
 		return err
 	}
@@ -130,6 +247,7 @@ func (proc *Proc) Restart() error {
 // Returns an error in case there's any.
 func (proc *Proc) Delete() error {
 	proc.release()
+	proc.closeListeners()
 	err := helper.DeleteFile(proc.Outfile)
 	if err != nil {
 		return err
@@ -156,7 +274,72 @@ func (proc *Proc) IsAlive() bool {
 // Watch will stop execution and wait until the process change its state. Usually changing state, means that the process died.
 // Returns a tuple with the new process state and an error in case there's any.
 func (proc *Proc) Watch() (*os.ProcessState, error) {
-	return proc.process.Wait()
+	run := proc.run
+	if run == nil {
+		return nil, errors.New("process was not started")
+	}
+	<-run.exited
+	return run.state, run.err
+}
+
+// Return proc health check
+func (proc *Proc) GetHealthCheck() *HealthCheck {
+	return proc.HealthCheck
+}
+
+// Return the buffer holding the recent output lines, creating it on first use
+func (proc *Proc) logBuffer() *logBuffer {
+	if proc.logs == nil {
+		proc.logs = newLogBuffer()
+	}
+	return proc.logs
+}
+
+// outputFiles returns the out and err files of a new run. They are reused when the run
+// replaced by a reload still writes to them.
+// Returns an error in case there's any.
+func (proc *Proc) outputFiles() (*rotatingFile, *rotatingFile, error) {
+	if proc.outFile == nil {
+		proc.outFile = &rotatingFile{path: proc.Outfile, rotation: proc.LogRotation}
+		proc.errFile = &rotatingFile{path: proc.Errfile, rotation: proc.LogRotation}
+	}
+	if err := proc.outFile.acquire(); err != nil {
+		return nil, nil, err
+	}
+	if err := proc.errFile.acquire(); err != nil {
+		proc.outFile.Close()
+		return nil, nil, err
+	}
+	return proc.outFile, proc.errFile, nil
+}
+
+// Return proc memory ceiling
+func (proc *Proc) GetMaxMemory() uint64 {
+	return proc.MaxMemory
+}
+
+// persisted returns a copy of the proc saved in the config file, without its runtime state.
+func (proc *Proc) persisted() *Proc {
+	saved := *proc
+	if proc.Status != nil {
+		status := *proc.Status
+		status.RecentRestarts = append([]time.Time(nil), proc.Status.RecentRestarts...)
+		status.History = nil
+		saved.Status = &status
+	}
+	saved.process = nil
+	saved.run = nil
+	saved.logs = nil
+	saved.outFile = nil
+	saved.errFile = nil
+	saved.sockets = nil
+	saved.notifySocket = ""
+	return &saved
+}
+
+// Return the state of the last run, nil if the process was not reaped yet
+func (proc *Proc) GetExitState() *os.ProcessState {
+	return proc.run.exitState()
 }
 
 // Will release the process and remove its PID file
@@ -197,6 +380,11 @@ func (proc *Proc) Identifier() string {
 	return proc.Name
 }
 
+// Return proc restart policy
+func (proc *Proc) GetRestartPolicy() RestartPolicy {
+	return proc.RestartPolicy
+}
+
 // Returns true if the process should be kept alive or not
 func (proc *Proc) ShouldKeepAlive() bool {
 	return proc.KeepAlive
@@ -1,9 +1,25 @@
 package process
 
+import (
+	"os"
+	"time"
+)
+
 // ProcStatus is a wrapper with the process current status.
 type ProcStatus struct {
-	Status   string // "running", "stopped", "exited"
+	Status   string // "running", "stopped", "exited", "backoff", "errored"
 	Restarts int    // number of restarts
+
+	ExitCode       int         // exit code of the last run, -1 if it was killed by a signal
+	ExitedAt       time.Time   // when the last run ended
+	Reason         string      // why the process is errored
+	NextRestartAt  time.Time   // when a process in backoff will be restarted
+	RecentRestarts []time.Time // restarts within the restart policy window
+
+	Health HealthStatus // result of the health checks
+
+	Metrics ProcMetrics   // latest resource usage sample
+	History []ProcMetrics `toml:"-"` // recent resource usage samples, oldest first
 }
 
 // SetStatus will set the process string status.
@@ -15,3 +31,31 @@ func (p *ProcStatus) SetStatus(status string) {
 func (p *ProcStatus) AddRestart() {
 	p.Restarts++
 }
+
+// SetExit will record how the last run of the process ended.
+func (p *ProcStatus) SetExit(state *os.ProcessState) {
+	p.ExitCode = -1
+	if state != nil {
+		p.ExitCode = state.ExitCode()
+	}
+	p.ExitedAt = time.Now()
+}
+
+// ResetRestarts will forget the recent restarts, clearing an errored state.
+func (p *ProcStatus) ResetRestarts() {
+	p.RecentRestarts = nil
+	p.NextRestartAt = time.Time{}
+	p.Reason = ""
+}
+
+// pruneRestarts drops restarts older than window and returns how many are left.
+func (p *ProcStatus) pruneRestarts(now time.Time, window time.Duration) int {
+	kept := p.RecentRestarts[:0]
+	for _, t := range p.RecentRestarts {
+		if now.Sub(t) < window {
+			kept = append(kept, t)
+		}
+	}
+	p.RecentRestarts = kept
+	return len(kept)
+}
@@ -3,6 +3,7 @@ package process
 import (
 	"os/exec"
 	"strings"
+	"time"
 )
 
 type ProcPreparable interface {
@@ -15,33 +16,58 @@ type ProcPreparable interface {
 // a process. To actually run a process, call the Start() method.
 type Preparable struct {
 	Name       string   // The name of the process
-	SourcePath string   // The path to the source code of the process
+	SourcePath string   // The go package, binary, shell command or script of the process, depending on Language
 	Cmd        string   // The command to be executed
 	SysFolder  string   // The folder where all the process files will be stored
-	Language   string   // The language of the process, ie: go, python, nodejs, etc.
+	Language   string   // The language of the process, ie: go, binary, shell, python, nodejs, etc.
 	KeepAlive  bool     // If true, the process will be kept alive after it exits
 	Args       []string // The arguments to be passed to the process
 	Env        []string // The environment variables to be passed to the process, ie: PORT=8080, DEBUG=true
+
+	Interpreter     string   // The interpreter running SourcePath, defaults to the one of Language
+	InterpreterArgs []string // The arguments passed to the interpreter before SourcePath
+	Dir             string   // The working directory of the process, defaults to the master one
+	User            string   // The user name or id the process runs as
+	Group           string   // The group name or id the process runs as
+	Umask           string   // The octal umask of the process, ie: 022
+
+	App      string // The manifest app or cluster the process belongs to, if any
+	Instance int    // The index of the process within App
+	SpecHash string // The fingerprint of the manifest spec the process is started from
+
+	RestartPolicy RestartPolicy // The restart policy applied when the process dies
+	HealthCheck   *HealthCheck  // The health check run while the process is alive, if any
+	LogRotation   LogRotation   // The rotation applied to the out and err files
+	MaxMemory     uint64        // The resident memory in bytes above which the process is restarted
+	Readiness     Readiness     // How the process reports it is ready, used by reloads
+	Listeners     []string      // The sockets owned by the master and passed to the process, ie: tcp://:8080
+
+	StopSignal  string        // The signal asking the process to stop, ie: SIGINT, defaults to SIGTERM
+	StopTimeout time.Duration // How long the process has to stop before it is killed, defaults to DefaultStopTimeout
+	PostStart   []string      // The command run after every start
+	PreStop     []string      // The command run before every stop
+
+	DependsOn               []string // The processes or apps started before this one and stopped after it
+	DependencyCondition     string   // What the dependencies must be before a start: running, the default, or healthy
+	RestartWithDependencies bool     // Whether to restart the process after one of its dependencies restarts
 }
 
-// PrepareBin will compile the Golang project from SourcePath and populate Cmd with the proper
-// command for the process to be executed.
+// PrepareBin will compile the Golang project from SourcePath, or resolve the binary, shell or
+// interpreter for other languages, and populate Cmd with the proper command for the process to be executed.
 // Returns the compile command output.
 func (preparable *Preparable) PrepareBin() ([]byte, error) {
+	if preparable.Language != LanguageGo {
+		return nil, preparable.resolveCommand()
+	}
 	// Remove the last character '/' if present
 	if preparable.SourcePath[len(preparable.SourcePath)-1] == '/' {
 		preparable.SourcePath = strings.TrimSuffix(preparable.SourcePath, "/")
 	}
-	cmd := ""
-	cmdArgs := []string{}
 	binPath := preparable.getBinPath()
-	if preparable.Language == "go" {
-		cmd = "go"
-		cmdArgs = []string{"build", "-o", binPath, preparable.SourcePath + "/."}
-	}
+	cmdArgs := []string{"build", "-o", binPath, preparable.SourcePath + "/."}
 
-	preparable.Cmd = preparable.getBinPath()
-	return exec.Command(cmd, cmdArgs...).Output()
+	preparable.Cmd = binPath
+	return exec.Command("go", cmdArgs...).Output()
 }
 
 // Start will execute the process based on the information presented on the preparable.
@@ -60,6 +86,31 @@ func (preparable *Preparable) Start() (ProcContainer, error) {
 		Errfile:   preparable.getErrPath(),
 		KeepAlive: preparable.KeepAlive,
 		Status:    &ProcStatus{},
+
+		RestartPolicy: preparable.RestartPolicy,
+		HealthCheck:   preparable.HealthCheck,
+		LogRotation:   preparable.LogRotation,
+		MaxMemory:     preparable.MaxMemory,
+		Readiness:     preparable.Readiness,
+		Listeners:     preparable.Listeners,
+
+		StopSignal:  preparable.StopSignal,
+		StopTimeout: preparable.StopTimeout,
+		PostStart:   preparable.PostStart,
+		PreStop:     preparable.PreStop,
+
+		DependsOn:               preparable.DependsOn,
+		DependencyCondition:     preparable.DependencyCondition,
+		RestartWithDependencies: preparable.RestartWithDependencies,
+
+		Dir:   preparable.Dir,
+		User:  preparable.User,
+		Group: preparable.Group,
+		Umask: preparable.Umask,
+
+		App:      preparable.App,
+		Instance: preparable.Instance,
+		SpecHash: preparable.SpecHash,
 	}
 
 	err := proc.Start()
@@ -0,0 +1,338 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spcent/x/helper"
+)
+
+// DefaultReloadTimeout is how long Reload waits for the new process to be ready when neither
+// Readiness nor the health check set a timeout.
+const DefaultReloadTimeout = 30 * time.Second
+
+// readyPollInterval is how often Reload looks for the ready file.
+const readyPollInterval = 50 * time.Millisecond
+
+// Readiness tells how a process reports it is ready to serve. It is used by Reload to know when
+// the old process can be stopped. Without File or Notify, the health check is used, and without
+// a health check the new process is considered ready as soon as it started.
+type Readiness struct {
+	File    string        // File is created by the process once it is ready, relative to the proc folder. It is removed before a reload.
+	Notify  bool          // Notify sets NOTIFY_SOCKET so the process can send READY=1 on it once ready, as with systemd.
+	Timeout time.Duration // Timeout is how long to wait for the new process, defaults to the health check ReadyTimeout or DefaultReloadTimeout.
+}
+
+// timeout returns how long to wait for a process with health check hc to be ready.
+func (readiness Readiness) timeout(hc *HealthCheck) time.Duration {
+	if readiness.Timeout > 0 {
+		return readiness.Timeout
+	}
+	if hc != nil && hc.ReadyTimeout > 0 {
+		return hc.ReadyTimeout
+	}
+	return DefaultReloadTimeout
+}
+
+// parseListener will split a listener address such as tcp://:8080, unix:///run/app.sock
+// or :8080 into its network and address.
+// Returns an error in case the network is not supported.
+func parseListener(listener string) (string, string, error) {
+	network, address, ok := strings.Cut(listener, "://")
+	if !ok {
+		return "tcp", listener, nil
+	}
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return network, address, nil
+	}
+	return "", "", fmt.Errorf("unsupported listener %q", listener)
+}
+
+// listenerFiles returns the sockets the process listens on, opening them on first use. They are owned
+// by the master and kept open across restarts and reloads, so the ports never close.
+// Returns an error in case there's any.
+func (proc *Proc) listenerFiles() ([]*os.File, error) {
+	if proc.sockets != nil || len(proc.Listeners) == 0 {
+		return proc.sockets, nil
+	}
+	files := make([]*os.File, 0, len(proc.Listeners))
+	for _, listener := range proc.Listeners {
+		file, err := listenFile(listener)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	proc.sockets = files
+	return files, nil
+}
+
+// listenFile will listen on listener and return a duplicate of the socket that can be passed to a child.
+// Returns an error in case there's any.
+func listenFile(listener string) (*os.File, error) {
+	network, address, err := parseListener(listener)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		// Remove the socket left behind by a previous master.
+		if err := os.Remove(address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	// The duplicate keeps the socket listening once l is closed.
+	defer l.Close()
+	if unixListener, ok := l.(*net.UnixListener); ok {
+		unixListener.SetUnlinkOnClose(false)
+	}
+	return l.(interface{ File() (*os.File, error) }).File()
+}
+
+// closeListeners will close the sockets of the process, releasing their ports.
+func (proc *Proc) closeListeners() {
+	for _, f := range proc.sockets {
+		f.Close()
+	}
+	proc.sockets = nil
+}
+
+// listenerEnv returns the environment telling the process about its n inherited sockets.
+func listenerEnv(n int) []string {
+	if n == 0 {
+		return nil
+	}
+	// LISTEN_PID can't be set since the pid is not known before the process starts.
+	return []string{"LISTEN_FDS=" + strconv.Itoa(n)}
+}
+
+// readyFile returns the path of the ready file of the process, empty if it has none.
+func (proc *Proc) readyFile() string {
+	if proc.Readiness.File == "" || filepath.IsAbs(proc.Readiness.File) {
+		return proc.Readiness.File
+	}
+	return filepath.Join(proc.Path, proc.Readiness.File)
+}
+
+// reloadCopy returns a copy of proc that is not started yet. It shares the sockets, the output
+// files and the recent output lines of proc.
+func (proc *Proc) reloadCopy() *Proc {
+	next := *proc
+	status := *proc.Status
+	status.Health = HealthStatus{}
+	next.Status = &status
+	next.process = nil
+	next.run = nil
+	next.notifySocket = ""
+	next.logBuffer()
+	proc.logs = next.logs
+	return &next
+}
+
+// Reload will replace process name without downtime: a new process is started next to the running
+// one and, once it is ready, the old process is gracefully stopped. The old process keeps running
+// if the new one fails to start or to be ready in time.
+// Processes that are not running are started.
+// Returns an error in case there's any.
+func (master *Master) Reload(name string) error {
+	master.Lock()
+	proc, ok := master.Procs[name].(*Proc)
+	if !ok {
+		master.Unlock()
+		return ErrUnknownProcess
+	}
+	if !proc.IsAlive() {
+		master.Unlock()
+		return master.StartProcess(name)
+	}
+
+	next := proc.reloadCopy()
+	notify, err := next.prepareReadiness()
+	if err != nil {
+		master.Unlock()
+		return err
+	}
+	if notify != nil {
+		defer os.Remove(next.notifySocket)
+		defer notify.Close()
+	}
+	log.Printf("Reloading proc %s.", name)
+	err = next.Start()
+	// Later restarts of the new process are not waited for.
+	next.notifySocket = ""
+	master.Unlock()
+	if err != nil {
+		helper.WriteFile(proc.Pidfile, []byte(strconv.Itoa(proc.Pid)))
+		return err
+	}
+
+	if err := next.waitReloadReady(notify); err != nil {
+		log.Printf("Proc %s was not reloaded: %s.", name, err)
+		next.abandon()
+		helper.WriteFile(proc.Pidfile, []byte(strconv.Itoa(proc.Pid)))
+		return fmt.Errorf("reload %s: %w", name, err)
+	}
+
+	master.Lock()
+	if master.Procs[name] != ProcContainer(proc) {
+		master.Unlock()
+		// The process was deleted or replaced while the new one was starting.
+		next.abandon()
+		return fmt.Errorf("reload %s: process changed while reloading", name)
+	}
+	defer master.Unlock()
+	if err := master.stop(proc); err != nil {
+		next.abandon()
+		return err
+	}
+	if master.Procs[name] != ProcContainer(proc) {
+		// The lock is released while the old process stops.
+		next.abandon()
+		return fmt.Errorf("reload %s: process changed while reloading", name)
+	}
+	// Killing the old process removes the pidfile they share.
+	helper.WriteFile(next.Pidfile, []byte(strconv.Itoa(next.Pid)))
+	master.Procs[name] = next
+	master.Watcher.AddProcWatcher(next)
+	master.startHealth(next)
+	next.SetStatus("running")
+	log.Printf("Proc %s reloaded, pid %d replaced pid %d.", name, next.Pid, proc.Pid)
+	master.propagateRestart(name)
+	return master.saveProcsWrapper()
+}
+
+// abandon will kill the process group of a reload that did not go through and wait for it
+// to be reaped.
+func (proc *Proc) abandon() {
+	proc.signalGroup(syscall.SIGKILL)
+	<-proc.run.exited
+}
+
+// prepareReadiness will clear the ready file and open the notify socket of the process
+// before it is started.
+// Returns the notify socket, nil if the process does not use one, and an error in case there's any.
+func (proc *Proc) prepareReadiness() (*net.UnixConn, error) {
+	if file := proc.readyFile(); file != "" {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if !proc.Readiness.Notify {
+		return nil, nil
+	}
+	if err := os.MkdirAll(proc.Path, 0777); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(proc.Path, fmt.Sprintf("notify-%d.sock", time.Now().UnixNano()))
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	proc.notifySocket = path
+	return conn, nil
+}
+
+// waitReloadReady will block until the reloaded process is ready.
+// Returns an error in case it exits or is not ready in time.
+func (proc *Proc) waitReloadReady(notify *net.UnixConn) error {
+	timeout := proc.Readiness.timeout(proc.HealthCheck)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ready := make(chan error, 1)
+	switch {
+	case notify != nil:
+		go func() { ready <- waitNotifyReady(ctx, notify) }()
+	case proc.readyFile() != "":
+		go func() { ready <- waitReadyFile(ctx, proc.readyFile()) }()
+	case proc.HealthCheck != nil:
+		go func() { ready <- waitHealthy(ctx, proc.HealthCheck) }()
+	default:
+		return nil
+	}
+
+	select {
+	case err := <-ready:
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("not ready within %s", timeout)
+		}
+		return err
+	case <-proc.run.exited:
+		return errors.New("new process exited before being ready")
+	}
+}
+
+// waitNotifyReady will read notifications from conn until one reports READY=1.
+// Returns an error in case ctx is done first.
+func waitNotifyReady(ctx context.Context, conn *net.UnixConn) error {
+	deadline, _ := ctx.Deadline()
+	conn.SetReadDeadline(deadline)
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line == "READY=1" {
+				return nil
+			}
+		}
+	}
+}
+
+// waitReadyFile will wait for path to exist.
+// Returns an error in case ctx is done first.
+func waitReadyFile(ctx context.Context, path string) error {
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitHealthy will probe hc until it passes. The probe can't tell the old and the new process apart
+// when both serve the same address, prefer File or Notify when listeners are handed off.
+// Returns an error in case ctx is done first.
+func waitHealthy(ctx context.Context, hc *HealthCheck) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(hc.InitialDelay):
+	}
+	ticker := time.NewTicker(hc.interval())
+	defer ticker.Stop()
+	for {
+		if err := hc.Probe(ctx); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
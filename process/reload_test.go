@@ -0,0 +1,202 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperServer is not a real test, it is the server run by TestReloadListenerHandoff.
+// It serves its pid on the socket inherited on fd 3 and notifies its readiness.
+func TestHelperServer(t *testing.T) {
+	if os.Getenv("APM_TEST_HELPER") != "server" {
+		return
+	}
+	l, err := net.FileListener(os.NewFile(3, "listener"))
+	if err != nil {
+		os.Exit(2)
+	}
+	if socket := os.Getenv("NOTIFY_SOCKET"); socket != "" {
+		conn, err := net.Dial("unixgram", socket)
+		if err != nil {
+			os.Exit(3)
+		}
+		conn.Write([]byte("STATUS=serving\nREADY=1"))
+		conn.Close()
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			os.Exit(0)
+		}
+		fmt.Fprintf(conn, "%d\n", os.Getpid())
+		conn.Close()
+	}
+}
+
+func servedPid(t *testing.T, addr string) int {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pid
+}
+
+func TestReloadListenerHandoff(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	master := newTestMaster(t, "server")
+	err = master.RunPreparable(&Preparable{
+		Name:      "server",
+		Cmd:       executable,
+		Args:      []string{"-test.run=^TestHelperServer$"},
+		Env:       []string{"APM_TEST_HELPER=server"},
+		SysFolder: master.SysFolder,
+		Readiness: Readiness{Notify: true, Timeout: 5 * time.Second},
+		Listeners: []string{"tcp://127.0.0.1:0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := master.Procs["server"].(*Proc)
+	l, err := net.FileListener(old.sockets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	if pid := servedPid(t, addr); pid != old.Pid {
+		t.Fatalf("expected pid %d to serve, got %d", old.Pid, pid)
+	}
+	if err := master.Reload("server"); err != nil {
+		t.Fatal(err)
+	}
+	next := master.Procs["server"].(*Proc)
+	if next == old || next.Pid == old.Pid {
+		t.Fatal("expected a new process")
+	}
+	if old.IsAlive() {
+		t.Fatal("expected the old process to be stopped")
+	}
+	if pid := servedPid(t, addr); pid != next.Pid {
+		t.Fatalf("expected pid %d to serve, got %d", next.Pid, pid)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(next.Path, "notify-*.sock")); len(entries) != 0 {
+		t.Fatalf("expected the notify socket to be removed, got %v", entries)
+	}
+}
+
+func TestReloadReadyFile(t *testing.T) {
+	master := newTestMaster(t, "worker")
+	readyFile := filepath.Join(t.TempDir(), "ready")
+	err := master.RunPreparable(&Preparable{
+		Name:      "worker",
+		Cmd:       "/bin/sh",
+		Args:      []string{"-c", "sleep 0.2; touch " + readyFile + "; sleep 30"},
+		SysFolder: master.SysFolder,
+		Readiness: Readiness{File: readyFile, Timeout: 5 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := master.Procs["worker"].(*Proc)
+
+	done := make(chan error, 1)
+	go func() { done <- master.Reload("worker") }()
+	time.Sleep(100 * time.Millisecond)
+	master.Lock()
+	alive := old.IsAlive()
+	master.Unlock()
+	if !alive {
+		t.Fatal("expected the old process to run until the new one is ready")
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	next := master.Procs["worker"].(*Proc)
+	if next.Pid == old.Pid || old.IsAlive() || !next.IsAlive() {
+		t.Fatalf("expected pid %d to replace pid %d", next.Pid, old.Pid)
+	}
+	b, err := os.ReadFile(next.Pidfile)
+	if err != nil || string(b) != strconv.Itoa(next.Pid) {
+		t.Fatalf("expected pidfile to hold %d, got %q %v", next.Pid, b, err)
+	}
+}
+
+func TestReloadNotReady(t *testing.T) {
+	master := newTestMaster(t, "stuck")
+	children := filepath.Join(t.TempDir(), "children")
+	err := master.RunPreparable(&Preparable{
+		Name:      "stuck",
+		Cmd:       "/bin/sh",
+		Args:      []string{"-c", "sleep 30 & echo $! >> " + children + "; wait"},
+		SysFolder: master.SysFolder,
+		Readiness: Readiness{File: filepath.Join(t.TempDir(), "never"), Timeout: 200 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := master.Procs["stuck"].(*Proc)
+	if err := master.Reload("stuck"); err == nil {
+		t.Fatal("expected the reload to time out")
+	}
+	if master.Procs["stuck"] != ProcContainer(old) || !old.IsAlive() {
+		t.Fatal("expected the old process to keep running")
+	}
+	b, err := os.ReadFile(old.Pidfile)
+	if err != nil || string(b) != strconv.Itoa(old.Pid) {
+		t.Fatalf("expected pidfile to hold %d, got %q %v", old.Pid, b, err)
+	}
+
+	pids := strings.Fields(waitFileContent(t, children))
+	if len(pids) != 2 {
+		t.Fatalf("expected a child per run, got %q", pids)
+	}
+	oldChild, _ := strconv.Atoi(pids[0])
+	newChild, _ := strconv.Atoi(pids[1])
+	deadline := time.Now().Add(time.Second)
+	for !processGone(newChild) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the child of the new process to be killed with its group")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if processGone(oldChild) {
+		t.Fatal("expected the child of the old process to keep running")
+	}
+}
+
+func TestParseListener(t *testing.T) {
+	for listener, want := range map[string][2]string{
+		":8080":                {"tcp", ":8080"},
+		"tcp6://[::1]:80":      {"tcp6", "[::1]:80"},
+		"unix:///run/app.sock": {"unix", "/run/app.sock"},
+	} {
+		network, address, err := parseListener(listener)
+		if err != nil || network != want[0] || address != want[1] {
+			t.Errorf("%s: got %s %s %v", listener, network, address, err)
+		}
+	}
+	if _, _, err := parseListener("udp://:53"); err == nil {
+		t.Error("expected udp to be rejected")
+	}
+}
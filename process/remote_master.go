@@ -1,21 +1,65 @@
 package process
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
-	"net/rpc"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
-// RemoteMaster is a struct that holds the master instance.
+// logFollowWait is how long a single follow request waits on the server for new lines.
+const logFollowWait = 10 * time.Second
+
+// RemoteMaster is a struct that holds the master instance and the control API servers.
 type RemoteMaster struct {
-	master *Master // Master instance
+	master  *Master        // Master instance
+	servers []*http.Server // API servers, one per listener
+	addrs   []net.Addr     // addrs the API servers listen on
+}
+
+// Addrs returns the addresses the API is served on.
+func (m *RemoteMaster) Addrs() []net.Addr {
+	return m.addrs
 }
 
 // RemoteClient is a struct that holds the remote client instance.
 type RemoteClient struct {
-	conn *rpc.Client // RpcConnection for the remote client.
+	http    *http.Client // HTTP client connected to the control API.
+	baseURL string       // baseURL is the API root, ie: https://127.0.0.1:9999/v1.
+	token   string       // token is the bearer token sent with every request.
+}
+
+// ClientOption configures a RemoteClient.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	token     string
+	tlsConfig *tls.Config
+}
+
+// WithToken sets the bearer token sent with every request.
+func WithToken(token string) ClientOption {
+	return func(o *clientOptions) { o.token = token }
+}
+
+// WithTLSConfig sets the TLS config used for https addresses, ie: to trust a private CA
+// or present a client certificate.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(o *clientOptions) { o.tlsConfig = config }
 }
 
 // GoBin is a struct that represents the necessary arguments for a go binary to be built.
@@ -24,6 +68,74 @@ type GoBin struct {
 	Name       string   // Name is the process name that will be given to the process.
 	KeepAlive  bool     // KeepAlive will determine whether APM should keep the proc live or not.
 	Args       []string // Args is an array containing all the extra args that will be passed to the binary after compilation.
+
+	RestartPolicy RestartPolicy // RestartPolicy decides when and how fast the process is restarted after it dies.
+	HealthCheck   *HealthCheck  // HealthCheck is the optional health check run while the process is alive.
+	LogRotation   LogRotation   // LogRotation is the rotation applied to the process out and err files.
+	MaxMemory     uint64        // MaxMemory is the resident memory in bytes above which the process is restarted.
+	Readiness     Readiness     // Readiness tells how the process reports it is ready when it is reloaded.
+	Listeners     []string      // Listeners are sockets owned by APM and passed to the process from fd 3, ie: tcp://:8080.
+
+	StopSignal  string        // StopSignal asks the process to stop, ie: SIGINT, defaults to SIGTERM.
+	StopTimeout time.Duration // StopTimeout is how long the process has to stop before it is killed.
+	PostStart   []string      // PostStart is a command run after every start.
+	PreStop     []string      // PreStop is a command run before every stop.
+
+	DependsOn               []string // DependsOn are the processes or apps started before this one and stopped after it.
+	DependencyCondition     string   // DependencyCondition is what the dependencies must be before a start: running or healthy.
+	RestartWithDependencies bool     // RestartWithDependencies restarts the process after one of its dependencies restarts.
+}
+
+// Command is a struct that represents the necessary arguments to run a process of any language:
+// a go package, a prebuilt binary, a shell command or a script run by an interpreter.
+type Command struct {
+	Name      string   // Name is the process name that will be given to the process.
+	Language  string   // Language is go, binary, shell or an interpreted language such as python or node.
+	Source    string   // Source is the go package, binary path, shell command or script, depending on Language.
+	KeepAlive bool     // KeepAlive will determine whether APM should keep the proc live or not.
+	Args      []string // Args is an array containing all the extra args that will be passed to the process.
+	Env       []string // Env is an array of KEY=VALUE pairs added to the process environment.
+
+	Interpreter     string   // Interpreter overrides the interpreter of Language, ie: python3.12.
+	InterpreterArgs []string // InterpreterArgs are passed to the interpreter before the script.
+	Dir             string   // Dir is the working directory, defaults to the APM one.
+	User            string   // User is the user name or id the process runs as.
+	Group           string   // Group is the group name or id the process runs as.
+	Umask           string   // Umask is the octal umask of the process, ie: 022.
+
+	RestartPolicy RestartPolicy // RestartPolicy decides when and how fast the process is restarted after it dies.
+	HealthCheck   *HealthCheck  // HealthCheck is the optional health check run while the process is alive.
+	LogRotation   LogRotation   // LogRotation is the rotation applied to the process out and err files.
+	MaxMemory     uint64        // MaxMemory is the resident memory in bytes above which the process is restarted.
+	Readiness     Readiness     // Readiness tells how the process reports it is ready when it is reloaded.
+	Listeners     []string      // Listeners are sockets owned by APM and passed to the process from fd 3, ie: tcp://:8080.
+
+	StopSignal  string        // StopSignal asks the process to stop, ie: SIGINT, defaults to SIGTERM.
+	StopTimeout time.Duration // StopTimeout is how long the process has to stop before it is killed.
+	PostStart   []string      // PostStart is a command run after every start.
+	PreStop     []string      // PreStop is a command run before every stop.
+
+	DependsOn               []string // DependsOn are the processes or apps started before this one and stopped after it.
+	DependencyCondition     string   // DependencyCondition is what the dependencies must be before a start: running or healthy.
+	RestartWithDependencies bool     // RestartWithDependencies restarts the process after one of its dependencies restarts.
+}
+
+// ManifestResponse is a struct that holds the actions computed or applied for a manifest.
+type ManifestResponse struct {
+	Actions []ManifestAction
+	Error   string // Error is set when applying failed after Actions were applied.
+}
+
+// ScaleRequest is a struct that represents the arguments to scale a cluster.
+type ScaleRequest struct {
+	Name      string // Name is the cluster name.
+	Instances int    // Instances is the number of instances to run.
+}
+
+// ProcRestartPolicy is a struct that represents the arguments to change the restart policy of a process.
+type ProcRestartPolicy struct {
+	Name   string        // Name is the process name.
+	Policy RestartPolicy // Policy is the new restart policy.
 }
 
 type ProcDataResponse struct {
@@ -31,12 +143,35 @@ type ProcDataResponse struct {
 	Pid       int
 	Status    *ProcStatus
 	KeepAlive bool
+
+	App       string // App is the manifest app or cluster of the process, if any.
+	Instance  int    // Instance is the index of the process within App.
+	Instances int    // Instances is the number of instances App should run, 0 if it is not a cluster.
+
+	RestartPolicy RestartPolicy
+	HealthCheck   *HealthCheck
+	MaxMemory     uint64
 }
 
 type ProcResponse struct {
 	Procs []*ProcDataResponse
 }
 
+// LogsRequest is a struct that represents the arguments to read the logs of a process.
+type LogsRequest struct {
+	Name   string        // Name is the process name.
+	Lines  int           // Lines is how many of the last lines to return when Follow is false.
+	Follow bool          // Follow asks for the lines written after After instead of the last lines.
+	After  uint64        // After is the sequence returned by the previous call.
+	Wait   time.Duration // Wait is how long a follow request waits for new lines.
+}
+
+// LogsResponse is a struct that holds the requested log lines.
+type LogsResponse struct {
+	Lines []LogLine // Lines are the log lines, oldest first.
+	Next  uint64    // Next is the sequence to pass as After on the next follow request.
+}
+
 // Save will save the current running and stopped processes onto a file.
 // Returns an error in case there's any.
 func (m *RemoteMaster) Save(req string, ack *bool) error {
@@ -57,14 +192,90 @@ func (m *RemoteMaster) Resurrect(req string, ack *bool) error {
 // and keep it alive if KeepAlive is set to true.
 // It returns an error and binds true to ack pointer.
 func (m *RemoteMaster) StartGoBin(goBin *GoBin, ack *bool) error {
+	if goBin.HealthCheck != nil {
+		if err := goBin.HealthCheck.Validate(); err != nil {
+			*ack = true
+			return err
+		}
+	}
 	preparable, output, err := m.master.Prepare(goBin.SourcePath, goBin.Name, "go", goBin.KeepAlive, goBin.Args)
 	*ack = true
 	if err != nil {
 		return fmt.Errorf("ERROR: %s OUTPUT: %s", err, string(output))
 	}
+	preparable.RestartPolicy = goBin.RestartPolicy
+	preparable.HealthCheck = goBin.HealthCheck
+	preparable.LogRotation = goBin.LogRotation
+	preparable.MaxMemory = goBin.MaxMemory
+	preparable.Readiness = goBin.Readiness
+	preparable.Listeners = goBin.Listeners
+	preparable.StopSignal = goBin.StopSignal
+	preparable.StopTimeout = goBin.StopTimeout
+	preparable.PostStart = goBin.PostStart
+	preparable.PreStop = goBin.PreStop
+	preparable.DependsOn = goBin.DependsOn
+	preparable.DependencyCondition = goBin.DependencyCondition
+	preparable.RestartWithDependencies = goBin.RestartWithDependencies
+	return m.master.RunPreparable(preparable)
+}
+
+// StartCommand will prepare the process described by command, then it will start the process
+// and keep it alive if KeepAlive is set to true.
+// It returns an error and binds true to ack pointer.
+func (m *RemoteMaster) StartCommand(command *Command, ack *bool) error {
+	preparable, output, err := m.master.PrepareCommand(command)
+	*ack = true
+	if err != nil {
+		return fmt.Errorf("ERROR: %s OUTPUT: %s", err, string(output))
+	}
 	return m.master.RunPreparable(preparable)
 }
 
+// StartCluster will start the instances of cluster.
+// It returns an error in case there's any.
+func (m *RemoteMaster) StartCluster(cluster *Cluster, ack *bool) error {
+	*ack = true
+	return m.master.StartCluster(cluster)
+}
+
+// Scale will start or delete instances of a cluster until it runs the requested number of instances.
+// It returns an error in case there's any.
+func (m *RemoteMaster) Scale(req *ScaleRequest, ack *bool) error {
+	*ack = true
+	return m.master.Scale(req.Name, req.Instances)
+}
+
+// RollingRestart will restart the instances of cluster name one at a time.
+// It returns an error in case there's any.
+func (m *RemoteMaster) RollingRestart(name string, ack *bool) error {
+	*ack = true
+	return m.master.RollingRestart(name)
+}
+
+// DeleteCluster will delete cluster name and its instances.
+// It returns an error in case there's any.
+func (m *RemoteMaster) DeleteCluster(name string, ack *bool) error {
+	*ack = true
+	return m.master.DeleteCluster(name)
+}
+
+// ApplyManifest will start, stop, restart and delete processes to converge to manifest and
+// bind the applied actions to response.
+// It returns an error in case there's any.
+func (m *RemoteMaster) ApplyManifest(manifest *Manifest, response *ManifestResponse) error {
+	actions, err := m.master.Apply(manifest)
+	*response = ManifestResponse{Actions: actions}
+	return err
+}
+
+// DiffManifest will bind the actions needed to converge to manifest to response, without applying them.
+// It returns an error in case there's any.
+func (m *RemoteMaster) DiffManifest(manifest *Manifest, response *ManifestResponse) error {
+	actions, err := m.master.Diff(manifest)
+	*response = ManifestResponse{Actions: actions}
+	return err
+}
+
 // RestartProcess will restart a process that was previously built using GoBin.
 // It returns an error in case there's any.
 func (m *RemoteMaster) RestartProcess(procName string, ack *bool) error {
@@ -72,6 +283,13 @@ func (m *RemoteMaster) RestartProcess(procName string, ack *bool) error {
 	return m.master.RestartProcess(procName)
 }
 
+// ReloadProcess will replace a running process without downtime.
+// It returns an error in case there's any.
+func (m *RemoteMaster) ReloadProcess(procName string, ack *bool) error {
+	*ack = true
+	return m.master.Reload(procName)
+}
+
 // StartProcess will start a process that was previously built using GoBin.
 // It returns an error in case there's any.
 func (m *RemoteMaster) StartProcess(procName string, ack *bool) error {
@@ -90,6 +308,8 @@ func (m *RemoteMaster) StopProcess(procName string, ack *bool) error {
 // It returns an error in case there's any.
 func (m *RemoteMaster) MonitStatus(req string, response *ProcResponse) error {
 	// req = ""
+	m.master.Lock()
+	defer m.master.Unlock()
 	procs := m.master.ListProcs()
 	procsResponse := []*ProcDataResponse{}
 	for id := range procs {
@@ -99,15 +319,63 @@ func (m *RemoteMaster) MonitStatus(req string, response *ProcResponse) error {
 			Pid:       proc.GetPid(),
 			Status:    proc.GetStatus(),
 			KeepAlive: proc.ShouldKeepAlive(),
+
+			App:      procApp(proc),
+			Instance: procInstance(proc),
+
+			RestartPolicy: proc.GetRestartPolicy(),
+			HealthCheck:   proc.GetHealthCheck(),
+			MaxMemory:     proc.GetMaxMemory(),
+		}
+		if cluster, ok := m.master.Clusters[procData.App]; ok {
+			procData.Instances = cluster.Instances
 		}
 		procsResponse = append(procsResponse, procData)
 	}
+	// Keep the instances of an app together, in index order.
+	group := func(proc *ProcDataResponse) string {
+		if proc.App != "" {
+			return proc.App
+		}
+		return proc.Name
+	}
+	sort.Slice(procsResponse, func(i, j int) bool {
+		a, b := procsResponse[i], procsResponse[j]
+		if group(a) != group(b) {
+			return group(a) < group(b)
+		}
+		return a.Instance < b.Instance
+	})
 	*response = ProcResponse{
 		Procs: procsResponse,
 	}
 	return nil
 }
 
+// SetRestartPolicy will change the restart policy of a process.
+// It returns an error in case there's any.
+func (m *RemoteMaster) SetRestartPolicy(req *ProcRestartPolicy, ack *bool) error {
+	*ack = true
+	return m.master.SetRestartPolicy(req.Name, req.Policy)
+}
+
+// Logs will bind the log lines requested by req to response.
+// It returns an error in case there's any.
+func (m *RemoteMaster) Logs(req *LogsRequest, response *LogsResponse) error {
+	var (
+		lines []LogLine
+		next  uint64
+		err   error
+	)
+	if req.Follow {
+		lines, next, err = m.master.FollowLogs(req.Name, req.After, req.Wait)
+	} else {
+		lines, next, err = m.master.Logs(req.Name, req.Lines)
+	}
+	*response = LogsResponse{Lines: lines, Next: next}
+	return err
+}
+
 // DeleteProcess will delete a process with name procName.
 // It returns an error in case there's any.
 func (m *RemoteMaster) DeleteProcess(procName string, ack *bool) error {
@@ -115,55 +383,201 @@ func (m *RemoteMaster) DeleteProcess(procName string, ack *bool) error {
 	return m.master.DeleteProcess(procName)
 }
 
-// Stop will stop APM remote server.
+// Stop will stop the API servers and APM.
 // It returns an error in case there's any.
 func (m *RemoteMaster) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, server := range m.servers {
+		server.Shutdown(ctx)
+	}
 	return m.master.Stop()
 }
 
-// StartRemoteMasterServer starts a remote APM server listening on dsn address and binding to
-// configFile.
+// StartRemoteMasterServer starts a remote APM server serving the control API as configured by
+// config and binding to configFile.
 // It returns a RemoteMaster instance.
-func StartRemoteMasterServer(dsn string, configFile string) (*RemoteMaster, error) {
-	remoteMaster := &RemoteMaster{
-		master: NewMaster(configFile),
+func StartRemoteMasterServer(config APIConfig, configFile string) (*RemoteMaster, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	rpc.Register(remoteMaster)
-	l, e := net.Listen("tcp", dsn)
-	if e != nil {
-		log.Print("listen error: ", e)
-		return nil, e
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+	if config.Addr != "" {
+		l, err := net.Listen("tcp", config.Addr)
+		if err != nil {
+			log.Print("listen error: ", err)
+			return nil, err
+		}
+		if tlsConfig != nil {
+			l = tls.NewListener(l, tlsConfig)
+		}
+		listeners = append(listeners, l)
+	}
+	if config.SocketPath != "" {
+		// Remove the socket left behind by a previous run.
+		if err := os.Remove(config.SocketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			closeAll()
+			return nil, err
+		}
+		l, err := listenPrivateUnix(config.SocketPath)
+		if err != nil {
+			closeAll()
+			log.Print("listen error: ", err)
+			return nil, err
+		}
+		listeners = append(listeners, l)
 	}
 
-	go rpc.Accept(l)
+	remoteMaster := &RemoteMaster{
+		master: NewMaster(configFile),
+	}
+	handler := newAPIHandler(remoteMaster, &config)
+	for _, l := range listeners {
+		server := config.server(handler)
+		remoteMaster.servers = append(remoteMaster.servers, server)
+		remoteMaster.addrs = append(remoteMaster.addrs, l.Addr())
+		go func(l net.Listener) {
+			if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("API server on %s stopped due to %s.", l.Addr(), err)
+			}
+		}(l)
+	}
 
 	return remoteMaster, nil
 }
 
+// umaskLock serializes the umask changes of listenPrivateUnix, since the umask is shared by the whole master.
+var umaskLock sync.Mutex
+
+// listenPrivateUnix will listen on a unix socket only its owner can connect to. The socket is
+// created with a restrictive umask, so it is never reachable by others, not even briefly.
+// Returns a tuple with the listener and an error in case there's any.
+func listenPrivateUnix(path string) (net.Listener, error) {
+	umaskLock.Lock()
+	defer umaskLock.Unlock()
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
+
 // StartRemoteClient will start a remote client that can talk to a remote server that
-// is already running on dsn address.
+// is already running on dsn address. dsn is either host:port, https://host:port or
+// unix:///path/to/socket.
 // It returns an error in case there's any or it could not connect within the timeout.
-func StartRemoteClient(dsn string, timeout time.Duration) (*RemoteClient, error) {
-	conn, err := net.DialTimeout("tcp", dsn, timeout)
-	if err != nil {
+func StartRemoteClient(dsn string, timeout time.Duration, opts ...ClientOption) (*RemoteClient, error) {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	transport := &http.Transport{
+		DialContext:     dialer.DialContext,
+		TLSClientConfig: o.tlsConfig,
+	}
+	baseURL := dsn
+	switch {
+	case strings.HasPrefix(dsn, "unix://"):
+		socketPath := strings.TrimPrefix(dsn, "unix://")
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+		baseURL = "http://unix"
+	case strings.HasPrefix(dsn, "http://"), strings.HasPrefix(dsn, "https://"):
+	default:
+		baseURL = "http://" + dsn
+	}
+
+	client := &RemoteClient{
+		http:    &http.Client{Transport: transport},
+		baseURL: strings.TrimSuffix(baseURL, "/") + "/" + APIVersion,
+		token:   o.token,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := client.call(ctx, http.MethodGet, "/version", nil, nil); err != nil {
+		transport.CloseIdleConnections()
 		return nil, err
 	}
-	return &RemoteClient{conn: rpc.NewClient(conn)}, nil
+	return client, nil
+}
+
+// Close will release the connections of the client.
+func (client *RemoteClient) Close() {
+	client.http.CloseIdleConnections()
+}
+
+// call will send a request to the API and decode the JSON response onto out, if not nil.
+// It returns an error in case there's any.
+func (client *RemoteClient) call(ctx context.Context, method string, path string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, client.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if client.token != "" {
+		req.Header.Set("Authorization", "Bearer "+client.token)
+	}
+
+	resp, err := client.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr apiError
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			apiErr.Error = http.StatusText(resp.StatusCode)
+		}
+		return &APIError{Status: resp.StatusCode, Message: apiErr.Error}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// procPath returns the API path of process procName.
+func procPath(procName string, suffix string) string {
+	return "/procs/" + url.PathEscape(procName) + suffix
+}
+
+// clusterPath returns the API path of cluster name.
+func clusterPath(name string, suffix string) string {
+	return "/clusters/" + url.PathEscape(name) + suffix
 }
 
 // Save will save a list of procs onto a file.
 // Returns an error in case there's any.
 func (client *RemoteClient) Save() error {
-	var started bool
-	return client.conn.Call("RemoteMaster.Save", "", &started)
+	return client.call(context.Background(), http.MethodPost, "/save", nil, nil)
 }
 
 // Resurrect will restore all previously save processes.
 // Returns an error in case there's any.
 func (client *RemoteClient) Resurrect() error {
-	var started bool
-	return client.conn.Call("RemoteMaster.Resurrect", "", &started)
+	return client.call(context.Background(), http.MethodPost, "/resurrect", nil, nil)
 }
 
 // StartGoBin is a wrapper that calls the remote StartsGoBin.
@@ -175,42 +589,223 @@ func (client *RemoteClient) StartGoBin(sourcePath string, name string, keepAlive
 		KeepAlive:  keepAlive,
 		Args:       args,
 	}
-	var started bool
-	return client.conn.Call("RemoteMaster.StartGoBin", goBin, &started)
+	return client.StartGoBinWith(goBin)
+}
+
+// StartGoBinWith is a wrapper that calls the remote StartGoBin with all the goBin options,
+// such as the restart policy and the health check.
+// It returns an error in case there's any.
+func (client *RemoteClient) StartGoBinWith(goBin *GoBin) error {
+	return client.call(context.Background(), http.MethodPost, "/gobins", goBin, nil)
+}
+
+// StartCommand is a wrapper that calls the remote StartCommand.
+// It returns an error in case there's any.
+func (client *RemoteClient) StartCommand(command *Command) error {
+	return client.call(context.Background(), http.MethodPost, "/commands", command, nil)
+}
+
+// StartBinary is a wrapper that calls the remote StartCommand to run the prebuilt binary path.
+// It returns an error in case there's any.
+func (client *RemoteClient) StartBinary(path string, name string, keepAlive bool, args []string) error {
+	return client.StartCommand(&Command{
+		Name:      name,
+		Language:  LanguageBinary,
+		Source:    path,
+		KeepAlive: keepAlive,
+		Args:      args,
+	})
+}
+
+// StartShell is a wrapper that calls the remote StartCommand to run command with /bin/sh.
+// It returns an error in case there's any.
+func (client *RemoteClient) StartShell(command string, name string, keepAlive bool) error {
+	return client.StartCommand(&Command{
+		Name:      name,
+		Language:  LanguageShell,
+		Source:    command,
+		KeepAlive: keepAlive,
+	})
+}
+
+// StartScript is a wrapper that calls the remote StartCommand to run script with the interpreter of language.
+// It returns an error in case there's any.
+func (client *RemoteClient) StartScript(language string, script string, name string, keepAlive bool, args []string) error {
+	return client.StartCommand(&Command{
+		Name:      name,
+		Language:  language,
+		Source:    script,
+		KeepAlive: keepAlive,
+		Args:      args,
+	})
+}
+
+// ApplyManifest is a wrapper that calls the remote ApplyManifest.
+// It returns a tuple with the applied actions and an error in case there's any.
+func (client *RemoteClient) ApplyManifest(manifest *Manifest) ([]ManifestAction, error) {
+	var response ManifestResponse
+	if err := client.call(context.Background(), http.MethodPost, "/manifest/apply", manifest, &response); err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		return response.Actions, errors.New(response.Error)
+	}
+	return response.Actions, nil
+}
+
+// DiffManifest is a wrapper that calls the remote DiffManifest.
+// It returns a tuple with the actions needed to converge and an error in case there's any.
+func (client *RemoteClient) DiffManifest(manifest *Manifest) ([]ManifestAction, error) {
+	var response ManifestResponse
+	err := client.call(context.Background(), http.MethodPost, "/manifest/diff", manifest, &response)
+	return response.Actions, err
 }
 
 // RestartProcess is a wrapper that calls the remote RestartProcess.
 // It returns an error in case there's any.
 func (client *RemoteClient) RestartProcess(procName string) error {
-	var started bool
-	return client.conn.Call("RemoteMaster.RestartProcess", procName, &started)
+	return client.call(context.Background(), http.MethodPost, procPath(procName, "/restart"), nil, nil)
+}
+
+// ReloadProcess is a wrapper that calls the remote ReloadProcess.
+// It returns an error in case there's any.
+func (client *RemoteClient) ReloadProcess(procName string) error {
+	return client.call(context.Background(), http.MethodPost, procPath(procName, "/reload"), nil, nil)
 }
 
 // StartProcess is a wrapper that calls the remote StartProcess.
 // It returns an error in case there's any.
 func (client *RemoteClient) StartProcess(procName string) error {
-	var started bool
-	return client.conn.Call("RemoteMaster.StartProcess", procName, &started)
+	return client.call(context.Background(), http.MethodPost, procPath(procName, "/start"), nil, nil)
 }
 
 // StopProcess is a wrapper that calls the remote StopProcess.
 // It returns an error in case there's any.
 func (client *RemoteClient) StopProcess(procName string) error {
-	var stopped bool
-	return client.conn.Call("RemoteMaster.StopProcess", procName, &stopped)
+	return client.call(context.Background(), http.MethodPost, procPath(procName, "/stop"), nil, nil)
+}
+
+// SetRestartPolicy is a wrapper that calls the remote SetRestartPolicy.
+// It returns an error in case there's any.
+func (client *RemoteClient) SetRestartPolicy(procName string, policy RestartPolicy) error {
+	return client.call(context.Background(), http.MethodPut, procPath(procName, "/restart-policy"), policy, nil)
+}
+
+// LogStream is a stream of log lines returned by RemoteClient.Logs.
+type LogStream struct {
+	lines  chan LogLine
+	ctx    context.Context // ctx is canceled by Close, aborting a pending follow request.
+	cancel context.CancelFunc
+	err    error
+}
+
+// Lines returns the channel the log lines are delivered on. It is closed once the
+// stream ends, either because all lines were delivered, Close was called or on error.
+func (stream *LogStream) Lines() <-chan LogLine {
+	return stream.lines
+}
+
+// Err returns the error that ended the stream. It should be called after Lines is closed.
+func (stream *LogStream) Err() error {
+	return stream.err
+}
+
+// Close will stop the stream.
+func (stream *LogStream) Close() {
+	stream.cancel()
+}
+
+func (stream *LogStream) send(lines []LogLine) bool {
+	for _, line := range lines {
+		select {
+		case stream.lines <- line:
+		case <-stream.ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// Logs is a wrapper that calls the remote Logs. It returns a stream with the last lines lines
+// written by process procName and, if follow is set, the lines written afterwards until it is closed.
+// It returns an error in case there's any.
+func (client *RemoteClient) Logs(procName string, lines int, follow bool) (*LogStream, error) {
+	var response LogsResponse
+	path := procPath(procName, "/logs?lines="+strconv.Itoa(lines))
+	if err := client.call(context.Background(), http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &LogStream{
+		lines:  make(chan LogLine, 64),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go func() {
+		defer close(stream.lines)
+		if !stream.send(response.Lines) || !follow {
+			return
+		}
+		next := response.Next
+		for {
+			var response LogsResponse
+			q := url.Values{
+				"follow": {"true"},
+				"after":  {strconv.FormatUint(next, 10)},
+				"wait":   {logFollowWait.String()},
+			}
+			path := procPath(procName, "/logs?"+q.Encode())
+			if err := client.call(stream.ctx, http.MethodGet, path, nil, &response); err != nil {
+				if stream.ctx.Err() != nil {
+					return
+				}
+				stream.err = err
+				return
+			}
+			if !stream.send(response.Lines) {
+				return
+			}
+			next = response.Next
+		}
+	}()
+	return stream, nil
+}
+
+// StartCluster is a wrapper that calls the remote StartCluster.
+// It returns an error in case there's any.
+func (client *RemoteClient) StartCluster(cluster *Cluster) error {
+	return client.call(context.Background(), http.MethodPost, "/clusters", cluster, nil)
+}
+
+// Scale is a wrapper that calls the remote Scale.
+// It returns an error in case there's any.
+func (client *RemoteClient) Scale(name string, n int) error {
+	return client.call(context.Background(), http.MethodPut, clusterPath(name, "/scale"), &ScaleRequest{Name: name, Instances: n}, nil)
+}
+
+// RollingRestart is a wrapper that calls the remote RollingRestart.
+// It returns an error in case there's any.
+func (client *RemoteClient) RollingRestart(name string) error {
+	return client.call(context.Background(), http.MethodPost, clusterPath(name, "/rolling-restart"), nil, nil)
+}
+
+// DeleteCluster is a wrapper that calls the remote DeleteCluster.
+// It returns an error in case there's any.
+func (client *RemoteClient) DeleteCluster(name string) error {
+	return client.call(context.Background(), http.MethodDelete, clusterPath(name, ""), nil, nil)
 }
 
 // DeleteProcess is a wrapper that calls the remote DeleteProcess.
 // It returns an error in case there's any.
 func (client *RemoteClient) DeleteProcess(procName string) error {
-	var deleted bool
-	return client.conn.Call("RemoteMaster.DeleteProcess", procName, &deleted)
+	return client.call(context.Background(), http.MethodDelete, procPath(procName, ""), nil, nil)
 }
 
 // MonitStatus is a wrapper that calls the remote MonitStatus.
 // It returns a tuple with a list of process and an error in case there's any.
 func (client *RemoteClient) MonitStatus() (ProcResponse, error) {
-	var response *ProcResponse
-	err := client.conn.Call("RemoteMaster.MonitStatus", "", &response)
-	return *response, err
+	var response ProcResponse
+	err := client.call(context.Background(), http.MethodGet, "/procs", nil, &response)
+	return response, err
 }
@@ -0,0 +1,106 @@
+package process
+
+import "time"
+
+// Restart modes supported by RestartPolicy.
+const (
+	RestartAlways    = "always"     // restart whenever the process exits
+	RestartOnFailure = "on-failure" // restart only when the exit code is not a success code
+	RestartNever     = "never"      // never restart
+)
+
+// Default values used when a RestartPolicy field is left empty.
+const (
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = time.Minute
+	DefaultMaxRestarts    = 10
+	DefaultRestartWindow  = time.Minute
+)
+
+// RestartPolicy describes when and how fast Master restarts a process that died.
+type RestartPolicy struct {
+	Mode           string        // always, on-failure or never. Empty means always if KeepAlive is set, never otherwise.
+	SuccessCodes   []int         // exit codes treated as success by on-failure. Defaults to [0].
+	InitialBackoff time.Duration // delay before the second restart within Window. The first one is immediate.
+	MaxBackoff     time.Duration // upper bound for the exponential delay.
+	MaxRestarts    int           // restarts allowed within Window before the proc is marked as errored. Negative means unlimited.
+	Window         time.Duration // sliding window used to count restarts.
+}
+
+// mode resolves the effective restart mode, keeping backwards compatibility with KeepAlive.
+func (p RestartPolicy) mode(keepAlive bool) string {
+	if p.Mode != "" {
+		return p.Mode
+	}
+	if keepAlive {
+		return RestartAlways
+	}
+	return RestartNever
+}
+
+// shouldRestart decides whether a process that exited with exitCode must be restarted.
+// A negative exit code (killed by a signal or unknown) is treated as a failure.
+func (p RestartPolicy) shouldRestart(keepAlive bool, exitCode int) bool {
+	switch p.mode(keepAlive) {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return !p.isSuccess(exitCode)
+	default:
+		return false
+	}
+}
+
+func (p RestartPolicy) isSuccess(exitCode int) bool {
+	if exitCode < 0 {
+		return false
+	}
+	codes := p.SuccessCodes
+	if len(codes) == 0 {
+		codes = []int{0}
+	}
+	for _, c := range codes {
+		if exitCode == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (p RestartPolicy) window() time.Duration {
+	if p.Window <= 0 {
+		return DefaultRestartWindow
+	}
+	return p.Window
+}
+
+func (p RestartPolicy) maxRestarts() int {
+	if p.MaxRestarts == 0 {
+		return DefaultMaxRestarts
+	}
+	return p.MaxRestarts
+}
+
+// backoff returns the delay before the next restart given how many restarts
+// already happened within the window.
+func (p RestartPolicy) backoff(recent int) time.Duration {
+	if recent == 0 {
+		return 0
+	}
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	d := initial
+	for i := 1; i < recent && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
@@ -0,0 +1,110 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRestartPolicyShouldRestart(t *testing.T) {
+	cases := []struct {
+		policy    RestartPolicy
+		keepAlive bool
+		code      int
+		want      bool
+	}{
+		{RestartPolicy{}, true, 0, true},
+		{RestartPolicy{}, false, 1, false},
+		{RestartPolicy{Mode: RestartAlways}, false, 0, true},
+		{RestartPolicy{Mode: RestartNever}, true, 1, false},
+		{RestartPolicy{Mode: RestartOnFailure}, true, 0, false},
+		{RestartPolicy{Mode: RestartOnFailure}, true, 2, true},
+		{RestartPolicy{Mode: RestartOnFailure}, true, -1, true},
+		{RestartPolicy{Mode: RestartOnFailure, SuccessCodes: []int{0, 2}}, true, 2, false},
+	}
+	for i, c := range cases {
+		if got := c.policy.shouldRestart(c.keepAlive, c.code); got != c.want {
+			t.Errorf("case %d: shouldRestart(%v, %d) = %v, want %v", i, c.keepAlive, c.code, got, c.want)
+		}
+	}
+}
+
+func TestRestartPolicyBackoff(t *testing.T) {
+	p := RestartPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	want := []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for recent, w := range want {
+		if got := p.backoff(recent); got != w {
+			t.Errorf("backoff(%d) = %s, want %s", recent, got, w)
+		}
+	}
+}
+
+func TestProcStatusPruneRestarts(t *testing.T) {
+	now := time.Now()
+	status := &ProcStatus{RecentRestarts: []time.Time{now.Add(-2 * time.Minute), now.Add(-30 * time.Second), now}}
+	if n := status.pruneRestarts(now, time.Minute); n != 2 {
+		t.Fatalf("pruneRestarts = %d, want 2", n)
+	}
+	status.ResetRestarts()
+	if len(status.RecentRestarts) != 0 {
+		t.Fatalf("ResetRestarts left %d restarts", len(status.RecentRestarts))
+	}
+}
+
+// newTestMaster starts a master on a temporary folder with room for the given procs.
+func newTestMaster(t *testing.T, names ...string) *Master {
+	t.Helper()
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(configFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	master := NewMaster(configFile)
+	t.Cleanup(func() { master.Stop() })
+	return master
+}
+
+func TestMasterCrashLoop(t *testing.T) {
+	master := newTestMaster(t, "crasher")
+
+	err := master.RunPreparable(&Preparable{
+		Name:      "crasher",
+		Cmd:       "/bin/sh",
+		Args:      []string{"-c", "exit 3"},
+		SysFolder: master.SysFolder,
+		RestartPolicy: RestartPolicy{
+			Mode:           RestartOnFailure,
+			InitialBackoff: 10 * time.Millisecond,
+			MaxBackoff:     20 * time.Millisecond,
+			MaxRestarts:    3,
+			Window:         time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status ProcStatus
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		master.Lock()
+		status = *master.Procs["crasher"].GetStatus()
+		master.Unlock()
+		if status.Status == "errored" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.Status != "errored" {
+		t.Fatalf("status = %q, want errored", status.Status)
+	}
+	if status.Restarts != 3 || status.ExitCode != 3 || status.Reason == "" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
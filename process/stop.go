@@ -0,0 +1,144 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultStopTimeout is how long a process has to exit after its stop signal before it is killed.
+const DefaultStopTimeout = 10 * time.Second
+
+// HookTimeout is how long a post-start or pre-stop hook may run before it is killed.
+const HookTimeout = 30 * time.Second
+
+// killTimeout is how long a stop waits for a killed process to be reaped before giving up on it,
+// ie: when it is stuck in an uninterruptible sleep.
+const killTimeout = 5 * time.Second
+
+// stopSignals maps the signal names accepted by StopSignal to their value.
+var stopSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+}
+
+// parseSignal will parse a signal name such as SIGINT or INT. Empty means SIGTERM.
+// Returns an error in case the signal is not supported.
+func parseSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return syscall.SIGTERM, nil
+	}
+	sig, ok := stopSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unsupported stop signal %q", name)
+	}
+	return sig, nil
+}
+
+// stopTimeout returns how long the process has to exit after its stop signal.
+func (proc *Proc) stopTimeout() time.Duration {
+	if proc.StopTimeout > 0 {
+		return proc.StopTimeout
+	}
+	return DefaultStopTimeout
+}
+
+// procStopTimeout returns how long proc has to exit after its stop signal.
+func procStopTimeout(proc ProcContainer) time.Duration {
+	if p, ok := proc.(*Proc); ok {
+		return p.stopTimeout()
+	}
+	return DefaultStopTimeout
+}
+
+// signalGroup will send sig to the process group of the process, so its children get it too.
+// Returns an error in case there's any.
+func (proc *Proc) signalGroup(sig syscall.Signal) error {
+	if proc.process == nil {
+		return os.ErrProcessDone
+	}
+	// Every process is started as the leader of its own group, see Start.
+	return syscall.Kill(-proc.process.Pid, sig)
+}
+
+// hookCommand returns the command running hook for the current run of the process, nil if it has none.
+// The hook gets the process environment plus APM_PROC_NAME and APM_PROC_PID.
+func (proc *Proc) hookCommand(ctx context.Context, hook []string) *exec.Cmd {
+	if len(hook) == 0 {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, hook[0], hook[1:]...)
+	cmd.Dir = proc.Dir
+	cmd.Env = append(append(os.Environ(), proc.Env...),
+		"APM_PROC_NAME="+proc.Name,
+		"APM_PROC_PID="+strconv.Itoa(proc.Pid),
+	)
+	return cmd
+}
+
+// runHookCommand will run the hook cmd of proc name.
+// Returns an error with the hook output in case it failed.
+func runHookCommand(procName string, name string, cmd *exec.Cmd) error {
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		err = fmt.Errorf("%s hook of proc %s failed: %w: %s", name, procName, err, strings.TrimSpace(string(output)))
+		log.Print(err)
+		return err
+	}
+	log.Printf("Proc %s %s hook succeeded.", procName, name)
+	return nil
+}
+
+// postStart will run the post-start hook of the process in the background.
+func (proc *Proc) postStart() {
+	ctx, cancel := context.WithTimeout(context.Background(), HookTimeout)
+	// Build the command now, the proc may be restarted before it runs.
+	cmd := proc.hookCommand(ctx, proc.PostStart)
+	if cmd == nil {
+		cancel()
+		return
+	}
+	name := proc.Name
+	go func() {
+		defer cancel()
+		runHookCommand(name, "post-start", cmd)
+	}()
+}
+
+// preStopHook returns the command running the pre-stop hook of proc, nil if it has none. It is built
+// up front so it can run without the master lock. cancel must be called once the hook is done.
+func preStopHook(proc ProcContainer) (*exec.Cmd, context.CancelFunc) {
+	p, ok := proc.(*Proc)
+	if !ok || len(p.PreStop) == 0 {
+		return nil, func() {}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), HookTimeout)
+	return p.hookCommand(ctx, p.PreStop), cancel
+}
+
+// NOT thread safe method. Lock should be acquire before calling it.
+// waitUnlocked will wait up to timeout for done with the lock released.
+// Returns false in case done did not happen in time.
+func (master *Master) waitUnlocked(done <-chan bool, timeout time.Duration) bool {
+	master.Unlock()
+	defer master.Lock()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
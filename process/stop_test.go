@@ -0,0 +1,192 @@
+package process
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processGone reports whether pid exited, zombies included.
+func processGone(pid int) bool {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	// The state follows the command name, which is between parentheses.
+	fields := strings.Fields(string(b[strings.LastIndexByte(string(b), ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+func waitFileContent(t *testing.T, path string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if b, err := os.ReadFile(path); err == nil && len(b) > 0 {
+			return strings.TrimSpace(string(b))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s was not written", path)
+	return ""
+}
+
+func TestStopTimeoutKillsGroup(t *testing.T) {
+	master := newTestMaster(t, "stubborn")
+	childFile := filepath.Join(t.TempDir(), "child")
+	err := master.RunPreparable(&Preparable{
+		Name: "stubborn",
+		Cmd:  "/bin/sh",
+		// The child inherits the ignored SIGTERM, only killing the group stops it.
+		Args:        []string{"-c", "trap '' TERM; sleep 30 & echo $! > " + childFile + "; wait"},
+		SysFolder:   master.SysFolder,
+		StopTimeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := strconv.Atoi(waitFileContent(t, childFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := master.Procs["stubborn"].GetPid()
+
+	start := time.Now()
+	if err := master.StopProcess("stubborn"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("stop took %s", elapsed)
+	}
+	status := master.Procs["stubborn"].GetStatus()
+	if status.Status != "stopped" || !strings.Contains(status.Reason, "killed") {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if !processGone(pid) {
+		t.Fatal("expected the process to be killed")
+	}
+	deadline := time.Now().Add(time.Second)
+	for !processGone(child) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the child to be killed with its group")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStopReleasesLock(t *testing.T) {
+	master := newTestMaster(t, "slow")
+	err := master.RunPreparable(&Preparable{
+		Name:        "slow",
+		Cmd:         "/bin/sh",
+		Args:        []string{"-c", "trap '' TERM; sleep 30 & wait"},
+		SysFolder:   master.SysFolder,
+		StopTimeout: 500 * time.Millisecond,
+		PreStop:     []string{"sleep", "0.3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- master.StopProcess("slow") }()
+	// First during the hook, then while waiting for the process to exit.
+	for _, wait := range []time.Duration{150 * time.Millisecond, 300 * time.Millisecond} {
+		time.Sleep(wait)
+		start := time.Now()
+		master.Lock()
+		master.Unlock()
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Fatalf("the master was locked for %s while the proc stopped", elapsed)
+		}
+	}
+	if err := master.StartProcess("slow"); err == nil || !strings.Contains(err.Error(), "stopping") {
+		t.Fatalf("expected starting a stopping proc to fail, got %v", err)
+	}
+	// Stopping it again waits for the stop in progress.
+	if err := master.StopProcess("slow"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	master.Lock()
+	defer master.Unlock()
+	if master.Procs["slow"].IsAlive() {
+		t.Fatal("expected the proc to be stopped")
+	}
+}
+
+func TestStopSignal(t *testing.T) {
+	master := newTestMaster(t, "interruptible")
+	trapped := filepath.Join(t.TempDir(), "trapped")
+	err := master.RunPreparable(&Preparable{
+		Name:       "interruptible",
+		Cmd:        "/bin/sh",
+		Args:       []string{"-c", "trap 'echo int > " + trapped + "; exit 0' INT; sleep 30 & wait"},
+		SysFolder:  master.SysFolder,
+		StopSignal: "SIGINT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := master.StopProcess("interruptible"); err != nil {
+		t.Fatal(err)
+	}
+	if got := waitFileContent(t, trapped); got != "int" {
+		t.Fatalf("expected the INT trap to run, got %q", got)
+	}
+	if reason := master.Procs["interruptible"].GetStatus().Reason; reason != "" {
+		t.Fatalf("expected a graceful stop, got %q", reason)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	master := newTestMaster(t, "hooked")
+	dir := t.TempDir()
+	postStart := filepath.Join(dir, "post-start")
+	preStop := filepath.Join(dir, "pre-stop")
+	err := master.RunPreparable(&Preparable{
+		Name:      "hooked",
+		Cmd:       "/bin/sh",
+		Args:      []string{"-c", "sleep 30"},
+		SysFolder: master.SysFolder,
+		PostStart: []string{"/bin/sh", "-c", "echo $APM_PROC_PID > " + postStart},
+		PreStop:   []string{"/bin/sh", "-c", "echo $APM_PROC_NAME > " + preStop},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := master.Procs["hooked"].GetPid()
+	if got := waitFileContent(t, postStart); got != strconv.Itoa(pid) {
+		t.Fatalf("expected the post-start hook to get pid %d, got %q", pid, got)
+	}
+	if err := master.StopProcess("hooked"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(preStop)
+	if err != nil || strings.TrimSpace(string(b)) != "hooked" {
+		t.Fatalf("expected the pre-stop hook to run before stopping, got %q %v", b, err)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for name, want := range map[string]syscall.Signal{
+		"":        syscall.SIGTERM,
+		"SIGINT":  syscall.SIGINT,
+		"quit":    syscall.SIGQUIT,
+		"SIGUSR2": syscall.SIGUSR2,
+	} {
+		if sig, err := parseSignal(name); err != nil || sig != want {
+			t.Errorf("%q: got %v %v", name, sig, err)
+		}
+	}
+	if _, err := parseSignal("SIGFOO"); err == nil {
+		t.Error("expected an unsupported signal error")
+	}
+}
@@ -17,6 +17,7 @@ type ProcWatcher struct {
 	procStatus  chan *ProcState
 	proc        ProcContainer
 	stopWatcher chan bool
+	done        chan struct{} // done is closed once the process was reaped
 }
 
 // Watcher is responsible for watching a list of processes and report to Master in
@@ -57,6 +58,7 @@ func (watcher *Watcher) AddProcWatcher(proc ProcContainer) {
 		procStatus:  make(chan *ProcState, 1),
 		proc:        proc,
 		stopWatcher: make(chan bool, 1),
+		done:        make(chan struct{}),
 	}
 	watcher.watchProcs[proc.Identifier()] = procWatcher
 	go func() {
@@ -66,30 +68,48 @@ func (watcher *Watcher) AddProcWatcher(proc ProcContainer) {
 			state: state,
 			err:   err,
 		}
+		close(procWatcher.done)
 	}()
 	go func() {
-		defer delete(watcher.watchProcs, procWatcher.proc.Identifier())
 		select {
 		case procStatus := <-procWatcher.procStatus:
+			// Forget the watcher before advising master, so a restart can watch the new process.
+			watcher.removeProcWatcher(procWatcher)
+			select {
+			case <-procWatcher.stopWatcher:
+				// The process died while being stopped, master is already taking care of it.
+				return
+			default:
+			}
 			log.Printf("Proc %s is dead, advising master...", procWatcher.proc.Identifier())
 			log.Printf("State is %s", procStatus.state.String())
 			watcher.restartProc <- procWatcher.proc
-			break
 		case <-procWatcher.stopWatcher:
-			break
+			watcher.removeProcWatcher(procWatcher)
 		}
 	}()
 }
 
+// removeProcWatcher will forget procWatcher unless it was already replaced.
+func (watcher *Watcher) removeProcWatcher(procWatcher *ProcWatcher) {
+	watcher.Lock()
+	defer watcher.Unlock()
+	if watcher.watchProcs[procWatcher.proc.Identifier()] == procWatcher {
+		delete(watcher.watchProcs, procWatcher.proc.Identifier())
+	}
+}
+
 // StopWatcher will stop a running watcher on a process with identifier 'identifier'
 // Returns a channel that will be populated when the watcher is finally done.
 func (watcher *Watcher) StopWatcher(identifier string) chan bool {
+	watcher.Lock()
+	defer watcher.Unlock()
 	if watcher, ok := watcher.watchProcs[identifier]; ok {
 		log.Printf("Stopping watcher on proc %s", identifier)
 		watcher.stopWatcher <- true
 		waitStop := make(chan bool, 1)
 		go func() {
-			<-watcher.procStatus
+			<-watcher.done
 			waitStop <- true
 		}()
 		return waitStop